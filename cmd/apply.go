@@ -0,0 +1,48 @@
+// cmd/apply.go
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/amenophis1er/mktools/internal/plugin"
+	"github.com/spf13/cobra"
+)
+
+func newApplyCmd(registry *plugin.Registry) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "apply [flags] <response.md|->",
+		Short: "Apply changes from an LLM response",
+		Long: `Apply file changes from an LLM response to the working tree.
+
+The response may contain whole files in the context format (a "## path"
+heading followed by a fenced code block) or unified diffs. A preview diff is
+shown first, and files are only changed if their current checksum matches the
+one recorded in the context the response was based on. Replaced files are
+backed up under .mktools/backup, and all files are updated together or not at all.`,
+		Example: `  # Preview and apply a saved response
+  mktools apply response.md
+
+  # Verify against a specific context file
+  mktools apply response.md --context context-20240101-120000.md
+
+  # Only show what would change
+  mktools apply response.md --dry-run
+
+  # Apply a response piped from another tool
+  pbpaste | mktools apply - --yes`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, ok := registry.Get("apply")
+			if !ok {
+				return fmt.Errorf("internal error: apply plugin not found")
+			}
+			return p.Execute(cmd.Context(), cmd, args)
+		},
+	}
+
+	if p, ok := registry.Get("apply"); ok {
+		p.AddFlags(cmd)
+	}
+
+	return cmd
+}
@@ -0,0 +1,55 @@
+// cmd/ask.go
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/amenophis1er/mktools/internal/plugin"
+	"github.com/spf13/cobra"
+)
+
+func newAskCmd(registry *plugin.Registry) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ask [flags] [question] [path]",
+		Short: "Ask the configured model about a project",
+		Long: `Generate the context for a project (the current directory if no path is
+given), send it with a question to the model configured in the llm section,
+and stream the answer to the terminal.
+
+The context is built in memory and no context file is written. Use
+--context-file to send an existing context instead.
+
+With --prompt, the message sent is a named prompt template rendered with
+the context, the question, the file list or the uncommitted diff, and the
+question is optional. To render a template for another project without a
+question, give the project directory with --path. See "mktools prompt list"
+for the templates.`,
+		Example: `  # Ask about the current project
+  mktools ask "why is the cache slow to warm up?"
+
+  # Reuse a context file and keep a transcript
+  mktools ask "where are retries handled?" --context-file context.md --save notes/retries.md
+
+  # Use a custom system prompt
+  mktools ask "review the error handling" --system "You are a strict code reviewer."
+
+  # Render a prompt template
+  mktools ask --prompt refactor
+  mktools ask --prompt write-tests "the config loader"
+  mktools ask --prompt refactor --path ./other-project`,
+		Args: cobra.RangeArgs(0, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, ok := registry.Get("ask")
+			if !ok {
+				return fmt.Errorf("internal error: ask plugin not found")
+			}
+			return p.Execute(cmd.Context(), cmd, args)
+		},
+	}
+
+	if p, ok := registry.Get("ask"); ok {
+		p.AddFlags(cmd)
+	}
+
+	return cmd
+}
@@ -0,0 +1,77 @@
+// cmd/cache.go
+package cmd
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/amenophis1er/mktools/internal/cache"
+	"github.com/amenophis1er/mktools/internal/filesize"
+	"github.com/amenophis1er/mktools/internal/llm"
+	"github.com/amenophis1er/mktools/plugins/context"
+	"github.com/spf13/cobra"
+)
+
+// knownCaches are the caches mktools writes to. They can be cleared by
+// name before they were ever created.
+var knownCaches = []string{llm.CacheName, context.SectionCacheName}
+
+func newCacheCmd() *cobra.Command {
+	cacheCmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage mktools caches",
+		Long: `Manage the caches mktools keeps under the user cache directory
+($XDG_CACHE_HOME/mktools or the platform equivalent):
+  llm       responses of LLM calls, replayed for identical requests
+  sections  rendered file sections, reused when generating contexts
+
+Available Commands:
+  clear   Remove cached entries`,
+	}
+
+	clearCmd := &cobra.Command{
+		Use:   "clear [name...]",
+		Short: "Remove cached entries",
+		Long:  `Remove the entries of the named caches, or of every cache when no name is given.`,
+		Example: `  # Clear every cache
+  mktools cache clear
+
+  # Only forget cached LLM responses
+  mktools cache clear llm`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			existing, err := cache.Names()
+			if err != nil {
+				return err
+			}
+			names := args
+			if len(names) == 0 {
+				names = existing
+			}
+			if len(names) == 0 {
+				fmt.Println("No caches to clear")
+				return nil
+			}
+			for _, name := range names {
+				if !slices.Contains(existing, name) && !slices.Contains(knownCaches, name) {
+					return fmt.Errorf("no cache named %q", name)
+				}
+			}
+
+			for _, name := range names {
+				store, err := cache.Open(name)
+				if err != nil {
+					return err
+				}
+				n, size, err := store.Clear()
+				if err != nil {
+					return fmt.Errorf("failed to clear %s cache: %w", name, err)
+				}
+				fmt.Printf("Cleared %s cache: %d entries (%s)\n", name, n, filesize.Format(size))
+			}
+			return nil
+		},
+	}
+
+	cacheCmd.AddCommand(clearCmd)
+	return cacheCmd
+}
@@ -0,0 +1,42 @@
+// cmd/chat.go
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/amenophis1er/mktools/internal/plugin"
+	"github.com/spf13/cobra"
+)
+
+func newChatCmd(registry *plugin.Registry) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "chat [flags] [path]",
+		Short: "Chat with the configured model about a project",
+		Long: `Start a conversation with the model configured in the llm section, seeded
+with the context of a project (the current directory if no path is given).
+
+The files in the context are re-read before each question when they change
+on disk, so the model always sees their current content. Type /help in the
+chat for the available commands: /files, /add, /drop, /refresh, /tokens,
+/save, /clear and /quit.`,
+		Example: `  # Chat about the current project
+  mktools chat
+
+  # Chat about another project with a specific model
+  mktools chat ../service --model claude-3-5-haiku-latest`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, ok := registry.Get("chat")
+			if !ok {
+				return fmt.Errorf("internal error: chat plugin not found")
+			}
+			return p.Execute(cmd.Context(), cmd, args)
+		},
+	}
+
+	if p, ok := registry.Get("chat"); ok {
+		p.AddFlags(cmd)
+	}
+
+	return cmd
+}
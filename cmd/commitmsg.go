@@ -0,0 +1,46 @@
+// cmd/commitmsg.go
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/amenophis1er/mktools/internal/plugin"
+	"github.com/spf13/cobra"
+)
+
+func newCommitMsgCmd(registry *plugin.Registry) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "commit-msg [flags]",
+		Short: "Write a commit message for the staged changes",
+		Long: `Ask the configured model for a commit message describing the staged
+changes. The model sees the staged diff, the list of staged files, the
+branch and recent commit subjects, and follows the convention set in the
+commit section of the configuration.
+
+The message is printed unless --write is given. With --install-hook, a
+prepare-commit-msg hook fills in the message whenever "git commit" opens
+the editor.`,
+		Example: `  # Print a message for the staged changes
+  mktools commit-msg
+
+  # Commit with it after reviewing it in the editor
+  mktools commit-msg --write && git commit -e -F .git/COMMIT_EDITMSG
+
+  # Generate messages on every "git commit"
+  mktools commit-msg --install-hook`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, ok := registry.Get("commit-msg")
+			if !ok {
+				return fmt.Errorf("internal error: commit-msg plugin not found")
+			}
+			return p.Execute(cmd.Context(), cmd, args)
+		},
+	}
+
+	if p, ok := registry.Get("commit-msg"); ok {
+		p.AddFlags(cmd)
+	}
+
+	return cmd
+}
@@ -0,0 +1,126 @@
+// cmd/context.go
+package cmd
+
+import (
+	"github.com/amenophis1er/mktools/plugins/context"
+	"github.com/spf13/cobra"
+)
+
+func newContextUnpackCmd(p *context.ContextPlugin) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "unpack <context-file>",
+		Short: "Recreate files from a context file",
+		Long: `Parse a generated context file and recreate the files it contains.
+Each restored file is verified against the checksums in the context metadata,
+and any mismatches or missing files are reported.`,
+		Example: `  # Restore a context into ./restored
+  mktools context unpack context.md -o ./restored
+
+  # Fail if any file doesn't match its recorded checksum
+  mktools context unpack context.md -o ./restored --strict`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts := context.UnpackOptions{}
+			opts.OutputDir, _ = cmd.Flags().GetString("output")
+			opts.Force, _ = cmd.Flags().GetBool("force")
+			opts.Strict, _ = cmd.Flags().GetBool("strict")
+			return p.Unpack(args[0], opts)
+		},
+	}
+
+	cmd.Flags().StringP("output", "o", ".", "directory to restore files into")
+	cmd.Flags().Bool("force", false, "overwrite existing files")
+	cmd.Flags().Bool("strict", false, "fail when a file doesn't match its recorded checksum")
+
+	return cmd
+}
+
+func newContextStatusCmd(p *context.ContextPlugin) *cobra.Command {
+	return &cobra.Command{
+		Use:   "status [path]",
+		Short: "Show whether context files are up to date",
+		Long: `List the context files in a directory (the current directory if not
+specified) and report whether each one still matches the files it was
+generated from. For stale contexts, the added (A), modified (M) and
+deleted (D) files are listed.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) > 0 {
+				dir = args[0]
+			}
+			return p.Status(dir)
+		},
+	}
+}
+
+func newContextDiffCmd(p *context.ContextPlugin) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff <old-context> <new-context>",
+		Short: "Compare two context files",
+		Long: `Compare two context files using the checksums in their metadata,
+listing added (A), modified (M) and deleted (D) files followed by
+unified diffs of their contents.`,
+		Example: `  # What changed between two generated contexts
+  mktools context diff context-20240101-120000.md context.md
+
+  # Only list the changed files
+  mktools context diff old.md new.md --name-only`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			nameOnly, _ := cmd.Flags().GetBool("name-only")
+			return p.Diff(args[0], args[1], nameOnly)
+		},
+	}
+
+	cmd.Flags().Bool("name-only", false, "only list changed files")
+
+	return cmd
+}
+
+func newContextVerifyCmd(p *context.ContextPlugin) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify <context-file>",
+		Short: "Verify the signature and checksums of a context file",
+		Long: `Check that a context file has not been modified since it was generated:
+the ed25519 signature over its metadata, the checksum of its body and the
+checksum of every embedded file. Contexts are signed when context.sign_key
+is set in the configuration.
+
+Without --key, the signature is checked against the public key embedded in
+the context, which proves integrity but not who signed it.`,
+		Example: `  # Verify against a known public key
+  mktools context verify context.md --key mktools.pem.pub
+
+  # Only check checksums of an unsigned context
+  mktools context verify context.md --allow-unsigned`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts := context.VerifyOptions{}
+			opts.KeyFile, _ = cmd.Flags().GetString("key")
+			opts.AllowUnsigned, _ = cmd.Flags().GetBool("allow-unsigned")
+			return p.Verify(args[0], opts)
+		},
+	}
+
+	cmd.Flags().String("key", "", "PEM public key the context must be signed with")
+	cmd.Flags().Bool("allow-unsigned", false, "don't fail on unsigned contexts (checksums are still verified)")
+
+	return cmd
+}
+
+func newContextKeygenCmd(p *context.ContextPlugin) *cobra.Command {
+	return &cobra.Command{
+		Use:   "keygen <private-key-file>",
+		Short: "Generate a key pair for signing contexts",
+		Long: `Generate an ed25519 key pair. The private key is written in PKCS#8 PEM
+format to the given file, and the public key to the same path with a .pub
+suffix. Existing files are never overwritten.`,
+		Example: `  # Then set context.sign_key: ~/.config/mktools/sign.pem in .mktools.yaml
+  mktools context keygen ~/.config/mktools/sign.pem`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return p.Keygen(args[0])
+		},
+	}
+}
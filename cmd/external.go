@@ -0,0 +1,49 @@
+// cmd/external.go
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/amenophis1er/mktools/internal/plugin"
+	"github.com/spf13/cobra"
+)
+
+// addExternalCmds adds a command for every mktools-<name> executable found
+// in the plugins directory or on PATH. Built-in commands take precedence.
+func addExternalCmds(root *cobra.Command, registry *plugin.Registry) {
+	// help and completion are only added by cobra when it executes
+	taken := map[string]bool{"help": true, "completion": true}
+	for _, c := range root.Commands() {
+		taken[c.Name()] = true
+		for _, alias := range c.Aliases {
+			taken[alias] = true
+		}
+	}
+
+	for _, p := range plugin.DiscoverExternal(cfg) {
+		if taken[p.Name()] {
+			continue
+		}
+		registry.Register(p)
+		root.AddCommand(newExternalCmd(registry, p))
+	}
+}
+
+func newExternalCmd(registry *plugin.Registry, p *plugin.ExternalPlugin) *cobra.Command {
+	name := p.Name()
+	return &cobra.Command{
+		Use:   name + " [args...]",
+		Short: p.Description(),
+		Long: fmt.Sprintf(`Run the external plugin %s. Every argument, flags and --help included,
+is passed to it unchanged. The merged configuration is available to it as
+JSON in the MKTOOLS_CONFIG_JSON environment variable.`, p.Path()),
+		DisableFlagParsing: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, ok := registry.Get(name)
+			if !ok {
+				return fmt.Errorf("internal error: %s plugin not found", name)
+			}
+			return p.Execute(cmd.Context(), cmd, args)
+		},
+	}
+}
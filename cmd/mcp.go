@@ -0,0 +1,60 @@
+// cmd/mcp.go
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/amenophis1er/mktools/internal/plugin"
+	"github.com/spf13/cobra"
+)
+
+func newMCPCmd(registry *plugin.Registry) *cobra.Command {
+	mcpCmd := &cobra.Command{
+		Use:   "mcp",
+		Short: "Serve projects over the Model Context Protocol",
+		Long: `Serve projects to Model Context Protocol (MCP) clients, such as editor
+agents and desktop LLM applications.
+
+Available Commands:
+  serve   Serve a project over stdio`,
+	}
+
+	serveCmd := &cobra.Command{
+		Use:   "serve [path]",
+		Short: "Serve a project to an MCP client over stdio",
+		Long: `Serve the project at path, or the current directory, to an MCP client
+speaking JSON-RPC on stdin and stdout. The client launches the command
+itself; logs are written to stderr.
+
+The server offers these tools:
+  get_context    generate the project context, as "mktools context" does
+  list_files     list the project files, optionally filtered by a glob
+  read_file      read a project file or a range of its lines
+  project_info   report the project type and git branch, commit and status
+  search         search the project files for a string or regular expression
+
+The tools only see the files a context would contain, so the ignore
+patterns, size limit and file limit of the project's .mktools.yaml apply
+to clients too, whatever directory the client starts the server in.`,
+		Example: `  # Register with an MCP client (for instance in its JSON settings)
+  {"command": "mktools", "args": ["mcp", "serve", "/path/to/project"]}
+
+  # Also hide generated files from clients
+  mktools mcp serve --ignore "*.pb.go"`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, ok := registry.Get("mcp")
+			if !ok {
+				return fmt.Errorf("internal error: mcp plugin not found")
+			}
+			return p.Execute(cmd.Context(), cmd, args)
+		},
+	}
+
+	if p, ok := registry.Get("mcp"); ok {
+		p.AddFlags(serveCmd)
+	}
+
+	mcpCmd.AddCommand(serveCmd)
+	return mcpCmd
+}
@@ -0,0 +1,56 @@
+// cmd/models.go
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/amenophis1er/mktools/internal/filesize"
+	"github.com/amenophis1er/mktools/internal/llm"
+	"github.com/spf13/cobra"
+)
+
+func newModelsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "models",
+		Short: "List the models available from the configured LLM provider",
+		Long: `List the models the configured LLM provider can serve. For ollama this is
+the models pulled on the server; for openai-compatible servers, the models
+they report at /models. The configured model is marked with *.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			provider, err := llm.New(cfg.LLM)
+			if err != nil {
+				return err
+			}
+
+			models, err := llm.ListModels(cmd.Context(), provider)
+			if err != nil {
+				return fmt.Errorf("failed to list models: %w", err)
+			}
+			if len(models) == 0 {
+				fmt.Printf("No models available from %s\n", provider.Name())
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "  MODEL\tDETAILS\tSIZE\tCREATED")
+			for _, m := range models {
+				marker := " "
+				if m.ID == cfg.LLM.Model {
+					marker = "*"
+				}
+				size, created := "-", "-"
+				if m.Size > 0 {
+					size = filesize.Format(m.Size)
+				}
+				if !m.Created.IsZero() {
+					created = m.Created.Format("2006-01-02")
+				}
+				fmt.Fprintf(w, "%s %s\t%s\t%s\t%s\n", marker, m.ID, m.Description, size, created)
+			}
+			return w.Flush()
+		},
+	}
+}
@@ -0,0 +1,163 @@
+// cmd/prompt.go
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/amenophis1er/mktools/internal/prompt"
+	"github.com/spf13/cobra"
+)
+
+// newPromptTemplate is the starting point of "prompt new" without --from.
+const newPromptTemplate = `<context>
+{{.Context}}
+</context>
+
+{{.Question}}
+`
+
+func newPromptCmd() *cobra.Command {
+	promptCmd := &cobra.Command{
+		Use:   "prompt",
+		Short: "Manage prompt templates",
+		Long: `Manage the named prompt templates used with "mktools ask --prompt".
+
+Templates use Go's text/template syntax and can reference {{.Context}},
+{{.Files}}, {{.Diff}} and {{.Question}}. They come from, in order of
+precedence:
+  .mktools/prompts/<name>.md     shared with the project, next to .mktools.yaml
+  directories in prompts.dirs    from the configuration
+  ~/.config/mktools/prompts/     your own templates
+  prompts.templates              defined in the configuration
+  built-in templates             explain, refactor, write-tests
+
+Available Commands:
+  list    List the available templates
+  show    Print a template
+  new     Create a template file`,
+	}
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the available prompt templates",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			library, err := prompt.Load(cfg.Prompts)
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tDESCRIPTION\tSOURCE")
+			for _, p := range library.List() {
+				description := p.Description
+				if description == "" {
+					description = "-"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\n", p.Name, description, p.Source)
+			}
+			return w.Flush()
+		},
+	}
+
+	showCmd := &cobra.Command{
+		Use:   "show <name>",
+		Short: "Print a prompt template",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			library, err := prompt.Load(cfg.Prompts)
+			if err != nil {
+				return err
+			}
+			p, err := library.Get(args[0])
+			if err != nil {
+				return err
+			}
+			content, err := p.File()
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(os.Stderr, "# %s (%s)\n", p.Name, p.Source)
+			fmt.Print(content)
+			return nil
+		},
+	}
+
+	newCmd := &cobra.Command{
+		Use:   "new <name> [--global] [--from <template>] [--force]",
+		Short: "Create a prompt template file",
+		Long: `Create a prompt template in .mktools/prompts, where it can be checked in
+and shared with the project, or in ~/.config/mktools/prompts with --global.
+With --from, the new template starts as a copy of an existing one, which is
+how a built-in template is customized.`,
+		Example: `  # Start a project template and edit it
+  mktools prompt new security-audit
+
+  # Customize the built-in refactor template for this project
+  mktools prompt new refactor --from refactor --force`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			global, _ := cmd.Flags().GetBool("global")
+			from, _ := cmd.Flags().GetString("from")
+			force, _ := cmd.Flags().GetBool("force")
+			return newPrompt(args[0], from, global, force)
+		},
+	}
+
+	newCmd.Flags().Bool("global", false, "create the template in ~/.config/mktools/prompts")
+	newCmd.Flags().String("from", "", "copy an existing template")
+	newCmd.Flags().Bool("force", false, "overwrite an existing template file")
+
+	promptCmd.AddCommand(listCmd)
+	promptCmd.AddCommand(showCmd)
+	promptCmd.AddCommand(newCmd)
+	return promptCmd
+}
+
+func newPrompt(name, from string, global, force bool) error {
+	if name == "" || filepath.Base(name) != name {
+		return fmt.Errorf("invalid prompt name: %s", name)
+	}
+
+	p := &prompt.Prompt{Name: name, Description: "Describe what the prompt is for", Template: newPromptTemplate}
+	if from != "" {
+		library, err := prompt.Load(cfg.Prompts)
+		if err != nil {
+			return err
+		}
+		existing, err := library.Get(from)
+		if err != nil {
+			return err
+		}
+		copied := *existing
+		copied.Name = name
+		p = &copied
+	}
+
+	dir := prompt.ProjectDir
+	if global {
+		dir = prompt.GlobalDir()
+	}
+	path := filepath.Join(dir, name+prompt.Extension)
+	if _, err := os.Stat(path); err == nil && !force {
+		return fmt.Errorf("prompt file already exists at %s (use --force to overwrite)", path)
+	}
+
+	content, err := p.File()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create prompts directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write prompt: %w", err)
+	}
+
+	fmt.Printf("Prompt template created at %s\n", path)
+	return nil
+}
@@ -0,0 +1,46 @@
+// cmd/review.go
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/amenophis1er/mktools/internal/plugin"
+	"github.com/spf13/cobra"
+)
+
+func newReviewCmd(registry *plugin.Registry) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "review [flags]",
+		Short: "Review a diff with the configured model",
+		Long: `Send a diff and the new version of each changed file to the configured
+model, which reviews them against the rubric in the review section of the
+configuration and reports findings with a file, line, severity and message.
+
+Without --range, the uncommitted changes (staged and unstaged) are reviewed.
+A --range of a single revision reviews the working tree against it.
+Findings are printed as text, or as JSON or SARIF for editors and CI. With
+--fail-on, the command exits non-zero when findings reach that severity.`,
+		Example: `  # Review the uncommitted changes
+  mktools review
+
+  # Review a branch against main
+  mktools review --range main...HEAD
+
+  # Produce a SARIF report and fail the build on errors
+  mktools review --range origin/main...HEAD --format sarif -o review.sarif --fail-on error`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, ok := registry.Get("review")
+			if !ok {
+				return fmt.Errorf("internal error: review plugin not found")
+			}
+			return p.Execute(cmd.Context(), cmd, args)
+		},
+	}
+
+	if p, ok := registry.Get("review"); ok {
+		p.AddFlags(cmd)
+	}
+
+	return cmd
+}
@@ -4,11 +4,21 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/amenophis1er/mktools/internal/config"
+	"github.com/amenophis1er/mktools/internal/home"
 	"github.com/amenophis1er/mktools/internal/plugin"
 	"github.com/amenophis1er/mktools/internal/update"
+	"github.com/amenophis1er/mktools/internal/usage"
+	"github.com/amenophis1er/mktools/plugins/apply"
+	"github.com/amenophis1er/mktools/plugins/ask"
+	"github.com/amenophis1er/mktools/plugins/chat"
+	"github.com/amenophis1er/mktools/plugins/commitmsg"
 	"github.com/amenophis1er/mktools/plugins/context"
+	"github.com/amenophis1er/mktools/plugins/mcp"
+	"github.com/amenophis1er/mktools/plugins/review"
+	"github.com/amenophis1er/mktools/plugins/serve"
 	"github.com/spf13/cobra"
 )
 
@@ -28,7 +38,15 @@ func Execute() error {
 	registry := plugin.NewRegistry()
 
 	// Register plugins
-	registry.Register(context.New(cfg))
+	contextPlugin := context.New(cfg)
+	registry.Register(contextPlugin)
+	registry.Register(apply.New(cfg))
+	registry.Register(ask.New(cfg, contextPlugin))
+	registry.Register(chat.New(cfg, contextPlugin))
+	registry.Register(commitmsg.New(cfg))
+	registry.Register(review.New(cfg))
+	registry.Register(mcp.New(cfg))
+	registry.Register(serve.New(cfg))
 
 	rootCmd = &cobra.Command{
 		Use:   "mktools",
@@ -42,6 +60,11 @@ It provides various utilities for:
 Use "mktools [command] --help" for more information about a command.`,
 		SilenceErrors: true,
 		SilenceUsage:  true,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			// Attribute LLM calls to the command in the usage ledger
+			command := strings.TrimPrefix(cmd.CommandPath(), cmd.Root().Name()+" ")
+			cmd.SetContext(usage.WithCommand(cmd.Context(), command))
+		},
 	}
 
 	// Add global flags
@@ -52,13 +75,13 @@ Use "mktools [command] --help" for more information about a command.`,
 
 	// Add context command
 	contextCmd := &cobra.Command{
-		Use:   "context [flags] [path]",
+		Use:   "context [flags] [path|archive]",
 		Short: "Generate context for LLM",
 		Long: `Generate a context file containing project structure and file contents.
 The context can be used to give LLMs better understanding of your project.
 
-The command will analyze the specified directory (or current directory if not specified)
-and generate a markdown or text file containing:
+The command will analyze the specified directory (or current directory if not specified),
+or the contents of a zip, tar or tar.gz archive, and generate a markdown or text file containing:
 - Project type detection
 - Git information (if available)
 - File structure
@@ -78,7 +101,13 @@ By default, binary files, large files, and common build artifacts are excluded.`
   mktools context -o project-context.md
   
   # Generate with custom ignore patterns
-  mktools context --ignore "*.tmp" --ignore "build/*"`,
+  mktools context --ignore "*.tmp" --ignore "build/*"
+
+  # Generate from a git revision without touching the working copy
+  mktools context --rev v1.2.0
+
+  # Generate from a source archive without extracting it
+  mktools context bundle.tar.gz`,
 		Args: cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			p, ok := registry.Get("context")
@@ -100,8 +129,48 @@ By default, binary files, large files, and common build artifacts are excluded.`
 		p.AddFlags(contextCmd)
 	}
 
+	// Add context subcommands
+	contextCmd.AddCommand(newContextUnpackCmd(contextPlugin))
+	contextCmd.AddCommand(newContextStatusCmd(contextPlugin))
+	contextCmd.AddCommand(newContextDiffCmd(contextPlugin))
+	contextCmd.AddCommand(newContextVerifyCmd(contextPlugin))
+	contextCmd.AddCommand(newContextKeygenCmd(contextPlugin))
+
 	rootCmd.AddCommand(contextCmd)
 
+	// Add apply command
+	rootCmd.AddCommand(newApplyCmd(registry))
+
+	// Add ask command
+	rootCmd.AddCommand(newAskCmd(registry))
+
+	// Add chat command
+	rootCmd.AddCommand(newChatCmd(registry))
+
+	// Add commit-msg command
+	rootCmd.AddCommand(newCommitMsgCmd(registry))
+
+	// Add review command
+	rootCmd.AddCommand(newReviewCmd(registry))
+
+	// Add mcp command
+	rootCmd.AddCommand(newMCPCmd(registry))
+
+	// Add serve command
+	rootCmd.AddCommand(newServeCmd(registry))
+
+	// Add prompt command
+	rootCmd.AddCommand(newPromptCmd())
+
+	// Add models command
+	rootCmd.AddCommand(newModelsCmd())
+
+	// Add usage command
+	rootCmd.AddCommand(newUsageCmd())
+
+	// Add cache command
+	rootCmd.AddCommand(newCacheCmd())
+
 	// Add config command
 	configCmd := &cobra.Command{
 		Use:   "config",
@@ -182,6 +251,9 @@ compared to the global configuration.`,
 	configCmd.AddCommand(configDiffCmd)
 	rootCmd.AddCommand(configCmd)
 
+	// Add external plugins last, so they can't shadow built-in commands
+	addExternalCmds(rootCmd, registry)
+
 	// Check for updates in the background
 	go func() {
 		hasUpdate, newVersion, err := update.CheckForUpdate()
@@ -219,7 +291,7 @@ func initializeConfig(local, minimal, force bool) error {
 	if local {
 		configPath = ".mktools.yaml"
 	} else {
-		configDir := filepath.Join(os.Getenv("HOME"), ".config", "mktools")
+		configDir := filepath.Join(home.Dir(), ".config", "mktools")
 		if err := os.MkdirAll(configDir, 0755); err != nil {
 			return fmt.Errorf("failed to create config directory: %w", err)
 		}
@@ -0,0 +1,56 @@
+// cmd/serve.go
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/amenophis1er/mktools/internal/plugin"
+	"github.com/spf13/cobra"
+)
+
+func newServeCmd(registry *plugin.Registry) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "serve [flags] [path]",
+		Short: "Serve context generation over a local HTTP API",
+		Long: `Serve a local HTTP API for generating contexts, so tools such as
+dashboards and editor extensions can call mktools without starting it for
+every request. Requests refer to projects by a path relative to the served
+directory (the current directory by default); paths leading outside it are
+refused.
+
+Endpoints:
+  GET  /v1/health    server version and root
+  GET  /v1/project   project type and git information (?path=)
+  GET  /v1/files     files a context would include (?path=, ?ignore=, ?source=, ?rev=)
+  GET  /v1/status    freshness of the context files in a directory (?path=)
+  POST /v1/context   generate a context; the JSON body takes "path" and the
+                     options of "mktools context": structure_only, content_only,
+                     format, max_files, ignore, source, rev, no_cache
+
+Contexts are streamed back as they are written. The API has no
+authentication, so keep it on a loopback address. Interrupting the server
+lets requests in progress finish before it exits.`,
+		Example: `  # Serve the current directory on the default address
+  mktools serve
+
+  # Serve a workspace on another port
+  mktools serve --addr 127.0.0.1:9000 ~/src
+
+  # Generate a structure-only context of a project under the served directory
+  curl -X POST localhost:8420/v1/context -d '{"path": "api", "structure_only": true}'`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, ok := registry.Get("serve")
+			if !ok {
+				return fmt.Errorf("internal error: serve plugin not found")
+			}
+			return p.Execute(cmd.Context(), cmd, args)
+		},
+	}
+
+	if p, ok := registry.Get("serve"); ok {
+		p.AddFlags(cmd)
+	}
+
+	return cmd
+}
@@ -0,0 +1,110 @@
+// cmd/usage.go
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/amenophis1er/mktools/internal/home"
+	"github.com/amenophis1er/mktools/internal/usage"
+	"github.com/spf13/cobra"
+)
+
+func newUsageCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "usage [--by day|model|command|project] [--since 30d]",
+		Short: "Summarize the tokens and cost of LLM calls",
+		Long: `Summarize the usage ledger, which records the tokens, latency and estimated
+cost of every LLM call made by mktools. Costs are estimated with the prices
+in llm.models; calls to models without a price are counted but not priced.`,
+		Example: `  # Spending per day over the last 30 days
+  mktools usage
+
+  # Which models and commands cost the most this week
+  mktools usage --by model --since 7d
+  mktools usage --by command --since 7d
+
+  # Spending per project since a date
+  mktools usage --by project --since 2024-06-01`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			by, _ := cmd.Flags().GetString("by")
+			sinceFlag, _ := cmd.Flags().GetString("since")
+
+			since, err := parseSince(sinceFlag)
+			if err != nil {
+				return err
+			}
+
+			path := cfg.LLM.Ledger.Path
+			if path == "" {
+				path = usage.DefaultPath()
+			}
+			entries, err := usage.Read(home.Expand(path), since)
+			if err != nil {
+				return err
+			}
+			if len(entries) == 0 {
+				fmt.Printf("No LLM calls recorded in %s since %s\n", path, since.Format("2006-01-02"))
+				return nil
+			}
+
+			rows, total, err := usage.Summarize(entries, by)
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintf(w, "%s\tCALLS\tINPUT\tOUTPUT\tCOST\tAVG LATENCY\n", strings.ToUpper(by))
+			for _, row := range append(rows, total) {
+				fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\t%s\n", row.Key, row.Calls, row.InputTokens, row.OutputTokens,
+					formatCost(row), row.AverageLatency().Round(100*time.Millisecond))
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			if total.Unpriced > 0 {
+				fmt.Printf("\n* %d calls used models without a price in llm.models and aren't included in the cost\n", total.Unpriced)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().String("by", "day", "group by day, model, command or project")
+	cmd.Flags().String("since", "30d", "only count calls since a date (2006-01-02) or for a period (7d, 12h)")
+	return cmd
+}
+
+// parseSince accepts a date, a duration, or a number of days such as 30d.
+func parseSince(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return time.Now().AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid since value: %s (use a date such as 2024-06-01 or a period such as 7d)", value)
+}
+
+func formatCost(row *usage.Row) string {
+	cost := fmt.Sprintf("$%.4f", row.Cost)
+	switch {
+	case row.Unpriced == row.Calls:
+		return "-"
+	case row.Unpriced > 0:
+		return cost + "*"
+	}
+	return cost
+}
@@ -0,0 +1,224 @@
+// Package cache is a content-addressed store on disk under the user's cache
+// directory ($XDG_CACHE_HOME/mktools or the platform equivalent).
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Store is one named cache directory.
+type Store struct {
+	dir     string
+	ttl     time.Duration
+	maxSize int64
+}
+
+// Base returns the directory holding every store.
+func Base() (string, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate cache directory: %w", err)
+	}
+	return filepath.Join(base, "mktools"), nil
+}
+
+// Names lists the stores that exist.
+func Names() ([]string, error) {
+	base, err := Base()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(base)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list caches: %w", err)
+	}
+
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+// Open returns the store called name, creating its directory if needed.
+// The name must be a single path element.
+func Open(name string) (*Store, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return nil, fmt.Errorf("invalid cache name: %q", name)
+	}
+	base, err := Base()
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Join(base, name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Key derives a cache key from parts. Every setting that affects the cached
+// value must be one of the parts.
+func Key(parts ...string) string {
+	h := sha256.New()
+	h.Write([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Dir returns the directory the store keeps its entries in.
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// SetLimits makes entries expire ttl after they were stored, and keeps the
+// store under maxSize bytes by removing the oldest entries after each Put.
+// Zero disables either limit.
+func (s *Store) SetLimits(ttl time.Duration, maxSize int64) {
+	s.ttl = ttl
+	s.maxSize = maxSize
+}
+
+// Get returns the value stored under key.
+func (s *Store) Get(key string) ([]byte, bool) {
+	path := s.path(key)
+	if s.ttl > 0 {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, false
+		}
+		if time.Since(info.ModTime()) > s.ttl {
+			os.Remove(path)
+			return nil, false
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// Put stores data under key. The entry is written to a temporary file and
+// renamed, so concurrent readers never see a partial value.
+func (s *Store) Put(key string, data []byte) error {
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	if s.maxSize > 0 {
+		return s.Prune()
+	}
+	return nil
+}
+
+type entry struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+func (s *Store) entries() ([]entry, error) {
+	var entries []entry
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// Skip directories and the temporary files of concurrent writers
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".tmp-") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		entries = append(entries, entry{path: path, size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	return entries, err
+}
+
+// Prune removes expired entries, then the oldest ones until the store fits
+// its size limit.
+func (s *Store) Prune() error {
+	entries, err := s.entries()
+	if err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].modTime.Before(entries[j].modTime)
+	})
+
+	var total int64
+	for _, e := range entries {
+		total += e.size
+	}
+	for _, e := range entries {
+		expired := s.ttl > 0 && time.Since(e.modTime) > s.ttl
+		if !expired && (s.maxSize <= 0 || total <= s.maxSize) {
+			continue
+		}
+		if err := os.Remove(e.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		total -= e.size
+	}
+	return nil
+}
+
+// Clear removes every entry, returning how many were removed and their
+// total size.
+func (s *Store) Clear() (int, int64, error) {
+	entries, err := s.entries()
+	if err != nil {
+		return 0, 0, err
+	}
+	var size int64
+	for _, e := range entries {
+		size += e.size
+	}
+	if err := os.RemoveAll(s.dir); err != nil {
+		return 0, 0, fmt.Errorf("failed to clear cache: %w", err)
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return 0, 0, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return len(entries), size, nil
+}
+
+// path shards entries by the first two characters of their key.
+func (s *Store) path(key string) string {
+	return filepath.Join(s.dir, key[:2], key)
+}
@@ -0,0 +1,241 @@
+// Package collect selects the files that go into a context. The same
+// collector both builds a context and later checks it for staleness, so the
+// two always agree on which files a context covers.
+package collect
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/amenophis1er/mktools/internal/ignore"
+	"github.com/amenophis1er/mktools/internal/source"
+)
+
+// Options are the settings that decide which files a context contains. They
+// are recorded in the context metadata.
+type Options struct {
+	// Source is the resolved file source, "walk" or "git"
+	Source           string   `json:"source"`
+	IncludeUntracked bool     `json:"include_untracked,omitempty"`
+	IgnorePatterns   []string `json:"ignore_patterns"`
+	MaxFileSize      int64    `json:"max_file_size"`
+	MaxFiles         int      `json:"max_files,omitempty"`
+}
+
+// Entry is a candidate file that passed the ignore, size and extension filters.
+type Entry struct {
+	// Path uses the OS separator and is the key used in context metadata
+	Path    string
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Result holds the files a collector selected.
+type Result struct {
+	Files     map[string]string
+	Entries   map[string]Entry
+	Truncated bool
+}
+
+type Collector struct {
+	fsys       fs.FS
+	opts       Options
+	ignoreList *ignore.IgnoreList
+}
+
+// errLimit stops a walk once the file limit is reached.
+var errLimit = errors.New("file limit reached")
+
+// Open returns the working-copy source at root described by opts.
+func Open(root string, opts Options) fs.FS {
+	if opts.Source == "git" {
+		return source.GitWorktree(root, opts.IncludeUntracked)
+	}
+	return source.Dir(root)
+}
+
+// New returns a collector over fsys. Unless fsys lists its own files, its
+// top-level .gitignore is applied in addition to opts.IgnorePatterns.
+func New(fsys fs.FS, opts Options) (*Collector, error) {
+	ignoreList := ignore.New()
+	ignoreList.AddPatterns(opts.IgnorePatterns)
+
+	if _, ok := fsys.(source.Lister); !ok {
+		if err := ignoreList.LoadGitignoreFS(fsys, ".gitignore"); err != nil {
+			return nil, fmt.Errorf("error loading .gitignore: %w", err)
+		}
+	}
+
+	return &Collector{
+		fsys:       fsys,
+		opts:       opts,
+		ignoreList: ignoreList,
+	}, nil
+}
+
+// Ignored reports whether the slash-separated name is excluded by the
+// collector's ignore rules.
+func (c *Collector) Ignored(name string) bool {
+	return c.ignoreList.ShouldIgnore(name)
+}
+
+// Walk calls fn for every candidate file in the source. fn reports whether
+// it accepted the entry; the walk stops once MaxFiles entries have been
+// accepted, in which case truncated is true.
+func (c *Collector) Walk(fn func(e Entry) (bool, error)) (truncated bool, err error) {
+	accepted := 0
+	visit := func(name string, info fs.FileInfo) error {
+		// Skip files based on ignore list and other criteria
+		if c.ignoreList.ShouldIgnore(name) {
+			return nil
+		}
+
+		// Skip files based on size
+		if info.Size() > c.opts.MaxFileSize {
+			return nil
+		}
+
+		// Skip binary files based on extension
+		if IsBinaryExtension(strings.ToLower(filepath.Ext(name))) {
+			return nil
+		}
+
+		ok, err := fn(Entry{
+			Path:    filepath.FromSlash(name),
+			Name:    name,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+		if err != nil {
+			return err
+		}
+		if ok {
+			accepted++
+		}
+
+		// Check max files limit
+		if c.opts.MaxFiles > 0 && accepted >= c.opts.MaxFiles {
+			return errLimit
+		}
+		return nil
+	}
+
+	if lister, ok := c.fsys.(source.Lister); ok {
+		var names []string
+		names, err = lister.ListFiles()
+		for _, name := range names {
+			info, statErr := fs.Stat(c.fsys, name)
+			if statErr != nil {
+				continue
+			}
+			if err = visit(name, info); err != nil {
+				break
+			}
+		}
+	} else {
+		err = fs.WalkDir(c.fsys, ".", func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			// Skip directories based on ignore list
+			if d.IsDir() {
+				if c.ignoreList.ShouldIgnore(name) {
+					return fs.SkipDir
+				}
+				return nil
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			return visit(name, info)
+		})
+	}
+
+	if err == errLimit {
+		return true, nil
+	}
+	return false, err
+}
+
+// Read returns the content of e and whether it is text. Unreadable files
+// are reported as not text, so they are skipped like binary files.
+func (c *Collector) Read(e Entry) (string, bool) {
+	content, err := fs.ReadFile(c.fsys, e.Name)
+	if err != nil || !IsText(content) {
+		return "", false
+	}
+	return string(content), true
+}
+
+// Collect reads every text file the collector selects.
+func (c *Collector) Collect() (*Result, error) {
+	result := &Result{
+		Files:   make(map[string]string),
+		Entries: make(map[string]Entry),
+	}
+
+	truncated, err := c.Walk(func(e Entry) (bool, error) {
+		content, ok := c.Read(e)
+		if !ok {
+			return false, nil
+		}
+		result.Files[e.Path] = content
+		result.Entries[e.Path] = e
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.Truncated = truncated
+	return result, nil
+}
+
+// IsBinaryExtension reports whether ext (lowercase, with the dot) belongs
+// to a known binary format.
+func IsBinaryExtension(ext string) bool {
+	binaryExts := map[string]bool{
+		// Executables
+		".exe": true, ".dll": true, ".so": true, ".dylib": true,
+		// Archives
+		".zip": true, ".tar": true, ".gz": true, ".rar": true, ".7z": true,
+		// Images
+		".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".bmp": true,
+		".ico": true, ".svg": true, ".webp": true,
+		// Audio/Video
+		".mp3": true, ".wav": true, ".ogg": true, ".mp4": true, ".avi": true,
+		".mov": true, ".wmv": true, ".flv": true,
+		// Documents
+		".pdf": true, ".doc": true, ".docx": true, ".xls": true, ".xlsx": true,
+		".ppt": true, ".pptx": true,
+		// Other binary formats
+		".bin": true, ".dat": true, ".db": true, ".sqlite": true,
+	}
+	return binaryExts[ext]
+}
+
+// IsText reports whether content looks like text: valid UTF-8 without null bytes.
+func IsText(content []byte) bool {
+	if len(content) == 0 {
+		return true
+	}
+
+	// Check for null bytes which usually indicate binary data
+	for _, b := range content {
+		if b == 0 {
+			return false
+		}
+	}
+
+	// Try to detect text by checking if content is valid UTF-8
+	return utf8.Valid(content)
+}
@@ -2,9 +2,33 @@
 /*
 # .mktools.yaml - Project-specific configuration
 llm:
-  provider: anthropic  # LLM provider (anthropic, openai)
+  provider: anthropic  # LLM provider (anthropic, openai, ollama, openai-compatible)
   model: claude-3-sonnet  # Model to use
   api_key: ""  # Optional: Override API key
+  base_url: ""  # Optional: API endpoint (required for openai-compatible, e.g. http://localhost:8000/v1)
+  retry:  # Retries of rate-limited, overloaded or failing calls
+    max_attempts: 3  # Attempts per provider, including the first
+    initial_backoff: 1s  # Wait before the first retry, doubled each time
+    max_backoff: 30s  # Longest wait between attempts
+  fallback:  # Optional: Used when the primary provider keeps failing
+    provider: openai
+    model: gpt-4o
+  cache:  # Replays answers to identical requests (skip with --no-cache)
+    enabled: true
+    ttl: 24h  # How long a response is reused
+    max_size: 100MB  # Oldest responses are removed beyond this size
+  ledger:  # Records the tokens and cost of every call (see mktools usage)
+    enabled: true
+    path: ""  # Default: ~/.local/share/mktools/usage.jsonl
+  models:  # Prices in USD per million tokens, and context window sizes
+    claude-3-5-sonnet-latest:
+      input_price: 3
+      output_price: 15
+      context_window: 200000
+    llama3.1:8b:
+      input_price: 0
+      output_price: 0
+      context_window: 128000
 
 context:
   output_format: md  # Output format (md, txt)
@@ -20,29 +44,129 @@ context:
     - ".dll"
     - ".so"
   max_files_to_include: 100  # Maximum number of files to process
+  source: auto  # File source (auto, walk, git)
+  include_untracked: false  # With git source, also include untracked non-ignored files
+  sign_key: ""  # Optional: ed25519 private key (PKCS#8 PEM) used to sign generated contexts
+
+commit:
+  convention: conventional  # Commit message style (conventional, plain)
+  max_subject_length: 72  # Longest allowed subject line
+  instructions: ""  # Optional: Extra guidance, e.g. "Reference the Jira ticket from the branch name"
+
+review:
+  rubric:  # What the reviewer looks for (replaces the default rubric)
+    - "Correctness: logic errors, off-by-one errors, nil dereferences"
+    - "Security: injection, secrets in code, unsafe file handling"
+    - "Our services must log errors with the request ID"
+  fail_on: error  # Optional: Exit non-zero on findings of this severity or worse (error, warning, note)
+
+prompts:
+  dirs:  # Optional: More directories of <name>.md templates
+    - ~/team/prompts
+  templates:  # Optional: Templates defined inline
+    summarize:
+      description: Summarize the project for a newcomer
+      template: |
+        <context>
+        {{.Context}}
+        </context>
+
+        Summarize what this project does and how it is organized.
 */
 
 package config
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
-	"reflect"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/amenophis1er/mktools/internal/home"
 	"gopkg.in/yaml.v3"
 )
 
 type LLMConfig struct {
+	Provider string          `yaml:"provider"`
+	Model    string          `yaml:"model"`
+	APIKey   string          `yaml:"api_key"`
+	BaseURL  string          `yaml:"base_url,omitempty"`
+	Fallback *FallbackConfig `yaml:"fallback,omitempty"`
+	Retry    RetryConfig     `yaml:"retry,omitempty"`
+	Cache    CacheConfig     `yaml:"cache,omitempty"`
+	Ledger   LedgerConfig    `yaml:"ledger,omitempty"`
+
+	// Models holds what mktools knows about each model: prices for the
+	// usage ledger and the size of its context window.
+	Models map[string]ModelConfig `yaml:"models,omitempty"`
+}
+
+// FallbackConfig is the provider and model used when the primary one keeps
+// failing with transient errors.
+type FallbackConfig struct {
 	Provider string `yaml:"provider"`
 	Model    string `yaml:"model"`
 	APIKey   string `yaml:"api_key"`
-	Fallback *struct {
-		Provider string `yaml:"provider"`
-		Model    string `yaml:"model"`
-		APIKey   string `yaml:"api_key"`
-	} `yaml:"fallback,omitempty"`
+	BaseURL  string `yaml:"base_url,omitempty"`
+}
+
+// RetryConfig controls retries of rate-limited, overloaded or failing LLM
+// calls. Zero values use the defaults.
+type RetryConfig struct {
+	MaxAttempts    int    `yaml:"max_attempts,omitempty"`
+	InitialBackoff string `yaml:"initial_backoff,omitempty"`
+	MaxBackoff     string `yaml:"max_backoff,omitempty"`
+}
+
+// CacheConfig controls the on-disk cache of LLM responses, which replays
+// the reply to a request that was already answered.
+type CacheConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	TTL     string `yaml:"ttl,omitempty"`
+	MaxSize string `yaml:"max_size,omitempty"`
+}
+
+// LedgerConfig controls the usage ledger, a JSON Lines file recording the
+// tokens, latency and cost of every LLM call.
+type LedgerConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Path    string `yaml:"path,omitempty"`
+}
+
+// ModelConfig describes a model. Prices are in USD per million tokens.
+type ModelConfig struct {
+	InputPrice    float64 `yaml:"input_price"`
+	OutputPrice   float64 `yaml:"output_price"`
+	ContextWindow int     `yaml:"context_window,omitempty"`
+}
+
+// Cost returns the price of a call with the given token counts.
+func (m ModelConfig) Cost(inputTokens, outputTokens int) float64 {
+	return (float64(inputTokens)*m.InputPrice + float64(outputTokens)*m.OutputPrice) / 1e6
+}
+
+// LookupModel finds the settings of a model. Versioned IDs such as
+// claude-3-5-sonnet-20241022 match the entry for their family, and an entry
+// ending in -latest matches every version.
+func (c LLMConfig) LookupModel(id string) (ModelConfig, bool) {
+	if m, ok := c.Models[id]; ok {
+		return m, true
+	}
+
+	best := ""
+	for name := range c.Models {
+		family := strings.TrimSuffix(name, "-latest")
+		if (id == family || strings.HasPrefix(id, family+"-")) && len(family) > len(strings.TrimSuffix(best, "-latest")) {
+			best = name
+		}
+	}
+	if best == "" {
+		return ModelConfig{}, false
+	}
+	return c.Models[best], true
 }
 
 type ContextConfig struct {
@@ -53,16 +177,50 @@ type ContextConfig struct {
 	IncludeFileContent   bool     `yaml:"include_file_content"`
 	ExcludeExtensions    []string `yaml:"exclude_extensions"`
 	MaxFilesToInclude    int      `yaml:"max_files_to_include"`
+	Source               string   `yaml:"source"`
+	IncludeUntracked     bool     `yaml:"include_untracked"`
+	SignKey              string   `yaml:"sign_key,omitempty"`
+}
+
+// CommitConfig shapes the messages written by "mktools commit-msg".
+type CommitConfig struct {
+	Convention       string `yaml:"convention"`
+	MaxSubjectLength int    `yaml:"max_subject_length"`
+	Instructions     string `yaml:"instructions,omitempty"`
+}
+
+// ReviewConfig shapes the reviews done by "mktools review".
+type ReviewConfig struct {
+	Rubric []string `yaml:"rubric"`
+	FailOn string   `yaml:"fail_on,omitempty"`
+}
+
+// PromptsConfig adds prompt templates to the ones in the prompts
+// directories. Templates defined here are overridden by files of the same
+// name.
+type PromptsConfig struct {
+	Dirs      []string                `yaml:"dirs,omitempty"`
+	Templates map[string]PromptConfig `yaml:"templates,omitempty"`
+}
+
+// PromptConfig is a prompt template, written with Go's text/template syntax.
+type PromptConfig struct {
+	Description string `yaml:"description,omitempty"`
+	System      string `yaml:"system,omitempty"`
+	Template    string `yaml:"template"`
 }
 
 type Config struct {
 	LLM     LLMConfig     `yaml:"llm"`
 	Context ContextConfig `yaml:"context"`
+	Commit  CommitConfig  `yaml:"commit"`
+	Review  ReviewConfig  `yaml:"review"`
+	Prompts PromptsConfig `yaml:"prompts,omitempty"`
 }
 
 func LoadGlobal() (*Config, error) {
 	config := DefaultConfig()
-	globalConfig := filepath.Join(os.Getenv("HOME"), ".config", "mktools", "config.yaml")
+	globalConfig := filepath.Join(home.Dir(), ".config", "mktools", "config.yaml")
 
 	if err := loadFromFile(globalConfig, config); err != nil {
 		if !os.IsNotExist(err) {
@@ -83,6 +241,10 @@ func LoadLocal() (*Config, error) {
 	return config, nil
 }
 
+// LoadMerged returns the global configuration with the local one decoded
+// over it, as Load does but without the environment overrides. Only the
+// keys present in the local file change, so an explicit false or zero there
+// still overrides the global value.
 func LoadMerged() (*Config, error) {
 	// Start with global config
 	config, err := LoadGlobal()
@@ -90,97 +252,119 @@ func LoadMerged() (*Config, error) {
 		return nil, fmt.Errorf("error loading global config: %w", err)
 	}
 
-	// Try to load and merge local config
-	local, err := LoadLocal()
-	if err != nil {
-		if os.IsNotExist(err) {
-			return config, nil // No local config, return global
-		}
+	if err := loadFromFile(".mktools.yaml", config); err != nil && !os.IsNotExist(err) {
 		return nil, fmt.Errorf("error loading local config: %w", err)
 	}
 
-	// Merge local into global
-	if err := mergeConfig(config, local); err != nil {
-		return nil, fmt.Errorf("error merging configs: %w", err)
-	}
-
 	return config, nil
 }
 
-func mergeConfig(dst, src *Config) error {
-	if src == nil {
-		return nil
+func Diff(global, local *Config) (string, error) {
+	var diff strings.Builder
+
+	if local == nil {
+		return "", nil
+	}
+
+	// Compare LLM config
+	if d := diffLLM(&global.LLM, &local.LLM); d != "" {
+		diff.WriteString("LLM Configuration:\n")
+		diff.WriteString(d)
 	}
 
-	dstValue := reflect.ValueOf(dst).Elem()
-	srcValue := reflect.ValueOf(src).Elem()
+	// Compare Context config
+	if d := diffContext(&global.Context, &local.Context); d != "" {
+		if diff.Len() > 0 {
+			diff.WriteString("\n")
+		}
+		diff.WriteString("Context Configuration:\n")
+		diff.WriteString(d)
+	}
 
-	for i := 0; i < dstValue.NumField(); i++ {
-		dstField := dstValue.Field(i)
-		srcField := srcValue.Field(i)
+	// Compare Review config
+	if d := diffReview(&global.Review, &local.Review); d != "" {
+		if diff.Len() > 0 {
+			diff.WriteString("\n")
+		}
+		diff.WriteString("Review Configuration:\n")
+		diff.WriteString(d)
+	}
 
-		if srcField.IsZero() {
-			continue
+	// Compare Prompts config
+	if d := diffPrompts(&global.Prompts, &local.Prompts); d != "" {
+		if diff.Len() > 0 {
+			diff.WriteString("\n")
 		}
+		diff.WriteString("Prompts Configuration:\n")
+		diff.WriteString(d)
+	}
 
-		switch dstField.Kind() {
-		case reflect.Struct:
-			if err := mergeStruct(dstField, srcField); err != nil {
-				return err
-			}
-		default:
-			dstField.Set(srcField)
+	// Compare Commit config
+	if d := diffCommit(&global.Commit, &local.Commit); d != "" {
+		if diff.Len() > 0 {
+			diff.WriteString("\n")
 		}
+		diff.WriteString("Commit Configuration:\n")
+		diff.WriteString(d)
 	}
 
-	return nil
+	return diff.String(), nil
 }
 
-func mergeStruct(dst, src reflect.Value) error {
-	for i := 0; i < dst.NumField(); i++ {
-		dstField := dst.Field(i)
-		srcField := src.Field(i)
-
-		if srcField.IsZero() {
-			continue
-		}
+func diffCommit(global, local *CommitConfig) string {
+	var diff strings.Builder
 
-		switch dstField.Kind() {
-		case reflect.Slice:
-			if !srcField.IsNil() {
-				dstField.Set(srcField)
-			}
-		default:
-			dstField.Set(srcField)
-		}
+	if local.Convention != "" && local.Convention != global.Convention {
+		diff.WriteString(fmt.Sprintf("  convention: %s -> %s\n", global.Convention, local.Convention))
+	}
+	if local.MaxSubjectLength != 0 && local.MaxSubjectLength != global.MaxSubjectLength {
+		diff.WriteString(fmt.Sprintf("  max_subject_length: %d -> %d\n", global.MaxSubjectLength, local.MaxSubjectLength))
+	}
+	if local.Instructions != "" && local.Instructions != global.Instructions {
+		diff.WriteString("  instructions: (changed)\n")
 	}
 
-	return nil
+	return diff.String()
 }
 
-func Diff(global, local *Config) (string, error) {
+func diffReview(global, local *ReviewConfig) string {
 	var diff strings.Builder
 
-	if local == nil {
-		return "", nil
+	if len(local.Rubric) > 0 {
+		diff.WriteString("  rubric: (replaced) [\n    ")
+		diff.WriteString(strings.Join(local.Rubric, "\n    "))
+		diff.WriteString("\n  ]\n")
+	}
+	if local.FailOn != "" && local.FailOn != global.FailOn {
+		diff.WriteString(fmt.Sprintf("  fail_on: %s -> %s\n", global.FailOn, local.FailOn))
 	}
 
-	// Compare LLM config
-	if d := diffLLM(&global.LLM, &local.LLM); d != "" {
-		diff.WriteString("LLM Configuration:\n")
-		diff.WriteString(d)
+	return diff.String()
+}
+
+func diffPrompts(global, local *PromptsConfig) string {
+	var diff strings.Builder
+
+	if len(local.Dirs) > 0 {
+		diff.WriteString("  dirs: (replaced) [\n    ")
+		diff.WriteString(strings.Join(local.Dirs, "\n    "))
+		diff.WriteString("\n  ]\n")
 	}
 
-	// Compare Context config
-	if d := diffContext(&global.Context, &local.Context); d != "" {
-		if diff.Len() > 0 {
-			diff.WriteString("\n")
+	names := make([]string, 0, len(local.Templates))
+	for name := range local.Templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if g, ok := global.Templates[name]; !ok {
+			diff.WriteString(fmt.Sprintf("  + template %s\n", name))
+		} else if g != local.Templates[name] {
+			diff.WriteString(fmt.Sprintf("  ~ template %s\n", name))
 		}
-		diff.WriteString("Context Configuration:\n")
-		diff.WriteString(d)
 	}
 
-	return diff.String(), nil
+	return diff.String()
 }
 
 func diffLLM(global, local *LLMConfig) string {
@@ -192,6 +376,48 @@ func diffLLM(global, local *LLMConfig) string {
 	if local.Model != "" && local.Model != global.Model {
 		diff.WriteString(fmt.Sprintf("  model: %s -> %s\n", global.Model, local.Model))
 	}
+	if local.BaseURL != "" && local.BaseURL != global.BaseURL {
+		diff.WriteString(fmt.Sprintf("  base_url: %s -> %s\n", global.BaseURL, local.BaseURL))
+	}
+	if local.Fallback != nil && local.Fallback.Provider != "" {
+		from := "none"
+		if global.Fallback != nil && global.Fallback.Provider != "" {
+			from = global.Fallback.Provider + "/" + global.Fallback.Model
+		}
+		if to := local.Fallback.Provider + "/" + local.Fallback.Model; to != from {
+			diff.WriteString(fmt.Sprintf("  fallback: %s -> %s\n", from, to))
+		}
+	}
+	if local.Retry.MaxAttempts != 0 && local.Retry.MaxAttempts != global.Retry.MaxAttempts {
+		diff.WriteString(fmt.Sprintf("  retry.max_attempts: %d -> %d\n", global.Retry.MaxAttempts, local.Retry.MaxAttempts))
+	}
+	if local.Retry.InitialBackoff != "" && local.Retry.InitialBackoff != global.Retry.InitialBackoff {
+		diff.WriteString(fmt.Sprintf("  retry.initial_backoff: %s -> %s\n", global.Retry.InitialBackoff, local.Retry.InitialBackoff))
+	}
+	if local.Retry.MaxBackoff != "" && local.Retry.MaxBackoff != global.Retry.MaxBackoff {
+		diff.WriteString(fmt.Sprintf("  retry.max_backoff: %s -> %s\n", global.Retry.MaxBackoff, local.Retry.MaxBackoff))
+	}
+	if local.Cache.TTL != "" && local.Cache.TTL != global.Cache.TTL {
+		diff.WriteString(fmt.Sprintf("  cache.ttl: %s -> %s\n", global.Cache.TTL, local.Cache.TTL))
+	}
+	if local.Cache.MaxSize != "" && local.Cache.MaxSize != global.Cache.MaxSize {
+		diff.WriteString(fmt.Sprintf("  cache.max_size: %s -> %s\n", global.Cache.MaxSize, local.Cache.MaxSize))
+	}
+	if local.Ledger.Path != "" && local.Ledger.Path != global.Ledger.Path {
+		diff.WriteString(fmt.Sprintf("  ledger.path: %s -> %s\n", global.Ledger.Path, local.Ledger.Path))
+	}
+	models := make([]string, 0, len(local.Models))
+	for name := range local.Models {
+		models = append(models, name)
+	}
+	sort.Strings(models)
+	for _, name := range models {
+		if g, ok := global.Models[name]; !ok {
+			diff.WriteString(fmt.Sprintf("  + model %s\n", name))
+		} else if g != local.Models[name] {
+			diff.WriteString(fmt.Sprintf("  ~ model %s\n", name))
+		}
+	}
 	// Skip API key comparison for security
 
 	return diff.String()
@@ -209,6 +435,15 @@ func diffContext(global, local *ContextConfig) string {
 	if local.MaxFilesToInclude != 0 && local.MaxFilesToInclude != global.MaxFilesToInclude {
 		diff.WriteString(fmt.Sprintf("  max_files_to_include: %d -> %d\n", global.MaxFilesToInclude, local.MaxFilesToInclude))
 	}
+	if local.Source != "" && local.Source != global.Source {
+		diff.WriteString(fmt.Sprintf("  source: %s -> %s\n", global.Source, local.Source))
+	}
+	if local.IncludeUntracked && !global.IncludeUntracked {
+		diff.WriteString("  include_untracked: false -> true\n")
+	}
+	if local.SignKey != "" && local.SignKey != global.SignKey {
+		diff.WriteString(fmt.Sprintf("  sign_key: %s -> %s\n", global.SignKey, local.SignKey))
+	}
 
 	// Compare slices only if they're not empty in local config
 	if len(local.IgnorePatterns) > 0 {
@@ -231,6 +466,28 @@ func DefaultConfig() *Config {
 		LLM: LLMConfig{
 			Provider: "anthropic",
 			Model:    "claude-3-sonnet",
+			Retry: RetryConfig{
+				MaxAttempts:    3,
+				InitialBackoff: "1s",
+				MaxBackoff:     "30s",
+			},
+			Cache: CacheConfig{
+				Enabled: true,
+				TTL:     "24h",
+				MaxSize: "100MB",
+			},
+			Ledger: LedgerConfig{
+				Enabled: true,
+			},
+			Models: map[string]ModelConfig{
+				"claude-3-sonnet":          {InputPrice: 3, OutputPrice: 15, ContextWindow: 200000},
+				"claude-3-opus-latest":     {InputPrice: 15, OutputPrice: 75, ContextWindow: 200000},
+				"claude-3-haiku":           {InputPrice: 0.25, OutputPrice: 1.25, ContextWindow: 200000},
+				"claude-3-5-sonnet-latest": {InputPrice: 3, OutputPrice: 15, ContextWindow: 200000},
+				"claude-3-5-haiku-latest":  {InputPrice: 0.8, OutputPrice: 4, ContextWindow: 200000},
+				"gpt-4o":                   {InputPrice: 2.5, OutputPrice: 10, ContextWindow: 128000},
+				"gpt-4o-mini":              {InputPrice: 0.15, OutputPrice: 0.6, ContextWindow: 128000},
+			},
 		},
 		Context: ContextConfig{
 			OutputFormat:         "md",
@@ -238,6 +495,7 @@ func DefaultConfig() *Config {
 			IncludeFileContent:   true,
 			MaxFileSize:          "1MB",
 			MaxFilesToInclude:    100,
+			Source:               "auto",
 			IgnorePatterns: []string{
 				".git/",
 				"node_modules/",
@@ -265,21 +523,43 @@ func DefaultConfig() *Config {
 				".pdf", ".doc", ".docx", ".xls", ".xlsx",
 			},
 		},
+		Commit: CommitConfig{
+			Convention:       "conventional",
+			MaxSubjectLength: 72,
+		},
+		Review: ReviewConfig{
+			Rubric: []string{
+				"Correctness: logic errors, edge cases, off-by-one errors, nil or null dereferences",
+				"Error handling: ignored errors, missing context, resources not released",
+				"Security: injection, unsafe input handling, secrets or credentials in code",
+				"Concurrency: data races, deadlocks, leaked goroutines or threads",
+				"Performance: needless work in hot paths, unbounded memory use",
+				"Maintainability: unclear names, duplicated logic, missing or misleading comments",
+				"Tests: changed behavior without tests",
+			},
+		},
 	}
 }
 
 // Load loads the configuration from files and environment variables
 func Load() (*Config, error) {
+	return LoadDir(".")
+}
+
+// LoadDir loads the configuration like Load, with the project configuration
+// taken from dir instead of the current directory. Servers use it to apply
+// the settings of the project they serve.
+func LoadDir(dir string) (*Config, error) {
 	config := DefaultConfig()
 
 	// Load from global config file
-	globalConfig := filepath.Join(os.Getenv("HOME"), ".config", "mktools", "config.yaml")
+	globalConfig := filepath.Join(home.Dir(), ".config", "mktools", "config.yaml")
 	if err := loadFromFile(globalConfig, config); err != nil && !os.IsNotExist(err) {
 		return nil, fmt.Errorf("error loading global config: %w", err)
 	}
 
 	// Load from local config file (overrides global)
-	if err := loadFromFile(".mktools.yaml", config); err != nil && !os.IsNotExist(err) {
+	if err := loadFromFile(filepath.Join(dir, ".mktools.yaml"), config); err != nil && !os.IsNotExist(err) {
 		return nil, fmt.Errorf("error loading local config: %w", err)
 	}
 
@@ -307,6 +587,32 @@ func (c *Config) ToString() (string, error) {
 	return string(data), nil
 }
 
+// WithoutSecrets returns a copy of the config with the API keys cleared,
+// for handing to programs that have no business with them.
+func (c *Config) WithoutSecrets() *Config {
+	clean := *c
+	clean.LLM.APIKey = ""
+	if c.LLM.Fallback != nil {
+		fallback := *c.LLM.Fallback
+		fallback.APIKey = ""
+		clean.LLM.Fallback = &fallback
+	}
+	return &clean
+}
+
+// ToJSON returns the config as JSON, with the same keys as the YAML files.
+func (c *Config) ToJSON() ([]byte, error) {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	var tree map[string]any
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	return json.Marshal(tree)
+}
+
 func applyEnvironmentVariables(config *Config) {
 	if provider := os.Getenv("MKTOOLS_LLM_PROVIDER"); provider != "" {
 		config.LLM.Provider = provider
@@ -325,6 +631,17 @@ func applyEnvironmentVariables(config *Config) {
 	if openaiKey := os.Getenv("OPENAI_API_KEY"); openaiKey != "" && config.LLM.Provider == "openai" {
 		config.LLM.APIKey = openaiKey
 	}
+
+	// The fallback provider only takes its own provider's key, and only
+	// when none is configured
+	if fb := config.LLM.Fallback; fb != nil && fb.APIKey == "" {
+		switch fb.Provider {
+		case "anthropic":
+			fb.APIKey = os.Getenv("ANTHROPIC_API_KEY")
+		case "openai":
+			fb.APIKey = os.Getenv("OPENAI_API_KEY")
+		}
+	}
 }
 
 func validateConfig(config *Config) error {
@@ -334,6 +651,39 @@ func validateConfig(config *Config) error {
 	if config.LLM.Model == "" {
 		return fmt.Errorf("LLM model is required")
 	}
+	if err := validateProvider(config.LLM.Provider, config.LLM.BaseURL); err != nil {
+		return err
+	}
+	if fb := config.LLM.Fallback; fb != nil && fb.Provider != "" {
+		if err := validateProvider(fb.Provider, fb.BaseURL); err != nil {
+			return fmt.Errorf("fallback: %w", err)
+		}
+	}
+
+	if fb := config.LLM.Fallback; fb != nil && fb.Provider != "" && fb.Model == "" {
+		return fmt.Errorf("LLM fallback model is required")
+	}
+	if config.LLM.Retry.MaxAttempts < 0 {
+		return fmt.Errorf("invalid retry max_attempts: %d", config.LLM.Retry.MaxAttempts)
+	}
+	for _, d := range []string{config.LLM.Retry.InitialBackoff, config.LLM.Retry.MaxBackoff} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(d); err != nil {
+			return fmt.Errorf("invalid retry backoff: %w", err)
+		}
+	}
+	for name, m := range config.LLM.Models {
+		if m.InputPrice < 0 || m.OutputPrice < 0 || m.ContextWindow < 0 {
+			return fmt.Errorf("invalid settings for model %s: prices and context window can't be negative", name)
+		}
+	}
+	if config.LLM.Cache.TTL != "" {
+		if _, err := time.ParseDuration(config.LLM.Cache.TTL); err != nil {
+			return fmt.Errorf("invalid cache ttl: %w", err)
+		}
+	}
 
 	// Don't validate API key during initialization
 	// API key can be set later via environment variable
@@ -346,9 +696,59 @@ func validateConfig(config *Config) error {
 		return fmt.Errorf("invalid output format: %s", config.Context.OutputFormat)
 	}
 
+	// Validate file source
+	switch config.Context.Source {
+	case "", "auto", "walk", "git":
+		// valid
+	default:
+		return fmt.Errorf("invalid context source: %s (must be auto, walk or git)", config.Context.Source)
+	}
+
+	// Validate commit message settings
+	switch config.Commit.Convention {
+	case "", "conventional", "plain":
+		// valid
+	default:
+		return fmt.Errorf("invalid commit convention: %s (must be conventional or plain)", config.Commit.Convention)
+	}
+	if config.Commit.MaxSubjectLength < 0 {
+		return fmt.Errorf("invalid commit max_subject_length: %d", config.Commit.MaxSubjectLength)
+	}
+
+	// Validate prompt templates
+	for name, prompt := range config.Prompts.Templates {
+		if strings.TrimSpace(prompt.Template) == "" {
+			return fmt.Errorf("prompt template %s is empty", name)
+		}
+	}
+
+	// Validate review settings
+	switch config.Review.FailOn {
+	case "", "error", "warning", "note":
+		// valid
+	default:
+		return fmt.Errorf("invalid review fail_on: %s (must be error, warning or note)", config.Review.FailOn)
+	}
+
 	return nil
 }
 
+// validateProvider checks an LLM provider name. Self-hosted providers need
+// no API key, but an OpenAI-compatible server has no default address.
+func validateProvider(provider, baseURL string) error {
+	switch provider {
+	case "anthropic", "openai", "ollama":
+		return nil
+	case "openai-compatible":
+		if baseURL == "" {
+			return fmt.Errorf("LLM provider openai-compatible requires base_url")
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid LLM provider: %s (must be anthropic, openai, ollama or openai-compatible)", provider)
+	}
+}
+
 // Save saves the current configuration to a file
 func (c *Config) Save(path string) error {
 	// Ensure directory exists
@@ -0,0 +1,262 @@
+// Package contextfile parses the documents produced by "mktools context" back
+// into their metadata and per-file sections.
+package contextfile
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/amenophis1er/mktools/internal/metadata"
+)
+
+// ContentsHeading starts the file contents part of a context document.
+const ContentsHeading = "# File Contents"
+
+// File is a single "## path" section of a context document.
+type File struct {
+	Path     string
+	Language string
+	Content  string
+}
+
+// Document is a parsed context document.
+type Document struct {
+	Metadata *metadata.Metadata
+	Files    []File
+}
+
+// Parse parses a context document. Metadata is optional so that documents
+// with a damaged or stripped header can still be read; it is nil when absent.
+func Parse(content string) (*Document, error) {
+	doc := &Document{}
+
+	if strings.Contains(content, metadata.MetadataMarker) {
+		meta, err := metadata.ParseFromContent(content)
+		if err != nil {
+			return nil, err
+		}
+		doc.Metadata = meta
+		if end := strings.Index(content, metadata.MetadataEndMarker); end != -1 {
+			content = content[end+len(metadata.MetadataEndMarker):]
+		}
+	}
+
+	// Only the contents part has file sections; the structure part is a
+	// single fenced list of paths.
+	if i := strings.Index(content, "\n"+ContentsHeading+"\n"); i != -1 {
+		content = content[i+len(ContentsHeading)+2:]
+	} else if strings.HasPrefix(content, ContentsHeading+"\n") {
+		content = content[len(ContentsHeading)+1:]
+	} else if doc.Metadata != nil {
+		return doc, nil
+	}
+
+	doc.Files = parseSections(content, true)
+	return doc, nil
+}
+
+// File returns the section for path, if present.
+func (d *Document) File(path string) (File, bool) {
+	for _, f := range d.Files {
+		if f.Path == path {
+			return f, true
+		}
+	}
+	return File{}, false
+}
+
+// ParseSections extracts every "## path" heading that is immediately
+// followed by a fenced code block. It is lenient about the heading level and
+// backticks around the path, so it reads model replies that imitate the
+// context format, with prose between the sections.
+func ParseSections(text string) []File {
+	return parseSections(text, false)
+}
+
+// parseSections implements Parse and ParseSections. In documents generated
+// by mktools a section always runs until the next section, which resolves
+// ambiguous closing fences in older contexts; replies may have prose after a
+// block, so there fences are matched by nesting instead.
+func parseSections(text string, document bool) []File {
+	lines := strings.Split(text, "\n")
+
+	var files []File
+	for i := 0; i < len(lines); i++ {
+		path, ok := headingPath(lines[i])
+		if !ok {
+			continue
+		}
+
+		// The fence must follow the heading, separated only by blank lines.
+		j := i + 1
+		for j < len(lines) && strings.TrimSpace(lines[j]) == "" {
+			j++
+		}
+		if j >= len(lines) {
+			break
+		}
+		fence, language, ok := openingFence(lines[j])
+		if !ok {
+			continue
+		}
+
+		var end int
+		if document {
+			end = closingFence(lines, j+1, fence)
+		} else {
+			end = nestedClosingFence(lines, j+1, fence)
+		}
+		if end == -1 {
+			continue
+		}
+
+		files = append(files, File{
+			Path:     path,
+			Language: language,
+			Content:  strings.Join(lines[j+1:end], "\n"),
+		})
+		i = end
+	}
+
+	return files
+}
+
+// Fence returns a backtick fence long enough to enclose content: one
+// backtick longer than the longest run inside it, and at least three.
+func Fence(content string) string {
+	longest, run := 0, 0
+	for _, r := range content {
+		if r == '`' {
+			run++
+			if run > longest {
+				longest = run
+			}
+		} else {
+			run = 0
+		}
+	}
+
+	n := 3
+	if longest >= n {
+		n = longest + 1
+	}
+	return strings.Repeat("`", n)
+}
+
+// Section renders the "## path" section for a file the way context
+// documents do, fenced so it can be parsed back unambiguously.
+func Section(path, content string) string {
+	fence := Fence(content)
+	return fmt.Sprintf("## %s\n\n%s%s\n%s\n%s\n\n", path, fence, Language(path), content, fence)
+}
+
+// Language returns the fence info string used for path.
+func Language(path string) string {
+	return strings.TrimPrefix(filepath.Ext(path), ".")
+}
+
+// ValidatePath rejects section paths that would escape a target directory
+// when written to disk.
+func ValidatePath(path string) error {
+	clean := filepath.Clean(filepath.FromSlash(path))
+	if path == "" || filepath.IsAbs(clean) || clean == ".." ||
+		strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("unsafe path in context: %q", path)
+	}
+	return nil
+}
+
+func headingPath(line string) (string, bool) {
+	line = strings.TrimRight(line, "\r")
+	var rest string
+	switch {
+	case strings.HasPrefix(line, "## "):
+		rest = line[3:]
+	case strings.HasPrefix(line, "### "):
+		rest = line[4:]
+	default:
+		return "", false
+	}
+
+	path := strings.Trim(strings.TrimSpace(rest), "`*")
+	if path == "" || strings.ContainsAny(path, " \t") {
+		return "", false
+	}
+	return path, true
+}
+
+func openingFence(line string) (fence, language string, ok bool) {
+	line = strings.TrimRight(line, "\r")
+	n := 0
+	for n < len(line) && line[n] == '`' {
+		n++
+	}
+	if n < 3 {
+		return "", "", false
+	}
+	return line[:n], strings.TrimSpace(line[n:]), true
+}
+
+// closingFence finds the line that closes a block opened with fence. Older
+// contexts always used three backticks even when the content had its own
+// fences, so a candidate only counts when it is followed by the next file
+// section or the end of the document; the first candidate is the fallback.
+func closingFence(lines []string, start int, fence string) int {
+	first := -1
+	for i := start; i < len(lines); i++ {
+		if strings.TrimRight(lines[i], "\r") != fence {
+			continue
+		}
+		if first == -1 {
+			first = i
+		}
+
+		next := i + 1
+		for next < len(lines) && strings.TrimSpace(lines[next]) == "" {
+			next++
+		}
+		if next == len(lines) || isSectionStart(lines, next) {
+			return i
+		}
+	}
+	return first
+}
+
+// nestedClosingFence finds the line that closes a block opened with fence,
+// treating fences with an info string inside it as nested blocks.
+func nestedClosingFence(lines []string, start int, fence string) int {
+	depth := 0
+	for i := start; i < len(lines); i++ {
+		inner, language, ok := openingFence(lines[i])
+		if !ok || len(inner) < len(fence) {
+			continue
+		}
+		switch {
+		case language != "":
+			depth++
+		case depth > 0:
+			depth--
+		case inner == fence:
+			return i
+		}
+	}
+	return -1
+}
+
+// isSectionStart reports whether lines[i] is a file heading followed by a
+// fenced block.
+func isSectionStart(lines []string, i int) bool {
+	if _, ok := headingPath(lines[i]); !ok {
+		return false
+	}
+	j := i + 1
+	for j < len(lines) && strings.TrimSpace(lines[j]) == "" {
+		j++
+	}
+	if j == len(lines) {
+		return false
+	}
+	_, _, ok := openingFence(lines[j])
+	return ok
+}
@@ -0,0 +1,269 @@
+// Package diff computes line-based diffs between texts and renders them in
+// unified format.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Kind is the type of a single edit.
+type Kind int
+
+const (
+	Equal Kind = iota
+	Insert
+	Delete
+)
+
+// Edit is one line of an edit script. Line keeps its trailing newline, if any.
+type Edit struct {
+	Kind Kind
+	Line string
+}
+
+// SplitLines splits text into lines that keep their "\n" terminators. A final
+// line without a terminator is returned as is.
+func SplitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Lines returns the shortest edit script turning a into b. It uses the
+// linear-space refinement of Myers' O(ND) algorithm: the middle of the edit
+// path is found by searching from both ends at once, and the texts before
+// and after it are diffed recursively, so memory stays proportional to the
+// length of the texts however much they differ.
+func Lines(a, b []string) []Edit {
+	return appendEdits(nil, a, b)
+}
+
+// appendEdits appends the edit script turning a into b to edits.
+func appendEdits(edits []Edit, a, b []string) []Edit {
+	// Lines shared at the start and end are left out of the search
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	edits = appendKind(edits, Equal, a[:prefix])
+	a, b = a[prefix:], b[prefix:]
+
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	common := a[len(a)-suffix:]
+	a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+
+	x, y := 0, 0
+	if len(a) > 0 && len(b) > 0 {
+		x, y = middle(a, b)
+	}
+	if (x == 0 && y == 0) || (x == len(a) && y == len(b)) {
+		// One text is empty, or nothing could be matched
+		edits = appendKind(edits, Delete, a)
+		edits = appendKind(edits, Insert, b)
+	} else {
+		edits = appendEdits(edits, a[:x], b[:y])
+		edits = appendEdits(edits, a[x:], b[y:])
+	}
+
+	return appendKind(edits, Equal, common)
+}
+
+func appendKind(edits []Edit, kind Kind, lines []string) []Edit {
+	for _, line := range lines {
+		edits = append(edits, Edit{Kind: kind, Line: line})
+	}
+	return edits
+}
+
+// middle returns a point on a shortest edit path from a to b, near its
+// middle. Neither text may be empty, and they must differ in their first
+// and last lines.
+func middle(a, b []string) (int, int) {
+	n, m := len(a), len(b)
+	maxD := (n + m + 1) / 2
+	offset := maxD
+
+	// forward[offset+k] is the furthest x reached on diagonal k = x-y from
+	// the start; backward[offset+k] the same from the end, with x and y
+	// counted backwards. -1 marks diagonals not reached yet.
+	forward := make([]int, 2*maxD+2)
+	backward := make([]int, 2*maxD+2)
+	for i := range forward {
+		forward[i], backward[i] = -1, -1
+	}
+	forward[offset+1], backward[offset+1] = 0, 0
+
+	// The paths meet on a forward move when the difference in lengths is
+	// odd, and on a backward move when it is even
+	delta := n - m
+	odd := delta%2 != 0
+
+	// Diagonals that left the edit graph are trimmed from the search
+	var fStart, fEnd, bStart, bEnd int
+	for d := 0; d < maxD; d++ {
+		for k := -d + fStart; k <= d-fEnd; k += 2 {
+			i := offset + k
+			var x int
+			if k == -d || (k != d && forward[i-1] < forward[i+1]) {
+				x = forward[i+1]
+			} else {
+				x = forward[i-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			forward[i] = x
+
+			switch {
+			case x > n:
+				fEnd += 2
+			case y > m:
+				fStart += 2
+			case odd:
+				j := offset + delta - k
+				if j >= 0 && j < len(backward) && backward[j] != -1 && x >= n-backward[j] {
+					return x, y
+				}
+			}
+		}
+
+		for k := -d + bStart; k <= d-bEnd; k += 2 {
+			i := offset + k
+			var x int
+			if k == -d || (k != d && backward[i-1] < backward[i+1]) {
+				x = backward[i+1]
+			} else {
+				x = backward[i-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[n-x-1] == b[m-y-1] {
+				x++
+				y++
+			}
+			backward[i] = x
+
+			switch {
+			case x > n:
+				bEnd += 2
+			case y > m:
+				bStart += 2
+			case !odd:
+				j := offset + delta - k
+				if j >= 0 && j < len(forward) && forward[j] != -1 && forward[j] >= n-x {
+					return forward[j], forward[j] - (delta - k)
+				}
+			}
+		}
+	}
+
+	return 0, 0
+}
+
+// Unified renders the differences between a and b as a unified diff with
+// three lines of context. It returns "" when the texts are equal.
+func Unified(fromName, toName, a, b string) string {
+	edits := Lines(SplitLines(a), SplitLines(b))
+
+	const context = 3
+	var out strings.Builder
+	for start := 0; start < len(edits); {
+		// Find the next change
+		for start < len(edits) && edits[start].Kind == Equal {
+			start++
+		}
+		if start == len(edits) {
+			break
+		}
+
+		// Extend the hunk while changes are within 2*context lines
+		end := start
+		for i := start; i < len(edits); i++ {
+			if edits[i].Kind != Equal {
+				end = i + 1
+				continue
+			}
+			if i-end >= 2*context {
+				break
+			}
+		}
+
+		from := start - context
+		if from < 0 {
+			from = 0
+		}
+		to := end + context
+		if to > len(edits) {
+			to = len(edits)
+		}
+
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		writeHunk(&out, edits, from, to)
+		start = to
+	}
+
+	return out.String()
+}
+
+func writeHunk(out *strings.Builder, edits []Edit, from, to int) {
+	// Line numbers are 1-based positions of the hunk in each text
+	oldStart, newStart := 1, 1
+	for _, e := range edits[:from] {
+		if e.Kind != Insert {
+			oldStart++
+		}
+		if e.Kind != Delete {
+			newStart++
+		}
+	}
+
+	var oldLines, newLines int
+	var body strings.Builder
+	for _, e := range edits[from:to] {
+		prefix := " "
+		switch e.Kind {
+		case Equal:
+			oldLines++
+			newLines++
+		case Delete:
+			prefix = "-"
+			oldLines++
+		case Insert:
+			prefix = "+"
+			newLines++
+		}
+		body.WriteString(prefix + e.Line)
+		if !strings.HasSuffix(e.Line, "\n") {
+			body.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+
+	// An empty range starts at the line before it
+	if oldLines == 0 {
+		oldStart--
+	}
+	if newLines == 0 {
+		newStart--
+	}
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(oldStart, oldLines), hunkRange(newStart, newLines))
+	out.WriteString(body.String())
+}
+
+func hunkRange(start, lines int) string {
+	if lines == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, lines)
+}
@@ -0,0 +1,111 @@
+package diff
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// apply rebuilds both texts from an edit script.
+func apply(edits []Edit) (string, string) {
+	var a, b strings.Builder
+	for _, e := range edits {
+		if e.Kind != Insert {
+			a.WriteString(e.Line)
+		}
+		if e.Kind != Delete {
+			b.WriteString(e.Line)
+		}
+	}
+	return a.String(), b.String()
+}
+
+func changes(edits []Edit) int {
+	n := 0
+	for _, e := range edits {
+		if e.Kind != Equal {
+			n++
+		}
+	}
+	return n
+}
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		a, b    string
+		changes int
+	}{
+		{a: "", b: "", changes: 0},
+		{a: "", b: "a\nb\n", changes: 2},
+		{a: "a\nb\n", b: "", changes: 2},
+		{a: "a\nb\nc\n", b: "a\nb\nc\n", changes: 0},
+		{a: "a\nb\nc\n", b: "a\nx\nc\n", changes: 2},
+		{a: "a\nb\nc\na\nb\nb\na\n", b: "c\nb\na\nb\na\nc\n", changes: 5},
+		{a: "x\na\nb\n", b: "a\nb\ny\n", changes: 2},
+		{a: "a\nb", b: "a\nb\n", changes: 2},
+	}
+	for _, tt := range tests {
+		edits := Lines(SplitLines(tt.a), SplitLines(tt.b))
+		if a, b := apply(edits); a != tt.a || b != tt.b {
+			t.Errorf("Lines(%q, %q) rebuilds %q, %q", tt.a, tt.b, a, b)
+		}
+		if n := changes(edits); n != tt.changes {
+			t.Errorf("Lines(%q, %q) has %d changes, want %d", tt.a, tt.b, n, tt.changes)
+		}
+	}
+}
+
+func TestLinesRewrite(t *testing.T) {
+	var a, b strings.Builder
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(&a, "old line %d\n", i)
+		fmt.Fprintf(&b, "new line %d\n", i)
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	edits := Lines(SplitLines(a.String()), SplitLines(b.String()))
+	runtime.ReadMemStats(&after)
+
+	if gotA, gotB := apply(edits); gotA != a.String() || gotB != b.String() {
+		t.Fatal("edit script doesn't rebuild the texts")
+	}
+	if n := changes(edits); n != 10000 {
+		t.Errorf("changes = %d, want 10000", n)
+	}
+	// Memory grows with the length of the texts, not with the number of
+	// differences times that length
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 32<<20 {
+		t.Errorf("diffing two 5000-line texts allocated %d MB", alloc>>20)
+	}
+}
+
+func TestUnified(t *testing.T) {
+	a := "one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\n"
+	b := "one\ntwo\nthree\nfour\nFIVE\nsix\nseven\neight\nnine\nten\neleven"
+
+	// The changes are less than six lines apart, so they share a hunk
+	want := `--- a/n.txt
++++ b/n.txt
+@@ -2,9 +2,10 @@
+ two
+ three
+ four
+-five
++FIVE
+ six
+ seven
+ eight
+ nine
+ ten
++eleven
+\ No newline at end of file
+`
+	if got := Unified("a/n.txt", "b/n.txt", a, b); got != want {
+		t.Errorf("Unified =\n%s\nwant\n%s", got, want)
+	}
+	if got := Unified("a", "b", a, a); got != "" {
+		t.Errorf("Unified of equal texts = %q, want empty", got)
+	}
+}
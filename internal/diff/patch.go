@@ -0,0 +1,219 @@
+package diff
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DevNull is the path unified diffs use for a missing side.
+const DevNull = "/dev/null"
+
+// FilePatch is the set of hunks a unified diff applies to one file.
+type FilePatch struct {
+	OldPath string
+	NewPath string
+	Hunks   []Hunk
+}
+
+// Hunk is one "@@" section of a unified diff. Lines keep their ' ', '-' or
+// '+' prefix and have no trailing newline.
+type Hunk struct {
+	OldStart int
+	Lines    []string
+}
+
+// IsNew reports whether the patch creates a file.
+func (p *FilePatch) IsNew() bool { return p.OldPath == DevNull }
+
+// IsDelete reports whether the patch removes a file.
+func (p *FilePatch) IsDelete() bool { return p.NewPath == DevNull }
+
+// Path returns the path of the file the patch applies to.
+func (p *FilePatch) Path() string {
+	if p.IsDelete() {
+		return p.OldPath
+	}
+	return p.NewPath
+}
+
+// ParsePatches extracts every unified diff from text, which may also contain
+// prose and code fences, as in a model's reply. "a/" and "b/" prefixes are
+// removed from paths.
+func ParsePatches(text string) []*FilePatch {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+
+	var patches []*FilePatch
+	var current *FilePatch
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		switch {
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			current = &FilePatch{
+				OldPath: patchPath(line[4:], "a/"),
+				NewPath: patchPath(lines[i+1][4:], "b/"),
+			}
+			patches = append(patches, current)
+			i++
+
+		case strings.HasPrefix(line, "@@ ") && current != nil:
+			oldStart, err := parseHunkHeader(line)
+			if err != nil {
+				continue
+			}
+			hunk := Hunk{OldStart: oldStart}
+			for i+1 < len(lines) && isHunkLine(lines, i+1) {
+				i++
+				hunk.Lines = append(hunk.Lines, lines[i])
+			}
+			current.Hunks = append(current.Hunks, hunk)
+		}
+	}
+
+	// Drop headers that had no hunks, such as "---" rules in prose
+	valid := patches[:0]
+	for _, p := range patches {
+		if len(p.Hunks) > 0 {
+			valid = append(valid, p)
+		}
+	}
+	return valid
+}
+
+// Apply applies the patch to the current content of its file. Hunks are
+// located by their context rather than trusted line numbers, since diffs
+// written by hand or by a model are often off by a few lines.
+func (p *FilePatch) Apply(content string) (string, error) {
+	if p.IsDelete() {
+		return "", nil
+	}
+
+	trailingNewline := content == "" || strings.HasSuffix(content, "\n")
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	if content == "" {
+		lines = nil
+	}
+
+	offset := 0
+	for n, h := range p.Hunks {
+		var old, replacement []string
+		var prev byte
+		for _, line := range h.Lines {
+			if line == "" {
+				// Blank context lines often lose their leading space
+				line = " "
+			}
+			switch line[0] {
+			case ' ':
+				old = append(old, line[1:])
+				replacement = append(replacement, line[1:])
+			case '-':
+				old = append(old, line[1:])
+			case '+':
+				replacement = append(replacement, line[1:])
+			case '\\':
+				// "\ No newline at end of file" applies to the line before it
+				trailingNewline = prev == '-'
+			}
+			prev = line[0]
+		}
+
+		at := findBlock(lines, old, h.OldStart-1+offset)
+		if at == -1 {
+			return "", fmt.Errorf("hunk %d of %s does not apply", n+1, p.Path())
+		}
+
+		updated := make([]string, 0, len(lines)-len(old)+len(replacement))
+		updated = append(updated, lines[:at]...)
+		updated = append(updated, replacement...)
+		updated = append(updated, lines[at+len(old):]...)
+		lines = updated
+		offset += len(replacement) - len(old)
+	}
+
+	result := strings.Join(lines, "\n")
+	if trailingNewline && len(lines) > 0 {
+		result += "\n"
+	}
+	return result, nil
+}
+
+// findBlock returns the index of block in lines closest to hint, first
+// comparing exactly and then ignoring surrounding whitespace.
+func findBlock(lines, block []string, hint int) int {
+	if len(block) == 0 {
+		if hint < 0 {
+			return 0
+		}
+		if hint > len(lines) {
+			return len(lines)
+		}
+		return hint
+	}
+
+	for _, equal := range []func(a, b string) bool{
+		func(a, b string) bool { return a == b },
+		func(a, b string) bool { return strings.TrimSpace(a) == strings.TrimSpace(b) },
+	} {
+		matches := func(at int) bool {
+			if at < 0 || at+len(block) > len(lines) {
+				return false
+			}
+			for i, line := range block {
+				if !equal(lines[at+i], line) {
+					return false
+				}
+			}
+			return true
+		}
+
+		for delta := 0; delta <= len(lines); delta++ {
+			if matches(hint - delta) {
+				return hint - delta
+			}
+			if matches(hint + delta) {
+				return hint + delta
+			}
+		}
+	}
+
+	return -1
+}
+
+func isHunkLine(lines []string, i int) bool {
+	line := lines[i]
+	if line == "" {
+		// A blank line is context only if the hunk continues after it
+		return i+1 < len(lines) && lines[i+1] != "" && strings.ContainsAny(lines[i+1][:1], " +-") &&
+			!strings.HasPrefix(lines[i+1], "--- ") && !strings.HasPrefix(lines[i+1], "+++ ")
+	}
+	if strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ") {
+		return false
+	}
+	switch line[0] {
+	case ' ', '+', '-', '\\':
+		return true
+	}
+	return false
+}
+
+func parseHunkHeader(line string) (int, error) {
+	// @@ -oldStart[,oldLines] +newStart[,newLines] @@
+	fields := strings.Fields(line)
+	if len(fields) < 3 || !strings.HasPrefix(fields[1], "-") {
+		return 0, fmt.Errorf("invalid hunk header: %s", line)
+	}
+	start, _, _ := strings.Cut(fields[1][1:], ",")
+	return strconv.Atoi(start)
+}
+
+func patchPath(header, prefix string) string {
+	// Strip timestamps that follow a tab
+	path, _, _ := strings.Cut(header, "\t")
+	path = strings.TrimSpace(path)
+	if path == DevNull {
+		return path
+	}
+	return strings.TrimPrefix(path, prefix)
+}
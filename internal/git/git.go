@@ -0,0 +1,77 @@
+// Package git runs the git commands used by the commands that work on
+// changes, such as commit-msg and review, and by the git sources of the
+// context command.
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Run runs git in dir and returns its output. Errors include git's own
+// message when it printed one.
+func Run(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return string(out), nil
+}
+
+// Root returns the top-level directory of the work tree containing dir.
+func Root(dir string) (string, error) {
+	out, err := Run(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", fmt.Errorf("not a git repository: %w", err)
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// Path resolves a path inside the git directory, such as "COMMIT_EDITMSG"
+// or "hooks", honoring worktrees and core.hooksPath.
+func Path(dir, name string) (string, error) {
+	out, err := Run(dir, "rev-parse", "--git-path", name)
+	if err != nil {
+		return "", err
+	}
+	p := strings.TrimSpace(out)
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(dir, p)
+	}
+	return p, nil
+}
+
+// ChangedFiles lists the files changed by a diff, given the same arguments
+// as "git diff", with their status letter (A, M, D, R...).
+func ChangedFiles(dir string, args ...string) (map[string]string, error) {
+	out, err := Run(dir, append([]string{"diff", "--name-status", "-z"}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]string)
+	fields := strings.Split(strings.TrimRight(out, "\x00"), "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		status := fields[i]
+		// Renames and copies list the old and the new path
+		if strings.HasPrefix(status, "R") || strings.HasPrefix(status, "C") {
+			i++
+			if i+1 >= len(fields) {
+				break
+			}
+		}
+		files[fields[i+1]] = status[:1]
+	}
+	return files, nil
+}
@@ -0,0 +1,32 @@
+// Package home locates the user's home directory and expands paths
+// relative to it.
+package home
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Dir returns the user's home directory: $HOME on Unix, %USERPROFILE% on
+// Windows. It is empty when that isn't set.
+func Dir() string {
+	dir, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return dir
+}
+
+// Expand replaces a leading "~" or "~/" in path with the home directory.
+// Other paths, including ~user forms, are returned unchanged.
+func Expand(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	dir := Dir()
+	if dir == "" {
+		return path
+	}
+	return filepath.Join(dir, path[1:])
+}
@@ -0,0 +1,39 @@
+package home
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("USERPROFILE", dir)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"~", dir},
+		{"~/", dir},
+		{"~/.config/mktools", filepath.Join(dir, ".config", "mktools")},
+		{"~other/file", "~other/file"},
+		{"/etc/~/file", "/etc/~/file"},
+		{"relative/path", "relative/path"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Expand(tt.path); got != tt.want {
+			t.Errorf("Expand(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestExpandWithoutHome(t *testing.T) {
+	t.Setenv("HOME", "")
+	t.Setenv("USERPROFILE", "")
+
+	if got := Expand("~/file"); got != "~/file" {
+		t.Errorf("Expand without a home directory = %q, want the path unchanged", got)
+	}
+}
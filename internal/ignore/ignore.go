@@ -4,6 +4,8 @@ package ignore
 
 import (
 	"bufio"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
@@ -43,7 +45,25 @@ func (il *IgnoreList) LoadGitignore(path string) error {
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
+	return il.loadPatterns(file)
+}
+
+// LoadGitignoreFS loads a .gitignore file from fsys. A missing file is not an error.
+func (il *IgnoreList) LoadGitignoreFS(fsys fs.FS, name string) error {
+	file, err := fsys.Open(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	return il.loadPatterns(file)
+}
+
+func (il *IgnoreList) loadPatterns(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
 		il.AddPattern(scanner.Text())
 	}
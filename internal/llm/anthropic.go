@@ -0,0 +1,208 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultAnthropicURL is the base URL of the Anthropic API.
+const DefaultAnthropicURL = "https://api.anthropic.com"
+
+const anthropicVersion = "2023-06-01"
+
+// Anthropic is a client for the Anthropic Messages API.
+type Anthropic struct {
+	apiKey  string
+	model   string
+	baseURL string
+	client  *http.Client
+}
+
+// NewAnthropic returns an Anthropic provider. An empty baseURL uses the
+// public API and a nil client uses a default one.
+func NewAnthropic(apiKey, model, baseURL string, client *http.Client) *Anthropic {
+	if baseURL == "" {
+		baseURL = DefaultAnthropicURL
+	}
+	if client == nil {
+		client = defaultClient
+	}
+	return &Anthropic{apiKey: apiKey, model: model, baseURL: baseURL, client: client}
+}
+
+func (a *Anthropic) Name() string {
+	return "anthropic"
+}
+
+type anthropicRequest struct {
+	Model     string    `json:"model"`
+	MaxTokens int       `json:"max_tokens,omitempty"`
+	System    string    `json:"system,omitempty"`
+	Messages  []Message `json:"messages"`
+	Stream    bool      `json:"stream,omitempty"`
+}
+
+type anthropicResponse struct {
+	Model   string `json:"model"`
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	StopReason string `json:"stop_reason"`
+	Usage      Usage  `json:"usage"`
+}
+
+func (a *Anthropic) request(req *Request, stream bool) anthropicRequest {
+	body := anthropicRequest{
+		Model:     req.Model,
+		MaxTokens: req.MaxTokens,
+		System:    req.System,
+		Messages:  req.Messages,
+		Stream:    stream,
+	}
+	if body.Model == "" {
+		body.Model = a.model
+	}
+	if body.MaxTokens == 0 {
+		body.MaxTokens = DefaultMaxTokens
+	}
+	return body
+}
+
+func (a *Anthropic) header() http.Header {
+	h := http.Header{}
+	h.Set("x-api-key", a.apiKey)
+	h.Set("anthropic-version", anthropicVersion)
+	return h
+}
+
+func (a *Anthropic) Complete(ctx context.Context, req *Request) (*Response, error) {
+	resp, err := postJSON(ctx, a.client, a.Name(), joinURL(a.baseURL, "/v1/messages"), a.header(), a.request(req, false))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body anthropicResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("anthropic: error decoding response: %w", err)
+	}
+
+	var text strings.Builder
+	for _, block := range body.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	return &Response{
+		Provider:   a.Name(),
+		Model:      body.Model,
+		Content:    text.String(),
+		StopReason: body.StopReason,
+		Usage:      body.Usage,
+	}, nil
+}
+
+func (a *Anthropic) Stream(ctx context.Context, req *Request, fn func(text string) error) (*Response, error) {
+	resp, err := postJSON(ctx, a.client, a.Name(), joinURL(a.baseURL, "/v1/messages"), a.header(), a.request(req, true))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := &Response{Provider: a.Name()}
+	var text strings.Builder
+	err = readSSE(resp.Body, func(event, data string) error {
+		var ev struct {
+			Message struct {
+				Model string `json:"model"`
+				Usage Usage  `json:"usage"`
+			} `json:"message"`
+			Delta struct {
+				Type       string `json:"type"`
+				Text       string `json:"text"`
+				StopReason string `json:"stop_reason"`
+			} `json:"delta"`
+			Usage Usage `json:"usage"`
+			Error struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			return fmt.Errorf("anthropic: error decoding %s event: %w", event, err)
+		}
+
+		switch event {
+		case "message_start":
+			result.Model = ev.Message.Model
+			result.Usage.InputTokens = ev.Message.Usage.InputTokens
+		case "content_block_delta":
+			if ev.Delta.Type == "text_delta" {
+				text.WriteString(ev.Delta.Text)
+				return fn(ev.Delta.Text)
+			}
+		case "message_delta":
+			result.StopReason = ev.Delta.StopReason
+			result.Usage.OutputTokens = ev.Usage.OutputTokens
+		case "error":
+			return &APIError{Provider: a.Name(), Type: ev.Error.Type, Message: ev.Error.Message}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.Content = text.String()
+	return result, nil
+}
+
+func (a *Anthropic) CountTokens(ctx context.Context, req *Request) (int, error) {
+	body := a.request(req, false)
+	body.MaxTokens = 0
+
+	resp, err := postJSON(ctx, a.client, a.Name(), joinURL(a.baseURL, "/v1/messages/count_tokens"), a.header(), body)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var count struct {
+		InputTokens int `json:"input_tokens"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&count); err != nil {
+		return 0, fmt.Errorf("anthropic: error decoding token count: %w", err)
+	}
+	return count.InputTokens, nil
+}
+
+func (a *Anthropic) ListModels(ctx context.Context) ([]Model, error) {
+	var models []Model
+	url := joinURL(a.baseURL, "/v1/models?limit=1000")
+	for {
+		var body struct {
+			Data []struct {
+				ID          string    `json:"id"`
+				DisplayName string    `json:"display_name"`
+				CreatedAt   time.Time `json:"created_at"`
+			} `json:"data"`
+			HasMore bool   `json:"has_more"`
+			LastID  string `json:"last_id"`
+		}
+		if err := getJSON(ctx, a.client, a.Name(), url, a.header(), &body); err != nil {
+			return nil, err
+		}
+		for _, m := range body.Data {
+			models = append(models, Model{ID: m.ID, Description: m.DisplayName, Created: m.CreatedAt})
+		}
+		if !body.HasMore || body.LastID == "" {
+			return models, nil
+		}
+		url = joinURL(a.baseURL, "/v1/models?limit=1000&after_id="+body.LastID)
+	}
+}
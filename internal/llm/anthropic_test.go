@@ -0,0 +1,234 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testRequest() *Request {
+	return &Request{
+		System:   "Be brief.",
+		Messages: []Message{{Role: RoleUser, Content: "Hello"}},
+	}
+}
+
+// writeSSE writes events as a server-sent event stream.
+func writeSSE(w http.ResponseWriter, events ...string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	for _, ev := range events {
+		fmt.Fprint(w, ev, "\n\n")
+	}
+}
+
+func TestAnthropicComplete(t *testing.T) {
+	var got anthropicRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			t.Errorf("path = %s, want /v1/messages", r.URL.Path)
+		}
+		if key := r.Header.Get("x-api-key"); key != "test-key" {
+			t.Errorf("x-api-key = %q", key)
+		}
+		if v := r.Header.Get("anthropic-version"); v != anthropicVersion {
+			t.Errorf("anthropic-version = %q", v)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decoding request: %v", err)
+		}
+		fmt.Fprint(w, `{
+			"model": "claude-test",
+			"content": [
+				{"type": "text", "text": "Hi"},
+				{"type": "tool_use", "text": "ignored"},
+				{"type": "text", "text": " there"}
+			],
+			"stop_reason": "end_turn",
+			"usage": {"input_tokens": 12, "output_tokens": 3}
+		}`)
+	}))
+	defer srv.Close()
+
+	p := NewAnthropic("test-key", "claude-default", srv.URL, srv.Client())
+	resp, err := p.Complete(context.Background(), testRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Model != "claude-default" || got.System != "Be brief." || got.MaxTokens != DefaultMaxTokens || got.Stream {
+		t.Errorf("request = %+v", got)
+	}
+	want := Response{Provider: "anthropic", Model: "claude-test", Content: "Hi there", StopReason: "end_turn", Usage: Usage{InputTokens: 12, OutputTokens: 3}}
+	if *resp != want {
+		t.Errorf("response = %+v, want %+v", *resp, want)
+	}
+}
+
+func TestAnthropicStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req anthropicRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if !req.Stream {
+			t.Error("stream not requested")
+		}
+		writeSSE(w,
+			"event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"model\":\"claude-test\",\"usage\":{\"input_tokens\":25,\"output_tokens\":1}}}",
+			"event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":0}",
+			": keep-alive",
+			"event: ping\ndata: {\"type\":\"ping\"}",
+			"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\"Hello\"}}",
+			"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\", world\"}}",
+			"event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"end_turn\"},\"usage\":{\"output_tokens\":4}}",
+			"event: message_stop\ndata: {\"type\":\"message_stop\"}",
+		)
+	}))
+	defer srv.Close()
+
+	p := NewAnthropic("test-key", "claude-default", srv.URL, srv.Client())
+	var pieces []string
+	resp, err := p.Stream(context.Background(), testRequest(), func(text string) error {
+		pieces = append(pieces, text)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(pieces, "|") != "Hello|, world" {
+		t.Errorf("pieces = %q", pieces)
+	}
+	want := Response{Provider: "anthropic", Model: "claude-test", Content: "Hello, world", StopReason: "end_turn", Usage: Usage{InputTokens: 25, OutputTokens: 4}}
+	if *resp != want {
+		t.Errorf("response = %+v, want %+v", *resp, want)
+	}
+}
+
+func TestAnthropicStreamError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeSSE(w,
+			"event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"model\":\"claude-test\"}}",
+			"event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}",
+		)
+	}))
+	defer srv.Close()
+
+	p := NewAnthropic("test-key", "claude-default", srv.URL, srv.Client())
+	_, err := p.Stream(context.Background(), testRequest(), func(string) error { return nil })
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("err = %v, want *APIError", err)
+	}
+	if apiErr.Type != "overloaded_error" || apiErr.Message != "Overloaded" || apiErr.StatusCode != 0 {
+		t.Errorf("err = %+v", apiErr)
+	}
+	if !Temporary(err) {
+		t.Error("overloaded stream error should be temporary")
+	}
+}
+
+func TestAnthropicCountTokens(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages/count_tokens" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		if _, ok := body["max_tokens"]; ok {
+			t.Error("max_tokens sent to count_tokens")
+		}
+		fmt.Fprint(w, `{"input_tokens": 42}`)
+	}))
+	defer srv.Close()
+
+	p := NewAnthropic("test-key", "claude-default", srv.URL, srv.Client())
+	n, err := p.CountTokens(context.Background(), testRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 42 {
+		t.Errorf("tokens = %d, want 42", n)
+	}
+}
+
+func TestAPIErrorMapping(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		header    map[string]string
+		body      string
+		want      APIError
+		temporary bool
+	}{
+		{
+			name:   "anthropic",
+			status: http.StatusUnauthorized,
+			body:   `{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`,
+			want:   APIError{StatusCode: 401, Type: "authentication_error", Message: "invalid x-api-key"},
+		},
+		{
+			name:      "openai with retry-after",
+			status:    http.StatusTooManyRequests,
+			header:    map[string]string{"Retry-After": "2"},
+			body:      `{"error":{"message":"Rate limit reached","type":"requests","code":"rate_limit_exceeded"}}`,
+			want:      APIError{StatusCode: 429, Type: "requests", Message: "Rate limit reached", RetryAfter: 2 * time.Second},
+			temporary: true,
+		},
+		{
+			name:      "retry-after-ms",
+			status:    http.StatusServiceUnavailable,
+			header:    map[string]string{"Retry-After-Ms": "1500"},
+			body:      `{"error":"model is loading"}`,
+			want:      APIError{StatusCode: 503, Message: "model is loading", RetryAfter: 1500 * time.Millisecond},
+			temporary: true,
+		},
+		{
+			name:   "top-level message",
+			status: http.StatusNotFound,
+			body:   `{"message":"no such model"}`,
+			want:   APIError{StatusCode: 404, Message: "no such model"},
+		},
+		{
+			name:      "plain text",
+			status:    http.StatusBadGateway,
+			body:      "upstream connect error\n",
+			want:      APIError{StatusCode: 502, Message: "upstream connect error"},
+			temporary: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for k, v := range tt.header {
+					w.Header().Set(k, v)
+				}
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			}))
+			defer srv.Close()
+
+			p := NewOpenAI("test-key", "gpt-test", srv.URL, srv.Client())
+			_, err := p.Complete(context.Background(), testRequest())
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("err = %v, want *APIError", err)
+			}
+			want := tt.want
+			want.Provider = "openai"
+			if *apiErr != want {
+				t.Errorf("err = %+v, want %+v", *apiErr, want)
+			}
+			if Temporary(err) != tt.temporary {
+				t.Errorf("Temporary = %v, want %v", !tt.temporary, tt.temporary)
+			}
+		})
+	}
+}
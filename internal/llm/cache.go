@@ -0,0 +1,113 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/amenophis1er/mktools/internal/cache"
+	"github.com/amenophis1er/mktools/internal/config"
+	"github.com/amenophis1er/mktools/internal/filesize"
+)
+
+// CacheName is the cache store holding LLM responses.
+const CacheName = "llm"
+
+// openCache opens the response cache with the configured limits. It
+// returns nil without an error when the cache directory is unavailable.
+func openCache(cfg config.CacheConfig) (*cache.Store, error) {
+	var ttl time.Duration
+	if cfg.TTL != "" {
+		d, err := time.ParseDuration(cfg.TTL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cache ttl: %w", err)
+		}
+		ttl = d
+	}
+	var maxSize int64
+	if cfg.MaxSize != "" {
+		n, err := filesize.Parse(cfg.MaxSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cache max_size: %w", err)
+		}
+		maxSize = n
+	}
+
+	store, err := cache.Open(CacheName)
+	if err != nil {
+		return nil, nil
+	}
+	store.SetLimits(ttl, maxSize)
+	return store, nil
+}
+
+// WithCache wraps p so successful replies are stored and replayed for
+// identical requests. The identity parts name everything besides the
+// request that shapes a reply, such as the provider and its default model.
+func WithCache(p Provider, store *cache.Store, identity ...string) Provider {
+	return &cachedProvider{Provider: p, store: store, identity: identity}
+}
+
+type cachedProvider struct {
+	Provider
+	store    *cache.Store
+	identity []string
+}
+
+func (c *cachedProvider) key(req *Request) string {
+	data, _ := json.Marshal(req)
+	return cache.Key(append(c.identity, string(data))...)
+}
+
+func (c *cachedProvider) get(key string) (*Response, bool) {
+	data, ok := c.store.Get(key)
+	if !ok {
+		return nil, false
+	}
+	var resp Response
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, false
+	}
+	resp.Cached = true
+	return &resp, true
+}
+
+// put stores resp. Failing to cache a reply doesn't fail the call.
+func (c *cachedProvider) put(key string, resp *Response) {
+	if data, err := json.Marshal(resp); err == nil {
+		c.store.Put(key, data)
+	}
+}
+
+func (c *cachedProvider) Complete(ctx context.Context, req *Request) (*Response, error) {
+	key := c.key(req)
+	if resp, ok := c.get(key); ok {
+		return resp, nil
+	}
+	resp, err := c.Provider.Complete(ctx, req)
+	if err == nil {
+		c.put(key, resp)
+	}
+	return resp, err
+}
+
+// Stream replays a cached reply as a single piece of text.
+func (c *cachedProvider) Stream(ctx context.Context, req *Request, fn func(text string) error) (*Response, error) {
+	key := c.key(req)
+	if resp, ok := c.get(key); ok {
+		if err := fn(resp.Content); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+	resp, err := c.Provider.Stream(ctx, req, fn)
+	if err == nil {
+		c.put(key, resp)
+	}
+	return resp, err
+}
+
+func (c *cachedProvider) Unwrap() Provider {
+	return c.Provider
+}
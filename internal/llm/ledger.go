@@ -0,0 +1,89 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/amenophis1er/mktools/internal/config"
+	"github.com/amenophis1er/mktools/internal/usage"
+)
+
+// WithLedger wraps p so every successful call is recorded in the usage
+// ledger at path, priced with the models in cfg. Token counting isn't
+// recorded, as it is free.
+func WithLedger(p Provider, path string, cfg config.LLMConfig) Provider {
+	return &ledgerProvider{Provider: p, path: path, config: cfg}
+}
+
+type ledgerProvider struct {
+	Provider
+	path   string
+	config config.LLMConfig
+}
+
+// record appends a call to the ledger, under the provider that served it:
+// the fallback's, when the primary one failed.
+func (l *ledgerProvider) record(ctx context.Context, req *Request, resp *Response, latency time.Duration) {
+	provider := resp.Provider
+	if provider == "" {
+		provider = l.Name()
+	}
+	fallback := l.config.Fallback
+	usedFallback := provider != l.Name() && fallback != nil && provider == fallback.Provider
+
+	model := resp.Model
+	switch {
+	case model != "":
+	case usedFallback:
+		// The fallback is always sent its own model
+		model = fallback.Model
+	case req.Model != "":
+		model = req.Model
+	default:
+		model = l.config.Model
+	}
+
+	e := usage.Entry{
+		Time:         time.Now().UTC(),
+		Command:      usage.Command(ctx),
+		Project:      usage.Project(ctx),
+		Provider:     provider,
+		Model:        model,
+		InputTokens:  resp.Usage.InputTokens,
+		OutputTokens: resp.Usage.OutputTokens,
+		LatencyMS:    latency.Milliseconds(),
+	}
+	if m, ok := l.config.LookupModel(model); ok {
+		cost := m.Cost(e.InputTokens, e.OutputTokens)
+		e.Cost = &cost
+	}
+
+	// The answer matters more than its accounting
+	if err := usage.Append(l.path, e); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+}
+
+func (l *ledgerProvider) Complete(ctx context.Context, req *Request) (*Response, error) {
+	start := time.Now()
+	resp, err := l.Provider.Complete(ctx, req)
+	if err == nil {
+		l.record(ctx, req, resp, time.Since(start))
+	}
+	return resp, err
+}
+
+func (l *ledgerProvider) Stream(ctx context.Context, req *Request, fn func(text string) error) (*Response, error) {
+	start := time.Now()
+	resp, err := l.Provider.Stream(ctx, req, fn)
+	if err == nil {
+		l.record(ctx, req, resp, time.Since(start))
+	}
+	return resp, err
+}
+
+func (l *ledgerProvider) Unwrap() Provider {
+	return l.Provider
+}
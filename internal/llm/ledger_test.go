@@ -0,0 +1,53 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/amenophis1er/mktools/internal/config"
+	"github.com/amenophis1er/mktools/internal/usage"
+)
+
+func TestLedgerRecordsFallback(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"ok"}}],"usage":{"prompt_tokens":7,"completion_tokens":2}}`)
+	}))
+	defer fallback.Close()
+
+	cfg := config.LLMConfig{
+		Provider: "anthropic",
+		Model:    "claude-test",
+		Fallback: &config.FallbackConfig{Provider: "openai", Model: "gpt-test"},
+	}
+	path := filepath.Join(t.TempDir(), "usage.jsonl")
+	p := WithLedger(WithFallback(
+		NewAnthropic("test-key", "claude-test", primary.URL, primary.Client()),
+		NewOpenAI("test-key", "gpt-test", fallback.URL, fallback.Client()),
+		noWait,
+	), path, cfg)
+
+	if _, err := p.Complete(context.Background(), testRequest()); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := usage.Read(path, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("entries = %+v, want one", entries)
+	}
+	e := entries[0]
+	if e.Provider != "openai" || e.Model != "gpt-test" || e.InputTokens != 7 || e.OutputTokens != 2 {
+		t.Errorf("entry = %+v, want the fallback's provider, model and usage", e)
+	}
+}
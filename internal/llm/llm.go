@@ -0,0 +1,345 @@
+// Package llm talks to language model APIs. Each supported API is a
+// Provider; New picks one from the LLM section of the configuration.
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/amenophis1er/mktools/internal/config"
+	"github.com/amenophis1er/mktools/internal/home"
+	"github.com/amenophis1er/mktools/internal/usage"
+)
+
+// Message roles.
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// DefaultMaxTokens caps the length of a reply when the request doesn't.
+const DefaultMaxTokens = 4096
+
+// Message is one turn of a conversation.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Request is a model call. An empty Model uses the provider's configured one.
+type Request struct {
+	Model     string
+	System    string
+	Messages  []Message
+	MaxTokens int
+}
+
+// Usage is the token accounting reported for a call.
+type Usage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// Response is a completed model reply.
+type Response struct {
+	// Provider is the name of the provider that served the reply, which
+	// is the fallback's when the primary provider failed.
+	Provider   string
+	Model      string
+	Content    string
+	StopReason string
+	Usage      Usage
+
+	// Cached is set when the reply was replayed from the response cache.
+	Cached bool `json:"-"`
+}
+
+// Provider is a language model API.
+type Provider interface {
+	// Name identifies the provider, e.g. "anthropic".
+	Name() string
+
+	// Complete sends the request and waits for the whole reply.
+	Complete(ctx context.Context, req *Request) (*Response, error)
+
+	// Stream sends the request and calls fn with each piece of text as it
+	// arrives. The returned response holds the full text and usage.
+	Stream(ctx context.Context, req *Request, fn func(text string) error) (*Response, error)
+
+	// CountTokens returns the number of input tokens the request would use.
+	// Providers without a counting endpoint return an estimate.
+	CountTokens(ctx context.Context, req *Request) (int, error)
+}
+
+// Model is a model a provider can serve.
+type Model struct {
+	ID          string
+	Description string
+	Size        int64
+	Created     time.Time
+}
+
+// ModelLister is implemented by providers that can list their models.
+type ModelLister interface {
+	ListModels(ctx context.Context) ([]Model, error)
+}
+
+// ListModels lists the models of p, looking through retry and fallback
+// wrappers to the primary provider.
+func ListModels(ctx context.Context, p Provider) ([]Model, error) {
+	for {
+		if l, ok := p.(ModelLister); ok {
+			return l.ListModels(ctx)
+		}
+		u, ok := p.(interface{ Unwrap() Provider })
+		if !ok {
+			return nil, fmt.Errorf("%s does not support listing models", p.Name())
+		}
+		p = u.Unwrap()
+	}
+}
+
+// New returns the provider described by cfg. Transient failures are
+// retried according to cfg.Retry and then, if cfg.Fallback is set, sent to
+// the fallback provider. Retries and fallbacks are reported on stderr.
+// Calls are recorded in the usage ledger when cfg.Ledger is enabled, and
+// with cfg.Cache enabled, replies to requests already answered are
+// replayed from the response cache without a new call.
+func New(cfg config.LLMConfig) (Provider, error) {
+	policy, err := NewRetryPolicy(cfg.Retry)
+	if err != nil {
+		return nil, err
+	}
+	policy.Logf = func(format string, args ...any) {
+		fmt.Fprintf(os.Stderr, format, args...)
+	}
+
+	primary, err := newProvider(cfg.Provider, cfg.Model, cfg.APIKey, cfg.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	p := WithRetry(primary, policy)
+
+	if fb := cfg.Fallback; fb != nil && fb.Provider != "" {
+		fallback, err := newProvider(fb.Provider, fb.Model, fb.APIKey, fb.BaseURL)
+		if err != nil {
+			return nil, fmt.Errorf("fallback: %w", err)
+		}
+		p = WithFallback(p, WithRetry(fallback, policy), policy)
+	}
+
+	if cfg.Ledger.Enabled {
+		path := cfg.Ledger.Path
+		if path == "" {
+			path = usage.DefaultPath()
+		}
+		p = WithLedger(p, home.Expand(path), cfg)
+	}
+
+	if cfg.Cache.Enabled {
+		store, err := openCache(cfg.Cache)
+		if err != nil {
+			return nil, err
+		}
+		// A cache that can't be opened only costs a fresh call
+		if store != nil {
+			p = WithCache(p, store, cfg.Provider, cfg.Model, cfg.BaseURL)
+		}
+	}
+	return p, nil
+}
+
+func newProvider(name, model, apiKey, baseURL string) (Provider, error) {
+	switch name {
+	case "anthropic":
+		if apiKey == "" {
+			return nil, fmt.Errorf("no API key for anthropic (set llm.api_key or ANTHROPIC_API_KEY)")
+		}
+		return NewAnthropic(apiKey, model, baseURL, nil), nil
+	case "openai":
+		if apiKey == "" {
+			return nil, fmt.Errorf("no API key for openai (set llm.api_key or OPENAI_API_KEY)")
+		}
+		return NewOpenAI(apiKey, model, baseURL, nil), nil
+	case "ollama":
+		return NewOllama(model, baseURL, nil), nil
+	case "openai-compatible":
+		if baseURL == "" {
+			return nil, fmt.Errorf("openai-compatible provider requires base_url")
+		}
+		return NewOpenAICompatible(apiKey, model, baseURL, nil), nil
+	default:
+		return nil, fmt.Errorf("unsupported LLM provider: %s", name)
+	}
+}
+
+// estimateRequest estimates the input tokens of a request.
+func estimateRequest(req *Request) int {
+	total := EstimateTokens(req.System)
+	for _, m := range req.Messages {
+		// A few tokens of overhead per message for the role and separators
+		total += EstimateTokens(m.Content) + 4
+	}
+	return total
+}
+
+// EstimateTokens approximates the token count of text for providers that
+// can't count them, at roughly four characters per token.
+func EstimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// APIError is an error response from a provider.
+type APIError struct {
+	Provider   string
+	StatusCode int
+	Type       string
+	Message    string
+
+	// RetryAfter is how long the provider asked to wait before retrying.
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = http.StatusText(e.StatusCode)
+	}
+
+	var detail []string
+	if e.StatusCode != 0 {
+		detail = append(detail, fmt.Sprint(e.StatusCode))
+	}
+	if e.Type != "" {
+		detail = append(detail, e.Type)
+	}
+	if len(detail) == 0 {
+		return fmt.Sprintf("%s: %s", e.Provider, msg)
+	}
+	return fmt.Sprintf("%s: %s (%s)", e.Provider, msg, strings.Join(detail, " "))
+}
+
+// defaultClient is used when a provider is created without an HTTP client.
+// Replies can take minutes to stream, so only the connection setup has a
+// short deadline; callers bound the whole call through the context.
+var defaultClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 5 * time.Minute,
+	},
+}
+
+// postJSON sends body as JSON and returns the response if it succeeded.
+// Error responses are turned into an *APIError.
+func postJSON(ctx context.Context, client *http.Client, provider, url string, header http.Header, body any) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, &requestError{provider: provider, err: err}
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, newAPIError(provider, resp)
+	}
+	return resp, nil
+}
+
+// getJSON fetches url and decodes the JSON response into out.
+func getJSON(ctx context.Context, client *http.Client, provider, url string, header http.Header, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return &requestError{provider: provider, err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return newAPIError(provider, resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("%s: error decoding response: %w", provider, err)
+	}
+	return nil
+}
+
+// newAPIError reads an error response. Providers disagree on the shape of
+// error bodies, so the common ones are all tried.
+func newAPIError(provider string, resp *http.Response) *APIError {
+	apiErr := &APIError{
+		Provider:   provider,
+		StatusCode: resp.StatusCode,
+		RetryAfter: retryAfter(resp.Header),
+	}
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	var body struct {
+		Error   json.RawMessage `json:"error"`
+		Message string          `json:"message"`
+	}
+	if json.Unmarshal(data, &body) != nil {
+		apiErr.Message = strings.TrimSpace(string(data))
+		return apiErr
+	}
+
+	var detail struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	}
+	var text string
+	switch {
+	case json.Unmarshal(body.Error, &detail) == nil && detail.Message != "":
+		apiErr.Type = detail.Type
+		apiErr.Message = detail.Message
+	case json.Unmarshal(body.Error, &text) == nil && text != "":
+		apiErr.Message = text
+	default:
+		apiErr.Message = body.Message
+	}
+	return apiErr
+}
+
+// requestError is a request that got no response at all.
+type requestError struct {
+	provider string
+	err      error
+}
+
+func (e *requestError) Error() string {
+	return fmt.Sprintf("%s: request failed: %v", e.provider, e.err)
+}
+
+func (e *requestError) Unwrap() error {
+	return e.err
+}
+
+// joinURL appends path to a base URL that may or may not end in a slash.
+func joinURL(base, path string) string {
+	return strings.TrimRight(base, "/") + path
+}
@@ -0,0 +1,195 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultOllamaURL is where a local Ollama server listens by default.
+const DefaultOllamaURL = "http://localhost:11434"
+
+// Ollama is a client for the native API of an Ollama server. It needs no
+// API key.
+type Ollama struct {
+	model   string
+	baseURL string
+	client  *http.Client
+}
+
+// NewOllama returns an Ollama provider. An empty baseURL uses $OLLAMA_HOST,
+// or the default local server, and a nil client uses a default one.
+func NewOllama(model, baseURL string, client *http.Client) *Ollama {
+	if baseURL == "" {
+		baseURL = ollamaHost()
+	}
+	if client == nil {
+		client = defaultClient
+	}
+	return &Ollama{model: model, baseURL: baseURL, client: client}
+}
+
+// ollamaHost reads $OLLAMA_HOST, which Ollama itself accepts with or
+// without a scheme.
+func ollamaHost() string {
+	host := os.Getenv("OLLAMA_HOST")
+	if host == "" {
+		return DefaultOllamaURL
+	}
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+	return host
+}
+
+func (o *Ollama) Name() string {
+	return "ollama"
+}
+
+type ollamaRequest struct {
+	Model    string    `json:"model"`
+	Messages []Message `json:"messages"`
+	Stream   bool      `json:"stream"`
+	Options  *struct {
+		NumPredict int `json:"num_predict,omitempty"`
+	} `json:"options,omitempty"`
+}
+
+type ollamaResponse struct {
+	Model           string  `json:"model"`
+	Message         Message `json:"message"`
+	Done            bool    `json:"done"`
+	DoneReason      string  `json:"done_reason"`
+	PromptEvalCount int     `json:"prompt_eval_count"`
+	EvalCount       int     `json:"eval_count"`
+	Error           string  `json:"error"`
+}
+
+func (o *Ollama) request(req *Request, stream bool) ollamaRequest {
+	body := ollamaRequest{Model: req.Model, Stream: stream}
+	if body.Model == "" {
+		body.Model = o.model
+	}
+	if req.System != "" {
+		body.Messages = append(body.Messages, Message{Role: "system", Content: req.System})
+	}
+	body.Messages = append(body.Messages, req.Messages...)
+	if req.MaxTokens > 0 {
+		body.Options = &struct {
+			NumPredict int `json:"num_predict,omitempty"`
+		}{NumPredict: req.MaxTokens}
+	}
+	return body
+}
+
+func (o *Ollama) Complete(ctx context.Context, req *Request) (*Response, error) {
+	resp, err := postJSON(ctx, o.client, o.Name(), joinURL(o.baseURL, "/api/chat"), nil, o.request(req, false))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body ollamaResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("ollama: error decoding response: %w", err)
+	}
+	if body.Error != "" {
+		return nil, &APIError{Provider: o.Name(), Message: body.Error}
+	}
+	return body.response(body.Message.Content), nil
+}
+
+// Stream reads the newline-delimited JSON objects Ollama streams, the last
+// of which has done set and carries the token counts.
+func (o *Ollama) Stream(ctx context.Context, req *Request, fn func(text string) error) (*Response, error) {
+	resp, err := postJSON(ctx, o.client, o.Name(), joinURL(o.baseURL, "/api/chat"), nil, o.request(req, true))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var text strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64<<10), 4<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var chunk ollamaResponse
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			return nil, fmt.Errorf("ollama: error decoding stream chunk: %w", err)
+		}
+		if chunk.Error != "" {
+			return nil, &APIError{Provider: o.Name(), Message: chunk.Error}
+		}
+		if chunk.Message.Content != "" {
+			text.WriteString(chunk.Message.Content)
+			if err := fn(chunk.Message.Content); err != nil {
+				return nil, err
+			}
+		}
+		if chunk.Done {
+			return chunk.response(text.String()), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("ollama: error reading stream: %w", err)
+	}
+	return nil, fmt.Errorf("ollama: stream ended before the reply was done")
+}
+
+func (r *ollamaResponse) response(content string) *Response {
+	return &Response{
+		Provider:   "ollama",
+		Model:      r.Model,
+		Content:    content,
+		StopReason: r.DoneReason,
+		Usage:      Usage{InputTokens: r.PromptEvalCount, OutputTokens: r.EvalCount},
+	}
+}
+
+// CountTokens estimates the input tokens, as Ollama has no counting
+// endpoint.
+func (o *Ollama) CountTokens(ctx context.Context, req *Request) (int, error) {
+	return estimateRequest(req), nil
+}
+
+func (o *Ollama) ListModels(ctx context.Context) ([]Model, error) {
+	var body struct {
+		Models []struct {
+			Name       string    `json:"name"`
+			ModifiedAt time.Time `json:"modified_at"`
+			Size       int64     `json:"size"`
+			Details    struct {
+				ParameterSize     string `json:"parameter_size"`
+				QuantizationLevel string `json:"quantization_level"`
+			} `json:"details"`
+		} `json:"models"`
+	}
+	if err := getJSON(ctx, o.client, o.Name(), joinURL(o.baseURL, "/api/tags"), nil, &body); err != nil {
+		return nil, err
+	}
+
+	models := make([]Model, 0, len(body.Models))
+	for _, m := range body.Models {
+		var details []string
+		for _, d := range []string{m.Details.ParameterSize, m.Details.QuantizationLevel} {
+			if d != "" {
+				details = append(details, d)
+			}
+		}
+		models = append(models, Model{
+			ID:          m.Name,
+			Description: strings.Join(details, ", "),
+			Size:        m.Size,
+			Created:     m.ModifiedAt,
+		})
+	}
+	return models, nil
+}
@@ -0,0 +1,214 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeNDJSON writes lines as a newline-delimited JSON stream.
+func writeNDJSON(w http.ResponseWriter, lines ...string) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+	}
+}
+
+func TestOllamaComplete(t *testing.T) {
+	var got ollamaRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("path = %s, want /api/chat", r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			t.Errorf("Authorization = %q, want none", auth)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decoding request: %v", err)
+		}
+		fmt.Fprint(w, `{
+			"model": "llama3.2",
+			"message": {"role": "assistant", "content": "Hi there"},
+			"done": true,
+			"done_reason": "stop",
+			"prompt_eval_count": 14,
+			"eval_count": 3
+		}`)
+	}))
+	defer srv.Close()
+
+	p := NewOllama("llama3.2", srv.URL, srv.Client())
+	req := testRequest()
+	req.MaxTokens = 100
+	resp, err := p.Complete(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Model != "llama3.2" || got.Stream || got.Options == nil || got.Options.NumPredict != 100 {
+		t.Errorf("request = %+v", got)
+	}
+	wantMessages := []Message{{Role: "system", Content: "Be brief."}, {Role: RoleUser, Content: "Hello"}}
+	if fmt.Sprint(got.Messages) != fmt.Sprint(wantMessages) {
+		t.Errorf("messages = %v, want %v", got.Messages, wantMessages)
+	}
+	want := Response{Provider: "ollama", Model: "llama3.2", Content: "Hi there", StopReason: "stop", Usage: Usage{InputTokens: 14, OutputTokens: 3}}
+	if *resp != want {
+		t.Errorf("response = %+v, want %+v", *resp, want)
+	}
+}
+
+func TestOllamaCompleteError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error":"model \"llama9\" not found, try pulling it first"}`)
+	}))
+	defer srv.Close()
+
+	p := NewOllama("llama9", srv.URL, srv.Client())
+	_, err := p.Complete(context.Background(), testRequest())
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("err = %v, want *APIError", err)
+	}
+	if apiErr.Provider != "ollama" || apiErr.StatusCode != 404 || !strings.Contains(apiErr.Message, "not found") {
+		t.Errorf("err = %+v", apiErr)
+	}
+}
+
+func TestOllamaStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ollamaRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if !req.Stream || req.Options != nil {
+			t.Errorf("request = %+v, want a stream without options", req)
+		}
+		writeNDJSON(w,
+			`{"model":"llama3.2","message":{"role":"assistant","content":"Hello"},"done":false}`,
+			``,
+			`{"model":"llama3.2","message":{"role":"assistant","content":", world"},"done":false}`,
+			`{"model":"llama3.2","message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":14,"eval_count":4}`,
+			// Anything after the final chunk is ignored
+			`not json`,
+		)
+	}))
+	defer srv.Close()
+
+	p := NewOllama("llama3.2", srv.URL, srv.Client())
+	var pieces []string
+	resp, err := p.Stream(context.Background(), testRequest(), func(text string) error {
+		pieces = append(pieces, text)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(pieces, "|") != "Hello|, world" {
+		t.Errorf("pieces = %q", pieces)
+	}
+	want := Response{Provider: "ollama", Model: "llama3.2", Content: "Hello, world", StopReason: "stop", Usage: Usage{InputTokens: 14, OutputTokens: 4}}
+	if *resp != want {
+		t.Errorf("response = %+v, want %+v", *resp, want)
+	}
+}
+
+func TestOllamaStreamError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeNDJSON(w,
+			`{"model":"llama3.2","message":{"role":"assistant","content":"Hel"},"done":false}`,
+			`{"error":"an error was encountered while running the model"}`,
+		)
+	}))
+	defer srv.Close()
+
+	p := NewOllama("llama3.2", srv.URL, srv.Client())
+	var out string
+	_, err := p.Stream(context.Background(), testRequest(), func(text string) error {
+		out += text
+		return nil
+	})
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("err = %v, want *APIError", err)
+	}
+	if apiErr.Provider != "ollama" || apiErr.Message != "an error was encountered while running the model" {
+		t.Errorf("err = %+v", apiErr)
+	}
+	if out != "Hel" {
+		t.Errorf("output = %q, want the text sent before the error", out)
+	}
+}
+
+func TestOllamaStreamNotDone(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeNDJSON(w, `{"model":"llama3.2","message":{"role":"assistant","content":"Hel"},"done":false}`)
+	}))
+	defer srv.Close()
+
+	p := NewOllama("llama3.2", srv.URL, srv.Client())
+	_, err := p.Stream(context.Background(), testRequest(), func(string) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "stream ended before the reply was done") {
+		t.Errorf("err = %v, want the stream to be reported as cut short", err)
+	}
+}
+
+func TestOllamaListModels(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/api/tags" {
+			t.Errorf("request = %s %s, want GET /api/tags", r.Method, r.URL.Path)
+		}
+		fmt.Fprint(w, `{"models": [
+			{"name": "llama3.2:latest", "modified_at": "2024-10-01T12:00:00Z", "size": 2019393189,
+			 "details": {"parameter_size": "3.2B", "quantization_level": "Q4_K_M"}},
+			{"name": "nomic-embed-text:latest", "modified_at": "2024-09-01T08:30:00Z", "size": 274302450, "details": {}}
+		]}`)
+	}))
+	defer srv.Close()
+
+	// Models are listed through the retry wrapper New puts around providers
+	p := WithRetry(NewOllama("llama3.2", srv.URL, srv.Client()), noWait)
+	models, err := ListModels(context.Background(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Model{
+		{ID: "llama3.2:latest", Description: "3.2B, Q4_K_M", Size: 2019393189, Created: time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)},
+		{ID: "nomic-embed-text:latest", Size: 274302450, Created: time.Date(2024, 9, 1, 8, 30, 0, 0, time.UTC)},
+	}
+	if len(models) != len(want) {
+		t.Fatalf("models = %+v, want %+v", models, want)
+	}
+	for i := range want {
+		if models[i].ID != want[i].ID || models[i].Description != want[i].Description ||
+			models[i].Size != want[i].Size || !models[i].Created.Equal(want[i].Created) {
+			t.Errorf("models[%d] = %+v, want %+v", i, models[i], want[i])
+		}
+	}
+}
+
+func TestOllamaHost(t *testing.T) {
+	tests := []struct {
+		env  string
+		want string
+	}{
+		{env: "", want: DefaultOllamaURL},
+		{env: "gpu-box:11434", want: "http://gpu-box:11434"},
+		{env: "https://ollama.example.com", want: "https://ollama.example.com"},
+	}
+	for _, tt := range tests {
+		t.Setenv("OLLAMA_HOST", tt.env)
+		if got := NewOllama("llama3.2", "", nil).baseURL; got != tt.want {
+			t.Errorf("OLLAMA_HOST=%q: base URL = %q, want %q", tt.env, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultOpenAIURL is the base URL of the OpenAI API.
+const DefaultOpenAIURL = "https://api.openai.com/v1"
+
+// OpenAI is a client for the OpenAI Chat Completions API.
+type OpenAI struct {
+	name    string
+	apiKey  string
+	model   string
+	baseURL string
+	client  *http.Client
+}
+
+// NewOpenAI returns an OpenAI provider. An empty baseURL uses the public API
+// and a nil client uses a default one.
+func NewOpenAI(apiKey, model, baseURL string, client *http.Client) *OpenAI {
+	if baseURL == "" {
+		baseURL = DefaultOpenAIURL
+	}
+	if client == nil {
+		client = defaultClient
+	}
+	return &OpenAI{name: "openai", apiKey: apiKey, model: model, baseURL: baseURL, client: client}
+}
+
+// NewOpenAICompatible returns a provider for a server implementing the
+// OpenAI Chat Completions API, such as vLLM, LM Studio or llama.cpp. The
+// API key is optional.
+func NewOpenAICompatible(apiKey, model, baseURL string, client *http.Client) *OpenAI {
+	o := NewOpenAI(apiKey, model, baseURL, client)
+	o.name = "openai-compatible"
+	return o
+}
+
+func (o *OpenAI) Name() string {
+	return o.name
+}
+
+type openAIRequest struct {
+	Model         string    `json:"model"`
+	Messages      []Message `json:"messages"`
+	MaxTokens     int       `json:"max_tokens,omitempty"`
+	Stream        bool      `json:"stream,omitempty"`
+	StreamOptions *struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options,omitempty"`
+}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+func (u *openAIUsage) usage() Usage {
+	if u == nil {
+		return Usage{}
+	}
+	return Usage{InputTokens: u.PromptTokens, OutputTokens: u.CompletionTokens}
+}
+
+// request converts req. The system prompt becomes the first message, and
+// max_tokens is only sent when the caller set it, since newer models reject
+// it in favour of their own limits.
+func (o *OpenAI) request(req *Request, stream bool) openAIRequest {
+	body := openAIRequest{
+		Model:     req.Model,
+		MaxTokens: req.MaxTokens,
+		Stream:    stream,
+	}
+	if body.Model == "" {
+		body.Model = o.model
+	}
+	if req.System != "" {
+		body.Messages = append(body.Messages, Message{Role: "system", Content: req.System})
+	}
+	body.Messages = append(body.Messages, req.Messages...)
+	// Only the OpenAI API is known to accept stream_options; compatible
+	// servers that report usage while streaming do so without it
+	if stream && o.name == "openai" {
+		body.StreamOptions = &struct {
+			IncludeUsage bool `json:"include_usage"`
+		}{IncludeUsage: true}
+	}
+	return body
+}
+
+func (o *OpenAI) header() http.Header {
+	h := http.Header{}
+	if o.apiKey != "" {
+		h.Set("Authorization", "Bearer "+o.apiKey)
+	}
+	return h
+}
+
+func (o *OpenAI) Complete(ctx context.Context, req *Request) (*Response, error) {
+	resp, err := postJSON(ctx, o.client, o.name, joinURL(o.baseURL, "/chat/completions"), o.header(), o.request(req, false))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Model   string `json:"model"`
+		Choices []struct {
+			Message      Message `json:"message"`
+			FinishReason string  `json:"finish_reason"`
+		} `json:"choices"`
+		Usage *openAIUsage `json:"usage"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("%s: error decoding response: %w", o.name, err)
+	}
+	if len(body.Choices) == 0 {
+		return nil, fmt.Errorf("%s: response has no choices", o.name)
+	}
+
+	return &Response{
+		Provider:   o.name,
+		Model:      body.Model,
+		Content:    body.Choices[0].Message.Content,
+		StopReason: body.Choices[0].FinishReason,
+		Usage:      body.Usage.usage(),
+	}, nil
+}
+
+func (o *OpenAI) Stream(ctx context.Context, req *Request, fn func(text string) error) (*Response, error) {
+	resp, err := postJSON(ctx, o.client, o.name, joinURL(o.baseURL, "/chat/completions"), o.header(), o.request(req, true))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := &Response{Provider: o.name}
+	var text strings.Builder
+	err = readSSE(resp.Body, func(event, data string) error {
+		if data == "[DONE]" {
+			return nil
+		}
+		var chunk struct {
+			Model   string `json:"model"`
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+				FinishReason string `json:"finish_reason"`
+			} `json:"choices"`
+			Usage *openAIUsage `json:"usage"`
+			Error *struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("%s: error decoding stream chunk: %w", o.name, err)
+		}
+		if chunk.Error != nil {
+			return &APIError{Provider: o.name, Type: chunk.Error.Type, Message: chunk.Error.Message}
+		}
+
+		if chunk.Model != "" {
+			result.Model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			result.Usage = chunk.Usage.usage()
+		}
+		for _, choice := range chunk.Choices {
+			if choice.FinishReason != "" {
+				result.StopReason = choice.FinishReason
+			}
+			if choice.Delta.Content != "" {
+				text.WriteString(choice.Delta.Content)
+				if err := fn(choice.Delta.Content); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.Content = text.String()
+	return result, nil
+}
+
+// CountTokens estimates the input tokens, as the Chat Completions API has no
+// counting endpoint.
+func (o *OpenAI) CountTokens(ctx context.Context, req *Request) (int, error) {
+	return estimateRequest(req), nil
+}
+
+func (o *OpenAI) ListModels(ctx context.Context) ([]Model, error) {
+	var body struct {
+		Data []struct {
+			ID      string `json:"id"`
+			Created int64  `json:"created"`
+			OwnedBy string `json:"owned_by"`
+		} `json:"data"`
+	}
+	if err := getJSON(ctx, o.client, o.name, joinURL(o.baseURL, "/models"), o.header(), &body); err != nil {
+		return nil, err
+	}
+
+	models := make([]Model, 0, len(body.Data))
+	for _, m := range body.Data {
+		model := Model{ID: m.ID, Description: m.OwnedBy}
+		if m.Created > 0 {
+			model.Created = time.Unix(m.Created, 0)
+		}
+		models = append(models, model)
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].ID < models[j].ID })
+	return models, nil
+}
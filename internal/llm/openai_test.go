@@ -0,0 +1,202 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpenAIComplete(t *testing.T) {
+	var got openAIRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat/completions" {
+			t.Errorf("path = %s, want /chat/completions", r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer test-key" {
+			t.Errorf("Authorization = %q", auth)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decoding request: %v", err)
+		}
+		fmt.Fprint(w, `{
+			"model": "gpt-test-0601",
+			"choices": [{"message": {"role": "assistant", "content": "Hi there"}, "finish_reason": "stop"}],
+			"usage": {"prompt_tokens": 9, "completion_tokens": 2, "total_tokens": 11}
+		}`)
+	}))
+	defer srv.Close()
+
+	p := NewOpenAI("test-key", "gpt-test", srv.URL, srv.Client())
+	resp, err := p.Complete(context.Background(), testRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Model != "gpt-test" || got.MaxTokens != 0 || got.Stream || got.StreamOptions != nil {
+		t.Errorf("request = %+v", got)
+	}
+	wantMessages := []Message{{Role: "system", Content: "Be brief."}, {Role: RoleUser, Content: "Hello"}}
+	if fmt.Sprint(got.Messages) != fmt.Sprint(wantMessages) {
+		t.Errorf("messages = %v, want %v", got.Messages, wantMessages)
+	}
+	want := Response{Provider: "openai", Model: "gpt-test-0601", Content: "Hi there", StopReason: "stop", Usage: Usage{InputTokens: 9, OutputTokens: 2}}
+	if *resp != want {
+		t.Errorf("response = %+v, want %+v", *resp, want)
+	}
+}
+
+func TestOpenAICompleteNoChoices(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"model": "gpt-test", "choices": []}`)
+	}))
+	defer srv.Close()
+
+	p := NewOpenAI("test-key", "gpt-test", srv.URL, srv.Client())
+	if _, err := p.Complete(context.Background(), testRequest()); err == nil {
+		t.Error("expected an error for a response without choices")
+	}
+}
+
+func TestOpenAIStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openAIRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if !req.Stream || req.StreamOptions == nil || !req.StreamOptions.IncludeUsage {
+			t.Errorf("request = %+v, want stream with usage", req)
+		}
+		writeSSE(w,
+			`data: {"model":"gpt-test-0601","choices":[{"delta":{"role":"assistant"}}]}`,
+			`data: {"model":"gpt-test-0601","choices":[{"delta":{"content":"Hello"}}]}`,
+			`data: {"model":"gpt-test-0601","choices":[{"delta":{"content":", world"}}]}`,
+			`data: {"model":"gpt-test-0601","choices":[{"delta":{},"finish_reason":"stop"}]}`,
+			`data: {"model":"gpt-test-0601","choices":[],"usage":{"prompt_tokens":9,"completion_tokens":4}}`,
+			`data: [DONE]`,
+		)
+	}))
+	defer srv.Close()
+
+	p := NewOpenAI("test-key", "gpt-test", srv.URL, srv.Client())
+	var pieces []string
+	resp, err := p.Stream(context.Background(), testRequest(), func(text string) error {
+		pieces = append(pieces, text)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(pieces, "|") != "Hello|, world" {
+		t.Errorf("pieces = %q", pieces)
+	}
+	want := Response{Provider: "openai", Model: "gpt-test-0601", Content: "Hello, world", StopReason: "stop", Usage: Usage{InputTokens: 9, OutputTokens: 4}}
+	if *resp != want {
+		t.Errorf("response = %+v, want %+v", *resp, want)
+	}
+}
+
+func TestOpenAICompatibleStreamOptions(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		if _, ok := body["stream_options"]; ok {
+			t.Error("stream_options sent to a compatible server")
+		}
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			t.Errorf("Authorization = %q, want none without a key", auth)
+		}
+		writeSSE(w, `data: {"choices":[{"delta":{"content":"ok"}}]}`, `data: [DONE]`)
+	}))
+	defer srv.Close()
+
+	p := NewOpenAICompatible("", "local", srv.URL, srv.Client())
+	resp, err := p.Stream(context.Background(), testRequest(), func(string) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Content != "ok" {
+		t.Errorf("content = %q, want ok", resp.Content)
+	}
+}
+
+func TestOpenAIStreamError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeSSE(w,
+			`data: {"choices":[{"delta":{"content":"Hel"}}]}`,
+			`data: {"error":{"type":"server_error","message":"The server had an error"}}`,
+		)
+	}))
+	defer srv.Close()
+
+	p := NewOpenAI("test-key", "gpt-test", srv.URL, srv.Client())
+	_, err := p.Stream(context.Background(), testRequest(), func(string) error { return nil })
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("err = %v, want *APIError", err)
+	}
+	if apiErr.Provider != "openai" || apiErr.Type != "server_error" || apiErr.Message != "The server had an error" {
+		t.Errorf("err = %+v", apiErr)
+	}
+}
+
+func TestOpenAICountTokens(t *testing.T) {
+	p := NewOpenAI("test-key", "gpt-test", "http://127.0.0.1:0", nil)
+	n, err := p.CountTokens(context.Background(), testRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := estimateRequest(testRequest()); n != want || n == 0 {
+		t.Errorf("tokens = %d, want estimate %d", n, want)
+	}
+}
+
+func TestOpenAICompatibleListModels(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/models" {
+			t.Errorf("request = %s %s, want GET /models", r.Method, r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer local-key" {
+			t.Errorf("Authorization = %q", auth)
+		}
+		fmt.Fprint(w, `{"object": "list", "data": [
+			{"id": "qwen2.5-coder-7b", "object": "model", "owned_by": "vllm"},
+			{"id": "llama-3.1-8b", "object": "model", "created": 1727000000, "owned_by": "vllm"}
+		]}`)
+	}))
+	defer srv.Close()
+
+	p := NewOpenAICompatible("local-key", "qwen2.5-coder-7b", srv.URL, srv.Client())
+	models, err := p.ListModels(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Model{
+		{ID: "llama-3.1-8b", Description: "vllm", Created: time.Unix(1727000000, 0)},
+		{ID: "qwen2.5-coder-7b", Description: "vllm"},
+	}
+	if fmt.Sprint(models) != fmt.Sprint(want) {
+		t.Errorf("models = %+v, want %+v", models, want)
+	}
+}
+
+func TestOpenAICompatibleListModelsError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	p := NewOpenAICompatible("", "local", srv.URL, srv.Client())
+	_, err := p.ListModels(context.Background())
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Provider != "openai-compatible" || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("err = %v, want a 404 from openai-compatible", err)
+	}
+}
@@ -0,0 +1,288 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/amenophis1er/mktools/internal/config"
+)
+
+// RetryPolicy controls how transient failures are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts including the first one.
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// Logf, when set, is told about each retry and fallback.
+	Logf func(format string, args ...any)
+}
+
+// DefaultRetryPolicy is used for settings missing from the configuration.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: time.Second,
+	MaxBackoff:     30 * time.Second,
+}
+
+// NewRetryPolicy builds a policy from the configuration.
+func NewRetryPolicy(cfg config.RetryConfig) (RetryPolicy, error) {
+	policy := DefaultRetryPolicy
+	if cfg.MaxAttempts > 0 {
+		policy.MaxAttempts = cfg.MaxAttempts
+	}
+	if cfg.InitialBackoff != "" {
+		d, err := time.ParseDuration(cfg.InitialBackoff)
+		if err != nil {
+			return RetryPolicy{}, fmt.Errorf("invalid retry initial_backoff: %w", err)
+		}
+		policy.InitialBackoff = d
+	}
+	if cfg.MaxBackoff != "" {
+		d, err := time.ParseDuration(cfg.MaxBackoff)
+		if err != nil {
+			return RetryPolicy{}, fmt.Errorf("invalid retry max_backoff: %w", err)
+		}
+		policy.MaxBackoff = d
+	}
+	return policy, nil
+}
+
+// backoff returns the wait before the given retry (1 for the first one):
+// exponential, capped at MaxBackoff, with jitter over its upper half so
+// concurrent clients spread out.
+func (r RetryPolicy) backoff(retry int) time.Duration {
+	wait := r.InitialBackoff
+	for i := 1; i < retry && wait < r.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > r.MaxBackoff {
+		wait = r.MaxBackoff
+	}
+	if wait <= 0 {
+		return 0
+	}
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+func (r RetryPolicy) logf(format string, args ...any) {
+	if r.Logf != nil {
+		r.Logf(format, args...)
+	}
+}
+
+// Temporary reports whether err is worth retrying: rate limits, overloads,
+// server errors and failed connections. Cancellation and client errors such
+// as a bad API key are not.
+func Temporary(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		var reqErr *requestError
+		return errors.As(err, &reqErr)
+	}
+
+	switch {
+	case apiErr.StatusCode == http.StatusRequestTimeout,
+		apiErr.StatusCode == http.StatusTooManyRequests,
+		apiErr.StatusCode >= 500:
+		return true
+	case apiErr.StatusCode == 0:
+		// Errors reported in the middle of a stream
+		switch apiErr.Type {
+		case "overloaded_error", "rate_limit_error", "api_error", "server_error":
+			return true
+		}
+	}
+	return false
+}
+
+// retryAfter parses a Retry-After header, in seconds or as an HTTP date, or
+// the retry-after-ms header some providers send instead.
+func retryAfter(h http.Header) time.Duration {
+	if ms, err := strconv.ParseFloat(h.Get("Retry-After-Ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	value := h.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseFloat(value, 64); err == nil && secs > 0 {
+		return time.Duration(secs * float64(time.Second))
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// WithRetry wraps p so transient failures are retried according to policy.
+func WithRetry(p Provider, policy RetryPolicy) Provider {
+	if policy.MaxAttempts <= 1 {
+		return p
+	}
+	return &retryProvider{Provider: p, policy: policy}
+}
+
+type retryProvider struct {
+	Provider
+	policy RetryPolicy
+}
+
+// do runs call until it succeeds, fails permanently or runs out of
+// attempts. A Retry-After longer than MaxBackoff ends the retries early, so
+// a fallback provider can take over instead of waiting.
+func (r *retryProvider) do(ctx context.Context, call func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := call()
+		if err == nil || !Temporary(err) || attempt >= r.policy.MaxAttempts {
+			return err
+		}
+
+		wait := r.policy.backoff(attempt)
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+			if apiErr.RetryAfter > r.policy.MaxBackoff {
+				return err
+			}
+			wait = apiErr.RetryAfter
+		}
+
+		r.policy.logf("%v; retrying in %s (attempt %d of %d)\n", err, wait.Round(100*time.Millisecond), attempt+1, r.policy.MaxAttempts)
+		if err := sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *retryProvider) Complete(ctx context.Context, req *Request) (*Response, error) {
+	var resp *Response
+	err := r.do(ctx, func() error {
+		var err error
+		resp, err = r.Provider.Complete(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+// Stream retries only until the first text has been passed to fn, since
+// what was already shown can't be taken back.
+func (r *retryProvider) Stream(ctx context.Context, req *Request, fn func(text string) error) (*Response, error) {
+	started := false
+	var resp *Response
+	err := r.do(ctx, func() error {
+		var err error
+		resp, err = r.Provider.Stream(ctx, req, func(text string) error {
+			started = true
+			return fn(text)
+		})
+		if err != nil && started {
+			return &streamError{err}
+		}
+		return err
+	})
+	var se *streamError
+	if errors.As(err, &se) {
+		err = se.err
+	}
+	return resp, err
+}
+
+func (r *retryProvider) CountTokens(ctx context.Context, req *Request) (int, error) {
+	var n int
+	err := r.do(ctx, func() error {
+		var err error
+		n, err = r.Provider.CountTokens(ctx, req)
+		return err
+	})
+	return n, err
+}
+
+func (r *retryProvider) Unwrap() Provider {
+	return r.Provider
+}
+
+// streamError marks a failure after part of a reply was streamed, which
+// must not be retried.
+type streamError struct {
+	err error
+}
+
+func (e *streamError) Error() string {
+	return e.err.Error()
+}
+
+// WithFallback returns a provider that uses fallback when primary fails with
+// a transient error. The fallback always uses its own configured model.
+func WithFallback(primary, fallback Provider, policy RetryPolicy) Provider {
+	return &fallbackProvider{Provider: primary, fallback: fallback, policy: policy}
+}
+
+type fallbackProvider struct {
+	Provider
+	fallback Provider
+	policy   RetryPolicy
+}
+
+func (f *fallbackProvider) use(err error) bool {
+	if !Temporary(err) {
+		return false
+	}
+	f.policy.logf("%v; falling back to %s\n", err, f.fallback.Name())
+	return true
+}
+
+func fallbackRequest(req *Request) *Request {
+	fb := *req
+	fb.Model = ""
+	return &fb
+}
+
+func (f *fallbackProvider) Complete(ctx context.Context, req *Request) (*Response, error) {
+	resp, err := f.Provider.Complete(ctx, req)
+	if err != nil && f.use(err) {
+		return f.fallback.Complete(ctx, fallbackRequest(req))
+	}
+	return resp, err
+}
+
+func (f *fallbackProvider) Stream(ctx context.Context, req *Request, fn func(text string) error) (*Response, error) {
+	started := false
+	resp, err := f.Provider.Stream(ctx, req, func(text string) error {
+		started = true
+		return fn(text)
+	})
+	if err != nil && !started && f.use(err) {
+		return f.fallback.Stream(ctx, fallbackRequest(req), fn)
+	}
+	return resp, err
+}
+
+func (f *fallbackProvider) CountTokens(ctx context.Context, req *Request) (int, error) {
+	return f.Provider.CountTokens(ctx, req)
+}
+
+func (f *fallbackProvider) Unwrap() Provider {
+	return f.Provider
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
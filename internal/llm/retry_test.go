@@ -0,0 +1,196 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// noWait retries immediately.
+var noWait = RetryPolicy{MaxAttempts: 3}
+
+func TestRetryComplete(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(529)
+			fmt.Fprint(w, `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"model":"claude-test","content":[{"type":"text","text":"ok"}]}`)
+	}))
+	defer srv.Close()
+
+	p := WithRetry(NewAnthropic("test-key", "claude-test", srv.URL, srv.Client()), noWait)
+	resp, err := p.Complete(context.Background(), testRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Content != "ok" || calls.Load() != 2 {
+		t.Errorf("content = %q after %d calls, want ok after 2", resp.Content, calls.Load())
+	}
+}
+
+func TestRetryPermanentError(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"type":"error","error":{"type":"invalid_request_error","message":"bad"}}`)
+	}))
+	defer srv.Close()
+
+	p := WithRetry(NewAnthropic("test-key", "claude-test", srv.URL, srv.Client()), noWait)
+	if _, err := p.Complete(context.Background(), testRequest()); err == nil {
+		t.Fatal("expected an error")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("calls = %d, want 1", calls.Load())
+	}
+}
+
+func TestRetryLongRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	policy := noWait
+	policy.MaxBackoff = DefaultRetryPolicy.MaxBackoff
+	p := WithRetry(NewOpenAI("test-key", "gpt-test", srv.URL, srv.Client()), policy)
+	if _, err := p.Complete(context.Background(), testRequest()); err == nil {
+		t.Fatal("expected an error")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("calls = %d, want 1 when Retry-After exceeds the maximum backoff", calls.Load())
+	}
+}
+
+func TestRetryStreamBeforeOutput(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			writeSSE(w, "event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}")
+			return
+		}
+		writeSSE(w,
+			"event: content_block_delta\ndata: {\"delta\":{\"type\":\"text_delta\",\"text\":\"ok\"}}",
+			"event: message_stop\ndata: {}",
+		)
+	}))
+	defer srv.Close()
+
+	p := WithRetry(NewAnthropic("test-key", "claude-test", srv.URL, srv.Client()), noWait)
+	var out string
+	resp, err := p.Stream(context.Background(), testRequest(), func(text string) error {
+		out += text
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "ok" || resp.Content != "ok" || calls.Load() != 2 {
+		t.Errorf("output = %q, content = %q after %d calls", out, resp.Content, calls.Load())
+	}
+}
+
+func TestRetryStreamAfterOutput(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		writeSSE(w,
+			"event: content_block_delta\ndata: {\"delta\":{\"type\":\"text_delta\",\"text\":\"Hel\"}}",
+			"event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}",
+		)
+	}))
+	defer srv.Close()
+
+	p := WithRetry(NewAnthropic("test-key", "claude-test", srv.URL, srv.Client()), noWait)
+	var out string
+	_, err := p.Stream(context.Background(), testRequest(), func(text string) error {
+		out += text
+		return nil
+	})
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Type != "overloaded_error" {
+		t.Fatalf("err = %v, want the overloaded error", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("calls = %d, want 1: a stream must not be retried once text was shown", calls.Load())
+	}
+	if out != "Hel" {
+		t.Errorf("output = %q, want the text sent before the failure only", out)
+	}
+}
+
+func TestFallbackStreamAfterOutput(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeSSE(w,
+			"event: content_block_delta\ndata: {\"delta\":{\"type\":\"text_delta\",\"text\":\"Hel\"}}",
+			"event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}",
+		)
+	}))
+	defer primary.Close()
+
+	var fallbackCalls atomic.Int32
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fallbackCalls.Add(1)
+		writeSSE(w, `data: {"choices":[{"delta":{"content":"Hello"}}]}`, `data: [DONE]`)
+	}))
+	defer fallback.Close()
+
+	p := WithFallback(
+		NewAnthropic("test-key", "claude-test", primary.URL, primary.Client()),
+		NewOpenAI("test-key", "gpt-test", fallback.URL, fallback.Client()),
+		noWait,
+	)
+	if _, err := p.Stream(context.Background(), testRequest(), func(string) error { return nil }); err == nil {
+		t.Fatal("expected the primary's error")
+	}
+	if fallbackCalls.Load() != 0 {
+		t.Error("fallback used after part of the reply was streamed")
+	}
+}
+
+func TestFallbackComplete(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+
+	var model string
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openAIRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		model = req.Model
+		fmt.Fprint(w, `{"model":"gpt-test","choices":[{"message":{"content":"from fallback"}}]}`)
+	}))
+	defer fallback.Close()
+
+	p := WithFallback(
+		NewAnthropic("test-key", "claude-test", primary.URL, primary.Client()),
+		NewOpenAI("test-key", "gpt-test", fallback.URL, fallback.Client()),
+		noWait,
+	)
+	req := testRequest()
+	req.Model = "claude-override"
+	resp, err := p.Complete(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Content != "from fallback" {
+		t.Errorf("content = %q", resp.Content)
+	}
+	if model != "gpt-test" {
+		t.Errorf("fallback model = %q, want its own configured model", model)
+	}
+}
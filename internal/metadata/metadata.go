@@ -5,20 +5,77 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"io"
-	"os"
-	"path/filepath"
 	"sort"
 	"strings"
 	"time"
+
+	"github.com/amenophis1er/mktools/internal/collect"
+	"github.com/amenophis1er/mktools/version"
 )
 
+// Metadata is the JSON block at the top of every context file. Its layout is
+// versioned by SchemaVersion; see migrate.go for how older layouts are read.
 type Metadata struct {
-	GeneratedBy    string            `json:"generated_by"`
-	GeneratedAt    time.Time         `json:"generated_at"`
-	Version        string            `json:"version"`
-	ChecksumSource string            `json:"checksum_source"`
-	FileChecksums  map[string]string `json:"file_checksums"`
+	SchemaVersion      int                 `json:"schema_version"`
+	GeneratedBy        string              `json:"generated_by"`
+	GeneratedAt        time.Time           `json:"generated_at"`
+	ToolVersion        string              `json:"tool_version"`
+	Root               string              `json:"root,omitempty"`
+	GitHead            string              `json:"git_head,omitempty"`
+	Options            *Options            `json:"options,omitempty"`
+	OptionsFingerprint string              `json:"options_fingerprint,omitempty"`
+	ChecksumSource     string              `json:"checksum_source"`
+	FileChecksums      map[string]string   `json:"file_checksums"`
+	Files              map[string]FileInfo `json:"files,omitempty"`
+	Collector          *collect.Options    `json:"collector,omitempty"`
+	BodyChecksum       string              `json:"body_checksum,omitempty"`
+	Signature          *Signature          `json:"signature,omitempty"`
+
+	// raw is the JSON the metadata was parsed from, which its signature
+	// covers
+	raw []byte
+}
+
+// Options are the generation settings that shape a context's content. Two
+// runs with the same options over the same files produce the same context.
+// Revision and Archive name the tree a context was built from when it isn't
+// the working copy, so such a context never stands in for one that is.
+type Options struct {
+	Revision         string   `json:"revision,omitempty"`
+	Archive          string   `json:"archive,omitempty"`
+	Format           string   `json:"format"`
+	IncludeStructure bool     `json:"include_structure"`
+	IncludeContent   bool     `json:"include_content"`
+	Source           string   `json:"source"`
+	IncludeUntracked bool     `json:"include_untracked,omitempty"`
+	IgnorePatterns   []string `json:"ignore_patterns"`
+	MaxFileSize      string   `json:"max_file_size"`
+	MaxFiles         int      `json:"max_files,omitempty"`
+	SectionFormat    string   `json:"section_format"`
+	Signed           bool     `json:"signed,omitempty"`
+}
+
+// Fingerprint returns a stable hash of the options.
+func (o Options) Fingerprint() string {
+	data, err := json.Marshal(o)
+	if err != nil {
+		return ""
+	}
+	return checksum(string(data))
+}
+
+// FileInfo is the size and modification time of a file when the context
+// was generated, used to skip rehashing unchanged files.
+type FileInfo struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Changes lists the files that differ between a context and its source.
+type Changes struct {
+	Added    []string `json:"added,omitempty"`
+	Modified []string `json:"modified,omitempty"`
+	Removed  []string `json:"removed,omitempty"`
 }
 
 const MetadataMarker = "<!-- MKTOOLS-CONTEXT"
@@ -26,13 +83,20 @@ const MetadataEndMarker = "MKTOOLS-CONTEXT -->"
 
 func New() *Metadata {
 	return &Metadata{
+		SchemaVersion: SchemaVersion,
 		GeneratedBy:   "mktools",
 		GeneratedAt:   time.Now(),
-		Version:       "0.1.0", // TODO: get from version package
+		ToolVersion:   version.Version,
 		FileChecksums: make(map[string]string),
 	}
 }
 
+// SetOptions records the generation options and their fingerprint.
+func (m *Metadata) SetOptions(opts Options) {
+	m.Options = &opts
+	m.OptionsFingerprint = opts.Fingerprint()
+}
+
 // CalculateSourceChecksum generates a checksum for all source files
 func (m *Metadata) CalculateSourceChecksum(files map[string]string) error {
 	// Sort files by path for consistent checksums
@@ -48,8 +112,7 @@ func (m *Metadata) CalculateSourceChecksum(files map[string]string) error {
 		content := files[path]
 
 		// Calculate individual file checksum
-		fileHash := sha256.Sum256([]byte(content))
-		m.FileChecksums[path] = hex.EncodeToString(fileHash[:])
+		m.FileChecksums[path] = checksum(content)
 
 		// Add to global checksum
 		fmt.Fprintf(h, "%s:%s\n", path, content)
@@ -59,60 +122,97 @@ func (m *Metadata) CalculateSourceChecksum(files map[string]string) error {
 	return nil
 }
 
-// HasSourceChanged checks if source files have changed compared to stored metadata
-func (m *Metadata) HasSourceChanged(root string) (bool, error) {
-	for path, storedChecksum := range m.FileChecksums {
-		fullPath := filepath.Join(root, path)
-
-		// Check if file still exists
-		content, err := os.ReadFile(fullPath)
-		if err != nil {
-			if os.IsNotExist(err) {
-				return true, nil // File was deleted
-			}
-			return false, fmt.Errorf("error reading file %s: %w", path, err)
-		}
+// RecordFiles stores the collector settings and file stats a context was
+// generated with, so SourceChanges can later recompute the same file set.
+func (m *Metadata) RecordFiles(opts collect.Options, entries map[string]collect.Entry) {
+	m.Collector = &opts
+	m.Files = make(map[string]FileInfo, len(entries))
+	for path, e := range entries {
+		m.Files[path] = FileInfo{Size: e.Size, ModTime: e.ModTime}
+	}
+}
 
-		// Calculate current checksum
-		currentHash := sha256.Sum256(content)
-		currentChecksum := hex.EncodeToString(currentHash[:])
+// SourceChanges compares the files under root with the ones the context was
+// generated from. It reruns the recorded collector settings, so ignored files
+// never count as new, and only rehashes files whose size or modification
+// time differ from the recorded ones.
+func (m *Metadata) SourceChanges(root string) (*Changes, error) {
+	if m.Collector == nil {
+		return nil, fmt.Errorf("context has no recorded collector settings")
+	}
 
-		if currentChecksum != storedChecksum {
-			return true, nil // File was modified
-		}
+	c, err := collect.New(collect.Open(root, *m.Collector), *m.Collector)
+	if err != nil {
+		return nil, err
 	}
 
-	// Check for new files
-	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	changes := &Changes{}
+	seen := make(map[string]bool)
+	_, err = c.Walk(func(e collect.Entry) (bool, error) {
+		storedChecksum, known := m.FileChecksums[e.Path]
+
+		// Fast path: same size and modification time
+		if info, ok := m.Files[e.Path]; known && ok && info.Size == e.Size && info.ModTime.Equal(e.ModTime) {
+			seen[e.Path] = true
+			return true, nil
 		}
 
-		if info.IsDir() {
-			return nil
+		content, ok := c.Read(e)
+		if !ok {
+			return false, nil
 		}
+		seen[e.Path] = true
 
-		relPath, err := filepath.Rel(root, path)
-		if err != nil {
-			return err
+		switch {
+		case !known:
+			changes.Added = append(changes.Added, e.Path)
+		case checksum(content) != storedChecksum:
+			changes.Modified = append(changes.Modified, e.Path)
 		}
+		return true, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking directory: %w", err)
+	}
 
-		// If we find a file that's not in our checksums, source has changed
-		if _, exists := m.FileChecksums[relPath]; !exists {
-			return io.EOF // Use EOF as sentinel to stop walking
+	for path := range m.FileChecksums {
+		if !seen[path] {
+			changes.Removed = append(changes.Removed, path)
 		}
+	}
 
-		return nil
-	})
+	sort.Strings(changes.Added)
+	sort.Strings(changes.Modified)
+	sort.Strings(changes.Removed)
+	return changes, nil
+}
+
+// Empty reports whether there are no changes.
+func (c *Changes) Empty() bool {
+	return len(c.Added)+len(c.Modified)+len(c.Removed) == 0
+}
 
-	if err == io.EOF {
-		return true, nil // New file found
+// Summary returns a short description such as "2 added, 1 modified".
+func (c *Changes) Summary() string {
+	var parts []string
+	if n := len(c.Added); n > 0 {
+		parts = append(parts, fmt.Sprintf("%d added", n))
 	}
-	if err != nil {
-		return false, fmt.Errorf("error walking directory: %w", err)
+	if n := len(c.Modified); n > 0 {
+		parts = append(parts, fmt.Sprintf("%d modified", n))
+	}
+	if n := len(c.Removed); n > 0 {
+		parts = append(parts, fmt.Sprintf("%d removed", n))
 	}
+	if len(parts) == 0 {
+		return "no changes"
+	}
+	return strings.Join(parts, ", ")
+}
 
-	return false, nil
+func checksum(content string) string {
+	hash := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(hash[:])
 }
 
 // String returns a formatted string representation of the metadata
@@ -120,11 +220,11 @@ func (m *Metadata) String() string {
 	data, err := json.MarshalIndent(m, "", "  ")
 	if err != nil {
 		// Fallback to simple format if JSON marshaling fails
-		return fmt.Sprintf("%s\ngenerated_by: %s\ngenerated_at: %s\nversion: %s\nchecksum: %s\n%s",
+		return fmt.Sprintf("%s\ngenerated_by: %s\ngenerated_at: %s\ntool_version: %s\nchecksum: %s\n%s",
 			MetadataMarker,
 			m.GeneratedBy,
 			m.GeneratedAt.Format(time.RFC3339),
-			m.Version,
+			m.ToolVersion,
 			m.ChecksumSource,
 			MetadataEndMarker)
 	}
@@ -145,10 +245,32 @@ func ParseFromContent(content string) (*Metadata, error) {
 	jsonData := content[start+len(MetadataMarker) : end]
 	jsonData = strings.TrimSpace(jsonData)
 
-	var metadata Metadata
-	if err := json.Unmarshal([]byte(jsonData), &metadata); err != nil {
-		return nil, fmt.Errorf("error parsing metadata JSON: %w", err)
+	return decode([]byte(jsonData))
+}
+
+// Body returns the text following the metadata block, the part of a context
+// file covered by BodyChecksum.
+func Body(content string) (string, bool) {
+	end := strings.Index(content, MetadataEndMarker)
+	if end == -1 {
+		return "", false
 	}
+	return content[end+len(MetadataEndMarker):], true
+}
+
+// VerifyBody reports whether body matches the recorded BodyChecksum. It is
+// false when no checksum was recorded.
+func (m *Metadata) VerifyBody(body string) bool {
+	return m.BodyChecksum != "" && checksum(body) == m.BodyChecksum
+}
 
-	return &metadata, nil
+// Strip returns content without its metadata block, which is of no use to a
+// model reading the context.
+func Strip(content string) string {
+	start := strings.Index(content, MetadataMarker)
+	body, ok := Body(content)
+	if start == -1 || !ok {
+		return content
+	}
+	return content[:start] + strings.TrimLeft(body, "\n")
 }
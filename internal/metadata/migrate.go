@@ -0,0 +1,79 @@
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// SchemaVersion is the metadata layout written by this version of mktools.
+//
+// History:
+//
+//	1: original layout, without a schema_version field. The tool version was
+//	   stored as "version".
+//	2: adds schema_version, root, git_head, options and per-file sizes;
+//	   "version" is renamed to "tool_version".
+//
+// Optional fields that older readers can ignore, such as body_checksum and
+// signature, are added without a version bump.
+const SchemaVersion = 2
+
+// migrations upgrade raw metadata from the schema version they are keyed by
+// to the next one.
+var migrations = map[int]func(raw map[string]json.RawMessage) error{
+	1: migrateV1,
+}
+
+// decode parses metadata JSON of any known schema version, upgrading it to
+// the current layout.
+func decode(data []byte) (*Metadata, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("error parsing metadata JSON: %w", err)
+	}
+
+	schema := 1
+	if v, ok := raw["schema_version"]; ok {
+		if err := json.Unmarshal(v, &schema); err != nil {
+			return nil, fmt.Errorf("invalid schema_version: %w", err)
+		}
+	}
+	if schema > SchemaVersion {
+		return nil, fmt.Errorf("metadata schema version %d is newer than supported version %d; upgrade mktools", schema, SchemaVersion)
+	}
+
+	for ; schema < SchemaVersion; schema++ {
+		migrate, ok := migrations[schema]
+		if !ok {
+			return nil, fmt.Errorf("no migration from metadata schema version %d", schema)
+		}
+		if err := migrate(raw); err != nil {
+			return nil, fmt.Errorf("error migrating metadata from schema version %d: %w", schema, err)
+		}
+	}
+	raw["schema_version"] = json.RawMessage(fmt.Sprint(SchemaVersion))
+
+	upgraded, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata Metadata
+	if err := json.Unmarshal(upgraded, &metadata); err != nil {
+		return nil, fmt.Errorf("error parsing metadata JSON: %w", err)
+	}
+	if metadata.FileChecksums == nil {
+		metadata.FileChecksums = make(map[string]string)
+	}
+	metadata.raw = data
+
+	return &metadata, nil
+}
+
+func migrateV1(raw map[string]json.RawMessage) error {
+	if v, ok := raw["version"]; ok {
+		raw["tool_version"] = v
+		delete(raw, "version")
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+package metadata
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"strings"
+)
+
+// SignatureAlgorithm is the only signature algorithm mktools produces.
+const SignatureAlgorithm = "ed25519"
+
+// Signature is a detached signature over the metadata block. Because the
+// block records BodyChecksum and the per-file checksums, it covers the whole
+// context file.
+type Signature struct {
+	Algorithm string `json:"algorithm"`
+	PublicKey string `json:"public_key"`
+	Value     string `json:"value"`
+}
+
+// ErrUnsigned is returned by VerifySignature for metadata without a signature.
+var ErrUnsigned = errors.New("context is not signed")
+
+// SetBody records the checksum of the text that follows the metadata block.
+func (m *Metadata) SetBody(body string) {
+	m.BodyChecksum = checksum(body)
+}
+
+// BodyHash returns a hash for a body that is written out in pieces rather
+// than held in one string. Write the whole body to it, then record it with
+// SetBodyHash.
+func BodyHash() hash.Hash {
+	return sha256.New()
+}
+
+// SetBodyHash records the checksum of the body written to h, which must come
+// from BodyHash.
+func (m *Metadata) SetBodyHash(h hash.Hash) {
+	m.BodyChecksum = hex.EncodeToString(h.Sum(nil))
+}
+
+// Sign signs the metadata with key, replacing any previous signature.
+func (m *Metadata) Sign(key ed25519.PrivateKey) error {
+	// Sign what will be written, not what was read
+	m.raw = nil
+	payload, err := m.signedPayload()
+	if err != nil {
+		return err
+	}
+	pub := key.Public().(ed25519.PublicKey)
+	m.Signature = &Signature{
+		Algorithm: SignatureAlgorithm,
+		PublicKey: base64.StdEncoding.EncodeToString(pub),
+		Value:     base64.StdEncoding.EncodeToString(ed25519.Sign(key, payload)),
+	}
+	return nil
+}
+
+// VerifySignature checks the signature against trusted, or against the
+// embedded public key when trusted is nil. The latter only proves the
+// metadata was not altered after signing, not who signed it.
+func (m *Metadata) VerifySignature(trusted ed25519.PublicKey) error {
+	if m.Signature == nil {
+		return ErrUnsigned
+	}
+	if m.Signature.Algorithm != SignatureAlgorithm {
+		return fmt.Errorf("unsupported signature algorithm: %s", m.Signature.Algorithm)
+	}
+
+	embedded, err := base64.StdEncoding.DecodeString(m.Signature.PublicKey)
+	if err != nil || len(embedded) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid public key in signature")
+	}
+	key := ed25519.PublicKey(embedded)
+	if trusted != nil {
+		if !trusted.Equal(key) {
+			return fmt.Errorf("context was signed with key %s, not the trusted key %s", KeyFingerprint(key), KeyFingerprint(trusted))
+		}
+		key = trusted
+	}
+
+	value, err := base64.StdEncoding.DecodeString(m.Signature.Value)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %w", err)
+	}
+	payload, err := m.signedPayload()
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(key, payload, value) {
+		return fmt.Errorf("signature does not match metadata")
+	}
+	return nil
+}
+
+// SignerKey returns the public key embedded in the signature.
+func (m *Metadata) SignerKey() (ed25519.PublicKey, error) {
+	if m.Signature == nil {
+		return nil, ErrUnsigned
+	}
+	key, err := base64.StdEncoding.DecodeString(m.Signature.PublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key in signature")
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// signedPayload is the metadata block without its signature, in compact
+// JSON. Metadata read from a file is taken from the bytes as written, so
+// fields this version doesn't know are covered too and contexts signed by
+// newer versions still verify. Otherwise it is taken from the encoding
+// String is about to write.
+func (m *Metadata) signedPayload() ([]byte, error) {
+	data := m.raw
+	if data == nil {
+		var err error
+		data, err = json.Marshal(m)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding metadata: %w", err)
+		}
+	}
+	return withoutSignature(data)
+}
+
+// withoutSignature returns the JSON object in data, compacted, with its
+// top-level "signature" member removed. The other members keep their order
+// and encoding.
+func withoutSignature(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, fmt.Errorf("metadata is not a JSON object")
+	}
+
+	var out bytes.Buffer
+	out.WriteByte('{')
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("error reading metadata: %w", err)
+		}
+		key, _ := tok.(string)
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, fmt.Errorf("error reading metadata: %w", err)
+		}
+		if key == "signature" {
+			continue
+		}
+
+		if out.Len() > 1 {
+			out.WriteByte(',')
+		}
+		encodedKey, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(encodedKey)
+		out.WriteByte(':')
+		if err := json.Compact(&out, value); err != nil {
+			return nil, fmt.Errorf("error reading metadata: %w", err)
+		}
+	}
+	out.WriteByte('}')
+	return out.Bytes(), nil
+}
+
+// KeyFingerprint returns a short, printable identifier for a public key.
+func KeyFingerprint(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// LoadSigningKey reads an ed25519 private key from a PKCS#8 PEM file, as
+// written by `openssl genpkey -algorithm ed25519` or GenerateKeyFiles.
+func LoadSigningKey(path string) (ed25519.PrivateKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing private key %s: %w", path, err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an ed25519 private key", path)
+	}
+	return key, nil
+}
+
+// LoadPublicKey reads an ed25519 public key from a PEM file. A private key
+// file is accepted too, in which case its public half is returned.
+func LoadPublicKey(path string) (ed25519.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.Contains(block.Type, "PRIVATE KEY") {
+		key, err := LoadSigningKey(path)
+		if err != nil {
+			return nil, err
+		}
+		return key.Public().(ed25519.PublicKey), nil
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing public key %s: %w", path, err)
+	}
+	key, ok := parsed.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an ed25519 public key", path)
+	}
+	return key, nil
+}
+
+// GenerateKeyFiles creates a new ed25519 key pair, writing the private key
+// to path and the public key to path + ".pub". Existing files are kept.
+func GenerateKeyFiles(path string) (ed25519.PublicKey, error) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		return nil, fmt.Errorf("error generating key: %w", err)
+	}
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeNewFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}), 0600); err != nil {
+		return nil, err
+	}
+	if err := writeNewFile(path+".pub", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0644); err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	return pub, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not a PEM file", path)
+	}
+	return block, nil
+}
+
+func writeNewFile(path string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %w", path, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	return f.Close()
+}
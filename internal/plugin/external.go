@@ -0,0 +1,181 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/amenophis1er/mktools/internal/config"
+	"github.com/amenophis1er/mktools/internal/home"
+	"github.com/amenophis1er/mktools/version"
+	"github.com/spf13/cobra"
+)
+
+// ExternalPrefix starts the name of executables run as plugins: mktools-foo
+// provides "mktools foo".
+const ExternalPrefix = "mktools-"
+
+// ExternalDir returns the directory searched for plugins before PATH,
+// ~/.config/mktools/plugins.
+func ExternalDir() string {
+	return filepath.Join(home.Dir(), ".config", "mktools", "plugins")
+}
+
+// ExternalPlugin runs an mktools-<name> executable. Its arguments, flags
+// included, are passed through untouched, and the merged configuration,
+// without API keys, is given to it as JSON in MKTOOLS_CONFIG_JSON.
+type ExternalPlugin struct {
+	name   string
+	path   string
+	config *config.Config
+}
+
+// ExitError reports that an external plugin exited with a non-zero status.
+// The plugin has reported the failure itself, so only the status is kept.
+type ExitError struct {
+	Name string
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("plugin %s exited with status %d", e.Name, e.Code)
+}
+
+// DiscoverExternal returns the plugins found in ExternalDir and on PATH,
+// sorted by name. When several executables provide the same name, the
+// first one found wins, as it would for a shell.
+func DiscoverExternal(cfg *config.Config) []*ExternalPlugin {
+	dirs := []string{ExternalDir()}
+	dirs = append(dirs, filepath.SplitList(os.Getenv("PATH"))...)
+
+	seen := make(map[string]bool)
+	var plugins []*ExternalPlugin
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name, ok := externalName(entry.Name())
+			if !ok || seen[name] {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			if !isExecutable(path) {
+				continue
+			}
+			seen[name] = true
+			plugins = append(plugins, &ExternalPlugin{name: name, path: path, config: cfg})
+		}
+	}
+
+	sort.Slice(plugins, func(i, j int) bool {
+		return plugins[i].name < plugins[j].name
+	})
+	return plugins
+}
+
+// externalName returns the command an executable file name provides.
+func externalName(file string) (string, bool) {
+	name, ok := strings.CutPrefix(file, ExternalPrefix)
+	if !ok {
+		return "", false
+	}
+	if runtime.GOOS == "windows" {
+		ext := strings.ToLower(filepath.Ext(name))
+		if ext != ".exe" && ext != ".bat" && ext != ".cmd" {
+			return "", false
+		}
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	if name == "" || strings.HasPrefix(name, "-") || strings.ContainsAny(name, " \t") {
+		return "", false
+	}
+	return name, true
+}
+
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return false
+	}
+	return runtime.GOOS == "windows" || info.Mode().Perm()&0111 != 0
+}
+
+func (p *ExternalPlugin) Name() string {
+	return p.name
+}
+
+func (p *ExternalPlugin) Description() string {
+	return "External plugin (" + p.path + ")"
+}
+
+// Path returns the executable the plugin runs.
+func (p *ExternalPlugin) Path() string {
+	return p.path
+}
+
+// AddFlags adds nothing: the command doesn't parse flags, so all of them
+// reach the executable.
+func (p *ExternalPlugin) AddFlags(cmd *cobra.Command) {}
+
+// Execute runs the executable with args, connected to the terminal. The
+// configuration and a few facts about the invocation are passed in the
+// environment:
+//
+//	MKTOOLS_CONFIG_JSON  the merged configuration, with the keys of the YAML files
+//	                     and the API keys left empty
+//	MKTOOLS_BIN          the mktools executable, to call back into it
+//	MKTOOLS_VERSION      the mktools version
+//	MKTOOLS_PLUGIN_NAME  the command the plugin was invoked as
+func (p *ExternalPlugin) Execute(ctx context.Context, cmd *cobra.Command, args []string) error {
+	// Plugins are any executable named mktools-*; they can call back
+	// through MKTOOLS_BIN to use the model without seeing the keys
+	configJSON, err := p.config.WithoutSecrets().ToJSON()
+	if err != nil {
+		return err
+	}
+
+	c := exec.CommandContext(ctx, p.path, args...)
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	c.Env = append(os.Environ(),
+		"MKTOOLS_CONFIG_JSON="+string(configJSON),
+		"MKTOOLS_VERSION="+version.Version,
+		"MKTOOLS_PLUGIN_NAME="+p.name,
+	)
+	if self, err := os.Executable(); err == nil {
+		c.Env = append(c.Env, "MKTOOLS_BIN="+self)
+	}
+
+	// Interrupts reach the plugin directly; leave it to decide how to stop
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	err = c.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		code := exitErr.ExitCode()
+		if code < 0 {
+			// Killed by a signal
+			code = 1
+		}
+		return &ExitError{Name: p.name, Code: code}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to run plugin %s: %w", p.name, err)
+	}
+	return nil
+}
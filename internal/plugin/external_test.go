@@ -0,0 +1,66 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/amenophis1er/mktools/internal/config"
+)
+
+func TestExternalConfigWithoutSecrets(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugin is a shell script")
+	}
+	dir := t.TempDir()
+	out := filepath.Join(dir, "config.json")
+	script := "#!/bin/sh\nprintf '%s' \"$MKTOOLS_CONFIG_JSON\" > \"$1\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "mktools-dump"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+	t.Setenv("HOME", t.TempDir())
+
+	cfg := config.DefaultConfig()
+	cfg.LLM.APIKey = "sk-primary"
+	cfg.LLM.Fallback = &config.FallbackConfig{Provider: "openai", Model: "gpt-4o-mini", APIKey: "sk-fallback"}
+
+	plugins := DiscoverExternal(cfg)
+	if len(plugins) != 1 || plugins[0].Name() != "dump" {
+		t.Fatalf("plugins = %v, want mktools-dump", plugins)
+	}
+	if err := plugins[0].Execute(context.Background(), nil, []string{out}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "sk-") {
+		t.Errorf("MKTOOLS_CONFIG_JSON holds an API key: %s", data)
+	}
+	var got struct {
+		LLM struct {
+			Provider string `json:"provider"`
+			Fallback struct {
+				Model string `json:"model"`
+			} `json:"fallback"`
+		} `json:"llm"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.LLM.Provider != cfg.LLM.Provider || got.LLM.Fallback.Model != "gpt-4o-mini" {
+		t.Errorf("MKTOOLS_CONFIG_JSON = %s, want the rest of the config kept", data)
+	}
+
+	// The config itself is left alone
+	if cfg.LLM.APIKey != "sk-primary" || cfg.LLM.Fallback.APIKey != "sk-fallback" {
+		t.Error("WithoutSecrets cleared the keys of the original config")
+	}
+}
@@ -0,0 +1,42 @@
+package prompt
+
+// builtins are available everywhere and can be overridden by defining a
+// template with the same name.
+var builtins = []Prompt{
+	{
+		Name:        "explain",
+		Description: "Explain how part of the project works",
+		Source:      SourceBuiltin,
+		Template: `<context>
+{{.Context}}
+</context>
+
+Explain {{if .Question}}{{.Question}}{{else}}how this project works{{end}} to an engineer who is new to the codebase.
+Walk through the relevant files and functions in the order the code runs, refer to them by path, and point out anything surprising or easy to get wrong.
+`,
+	},
+	{
+		Name:        "refactor",
+		Description: "Suggest refactorings that keep the behavior",
+		Source:      SourceBuiltin,
+		Template: `<context>
+{{.Context}}
+</context>
+
+Suggest refactorings that make {{if .Question}}{{.Question}}{{else}}this project{{end}} simpler and easier to maintain without changing its behavior.
+Order them by value for the effort and explain each briefly. Show the complete new version of every file you change in a "## path" section followed by a fenced code block.
+`,
+	},
+	{
+		Name:        "write-tests",
+		Description: "Write tests in the project's own style",
+		Source:      SourceBuiltin,
+		Template: `<context>
+{{.Context}}
+</context>
+
+Write tests for {{if .Question}}{{.Question}}{{else}}the parts of this project that most need them{{end}}.
+Follow the test framework, layout and style the project already uses, and cover edge cases and error paths. Show each complete test file in a "## path" section followed by a fenced code block.
+`,
+	},
+}
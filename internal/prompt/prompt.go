@@ -0,0 +1,238 @@
+// Package prompt loads named prompt templates from the configuration and
+// from prompts directories, and renders them with a project's context.
+//
+// Templates use Go's text/template syntax and can reference {{.Context}},
+// {{.Files}}, {{.Diff}} and {{.Question}}. Later sources override earlier
+// ones with the same name: the built-in templates, the ones in the
+// configuration, ~/.config/mktools/prompts, the directories listed in the
+// configuration, and .mktools/prompts in the current directory, which is
+// meant to be checked in next to .mktools.yaml.
+package prompt
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/amenophis1er/mktools/internal/config"
+	"github.com/amenophis1er/mktools/internal/home"
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectDir holds the templates shared by a project, relative to the
+// directory mktools runs in.
+const ProjectDir = ".mktools/prompts"
+
+// Extension is the extension of template files.
+const Extension = ".md"
+
+// Source names for templates that don't come from a file.
+const (
+	SourceBuiltin = "built-in"
+	SourceConfig  = "config"
+)
+
+// Prompt is a named template. System, when set, replaces the default
+// system prompt of the command using it.
+type Prompt struct {
+	Name        string
+	Description string
+	System      string
+	Template    string
+	Source      string
+}
+
+// header is the optional YAML front matter of a template file.
+type header struct {
+	Description string `yaml:"description,omitempty"`
+	System      string `yaml:"system,omitempty"`
+}
+
+// Library is the set of templates available to a command.
+type Library struct {
+	prompts map[string]*Prompt
+}
+
+// GlobalDir returns the directory of the user's own templates.
+func GlobalDir() string {
+	return filepath.Join(home.Dir(), ".config", "mktools", "prompts")
+}
+
+// Dirs lists the template directories in the order they are read.
+func Dirs(cfg config.PromptsConfig) []string {
+	dirs := []string{GlobalDir()}
+	for _, dir := range cfg.Dirs {
+		dirs = append(dirs, home.Expand(dir))
+	}
+	return append(dirs, ProjectDir)
+}
+
+// Load gathers the built-in templates, the configured ones and those in
+// the template directories.
+func Load(cfg config.PromptsConfig) (*Library, error) {
+	l := &Library{prompts: make(map[string]*Prompt)}
+
+	for _, p := range builtins {
+		p := p
+		l.prompts[p.Name] = &p
+	}
+	for name, c := range cfg.Templates {
+		l.prompts[name] = &Prompt{
+			Name:        name,
+			Description: c.Description,
+			System:      c.System,
+			Template:    c.Template,
+			Source:      SourceConfig,
+		}
+	}
+
+	for _, dir := range Dirs(cfg) {
+		matches, err := filepath.Glob(filepath.Join(dir, "*"+Extension))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list prompts in %s: %w", dir, err)
+		}
+		for _, path := range matches {
+			p, err := ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			l.prompts[p.Name] = p
+		}
+	}
+	return l, nil
+}
+
+// Get returns the template called name.
+func (l *Library) Get(name string) (*Prompt, error) {
+	p, ok := l.prompts[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown prompt %s (see mktools prompt list)", name)
+	}
+	return p, nil
+}
+
+// List returns the templates sorted by name.
+func (l *Library) List() []*Prompt {
+	prompts := make([]*Prompt, 0, len(l.prompts))
+	for _, p := range l.prompts {
+		prompts = append(prompts, p)
+	}
+	sort.Slice(prompts, func(i, j int) bool {
+		return prompts[i].Name < prompts[j].Name
+	})
+	return prompts
+}
+
+// ReadFile reads a template file. The name of the template is the file
+// name without its extension.
+func ReadFile(path string) (*Prompt, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prompt: %w", err)
+	}
+
+	p := &Prompt{
+		Name:     strings.TrimSuffix(filepath.Base(path), Extension),
+		Template: string(content),
+		Source:   path,
+	}
+
+	// Front matter is optional
+	text := strings.ReplaceAll(string(content), "\r\n", "\n")
+	if rest, ok := strings.CutPrefix(text, "---\n"); ok {
+		front, body, found := strings.Cut(rest, "\n---\n")
+		if !found {
+			return nil, fmt.Errorf("prompt %s: front matter is not closed with ---", path)
+		}
+		var h header
+		if err := yaml.Unmarshal([]byte(front), &h); err != nil {
+			return nil, fmt.Errorf("prompt %s: invalid front matter: %w", path, err)
+		}
+		p.Description = h.Description
+		p.System = h.System
+		p.Template = body
+	}
+	return p, nil
+}
+
+// File formats p as a template file, with front matter for its description
+// and system prompt.
+func (p *Prompt) File() (string, error) {
+	var b strings.Builder
+	if p.Description != "" || p.System != "" {
+		front, err := yaml.Marshal(header{Description: p.Description, System: p.System})
+		if err != nil {
+			return "", fmt.Errorf("failed to format prompt: %w", err)
+		}
+		b.WriteString("---\n")
+		b.Write(front)
+		b.WriteString("---\n")
+	}
+	b.WriteString(p.Template)
+	if !strings.HasSuffix(p.Template, "\n") {
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
+
+// Render executes the template with data.
+func (p *Prompt) Render(data *Data) (string, error) {
+	tmpl, err := template.New(p.Name).Funcs(funcs).Option("missingkey=error").Parse(p.Template)
+	if err != nil {
+		return "", fmt.Errorf("invalid prompt %s: %w", p.Name, err)
+	}
+
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt %s: %w", p.Name, err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+var funcs = template.FuncMap{
+	// join lets templates write {{.Files | join "\n"}}
+	"join": func(sep string, items []string) string {
+		return strings.Join(items, sep)
+	},
+}
+
+// Data is what templates can reference. Context, Files and Diff are only
+// computed when a template uses them, and at most once.
+type Data struct {
+	Question string
+
+	context func() (string, error)
+	files   func() ([]string, error)
+	diff    func() (string, error)
+}
+
+// NewData returns the data for a question, computing the rest with the
+// given functions when a template asks for it.
+func NewData(question string, context func() (string, error), files func() ([]string, error), diff func() (string, error)) *Data {
+	return &Data{
+		Question: question,
+		context:  sync.OnceValues(context),
+		files:    sync.OnceValues(files),
+		diff:     sync.OnceValues(diff),
+	}
+}
+
+// Context is the project context, without its metadata block.
+func (d *Data) Context() (string, error) {
+	return d.context()
+}
+
+// Files lists the paths of the files in the context.
+func (d *Data) Files() ([]string, error) {
+	return d.files()
+}
+
+// Diff is the project's uncommitted changes.
+func (d *Data) Diff() (string, error) {
+	return d.diff()
+}
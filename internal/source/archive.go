@@ -0,0 +1,151 @@
+package source
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// archiveSuffixes lists the file name suffixes Archive understands.
+var archiveSuffixes = []string{".zip", ".tar", ".tar.gz", ".tgz"}
+
+// IsArchive reports whether path names an archive Archive can open.
+func IsArchive(path string) bool {
+	lower := strings.ToLower(path)
+	for _, suffix := range archiveSuffixes {
+		if strings.HasSuffix(lower, suffix) {
+			if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Archive returns a source for the contents of a zip, tar or gzip-compressed
+// tar archive, read without extracting anything to disk. When every entry
+// lives under a single top-level directory, as with most release tarballs,
+// that directory becomes the root of the source.
+func Archive(name string) (fs.FS, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var tree *treeFS
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		tree, err = readZip(data)
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		var gz *gzip.Reader
+		gz, err = gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip archive %s: %w", name, err)
+		}
+		defer gz.Close()
+		tree, err = readTar(gz)
+	case strings.HasSuffix(lower, ".tar"):
+		tree, err = readTar(bytes.NewReader(data))
+	default:
+		return nil, fmt.Errorf("unsupported archive format: %s", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive %s: %w", name, err)
+	}
+
+	return stripSingleRoot(tree)
+}
+
+func readZip(data []byte) (*treeFS, error) {
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	tree := newTreeFS()
+	for _, f := range r.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		name, ok := cleanPath(f.Name)
+		if !ok {
+			continue
+		}
+
+		f := f
+		tree.add(name, &treeEntry{
+			size:    int64(f.UncompressedSize64),
+			mode:    f.Mode().Perm(),
+			modTime: f.Modified,
+			load: func() ([]byte, error) {
+				rc, err := f.Open()
+				if err != nil {
+					return nil, err
+				}
+				defer rc.Close()
+				return io.ReadAll(rc)
+			},
+		})
+	}
+
+	return tree, nil
+}
+
+func readTar(r io.Reader) (*treeFS, error) {
+	tree := newTreeFS()
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name, ok := cleanPath(hdr.Name)
+		if !ok {
+			continue
+		}
+
+		// Tar entries can only be read sequentially, so keep the content.
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		tree.add(name, &treeEntry{
+			size:    hdr.Size,
+			mode:    fs.FileMode(hdr.Mode).Perm(),
+			modTime: hdr.ModTime,
+			load: func() ([]byte, error) {
+				return content, nil
+			},
+		})
+	}
+
+	return tree, nil
+}
+
+func stripSingleRoot(tree *treeFS) (fs.FS, error) {
+	root := tree.dirs["."]
+	if len(root) != 1 {
+		return tree, nil
+	}
+	for child := range root {
+		if _, isDir := tree.dirs[child]; !isDir {
+			return tree, nil
+		}
+		return fs.Sub(tree, path.Clean(child))
+	}
+	return tree, nil
+}
@@ -0,0 +1,145 @@
+package source
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amenophis1er/mktools/internal/git"
+)
+
+// gitWorktree is a working copy whose file set is whatever git reports.
+type gitWorktree struct {
+	fs.FS
+	root      string
+	untracked bool
+}
+
+// GitWorktree returns a source for the working copy at root that lists files
+// with "git ls-files". That applies .gitignore, nested ignores, the global
+// excludes file and .git/info/exclude exactly as git does. Untracked files are
+// included only when untracked is true.
+func GitWorktree(root string, untracked bool) fs.FS {
+	return &gitWorktree{FS: os.DirFS(root), root: root, untracked: untracked}
+}
+
+func (g *gitWorktree) ListFiles() ([]string, error) {
+	args := []string{"ls-files", "-z", "--cached"}
+	if g.untracked {
+		args = append(args, "--others", "--exclude-standard")
+	}
+
+	out, err := git.Run(g.root, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(out, "\x00") {
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		// Tracked files may be missing from the working tree, and
+		// submodules show up as directories; skip both.
+		info, err := os.Lstat(filepath.Join(g.root, filepath.FromSlash(name)))
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		paths = append(paths, name)
+	}
+
+	return paths, nil
+}
+
+// gitTree is the tree of a commit. Its file set is exactly what the commit
+// contains, so it lists files rather than being walked.
+type gitTree struct {
+	*treeFS
+}
+
+func (t *gitTree) ListFiles() ([]string, error) {
+	return t.paths(), nil
+}
+
+// Revision describes the commit a GitRevision source reads from.
+type Revision struct {
+	Name   string
+	Commit string
+	Time   time.Time
+}
+
+// GitRevision returns a source for the tree of rev in the repository
+// containing dir, restricted to the subtree at dir. Blobs are read with
+// "git cat-file" on demand; the working copy is never touched.
+func GitRevision(dir, rev string) (fs.FS, *Revision, error) {
+	out, err := git.Run(dir, "rev-parse", "--verify", "--end-of-options", rev+"^{commit}")
+	if err != nil {
+		return nil, nil, fmt.Errorf("unknown revision %q: %w", rev, err)
+	}
+	commit := strings.TrimSpace(out)
+
+	out, err = git.Run(dir, "show", "-s", "--format=%ct", commit)
+	if err != nil {
+		return nil, nil, err
+	}
+	seconds, err := strconv.ParseInt(strings.TrimSpace(out), 10, 64)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid commit time for %s: %w", commit, err)
+	}
+	commitTime := time.Unix(seconds, 0)
+
+	// ls-tree lists paths relative to dir and only below it, which is
+	// what we want when a subdirectory of the repository is requested.
+	out, err = git.Run(dir, "ls-tree", "-r", "-z", "-l", commit)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tree := newTreeFS()
+	for _, record := range strings.Split(out, "\x00") {
+		if record == "" {
+			continue
+		}
+
+		// Format: <mode> SP <type> SP <object> SP+ <size> TAB <path>
+		meta, name, ok := strings.Cut(record, "\t")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(meta)
+		if len(fields) != 4 || fields[1] != "blob" {
+			continue // submodules and other non-blob entries
+		}
+		mode, err := strconv.ParseUint(fields[0], 8, 32)
+		if err != nil || mode&0170000 != 0100000 {
+			continue // symlinks
+		}
+		size, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		object := fields[2]
+		tree.add(name, &treeEntry{
+			size:    size,
+			mode:    fs.FileMode(mode & 0777),
+			modTime: commitTime,
+			load: func() ([]byte, error) {
+				blob, err := git.Run(dir, "cat-file", "blob", object)
+				if err != nil {
+					return nil, err
+				}
+				return []byte(blob), nil
+			},
+		})
+	}
+
+	return &gitTree{tree}, &Revision{Name: rev, Commit: commit, Time: commitTime}, nil
+}
@@ -0,0 +1,24 @@
+// Package source provides the file trees a context can be built from: an OS
+// directory, the files git tracks in a working copy, the tree of a git
+// revision, or a zip or tar archive. Every source is an fs.FS, so the
+// collector reads them the same way.
+package source
+
+import (
+	"io/fs"
+	"os"
+)
+
+// Lister is implemented by sources that know their file set up front and
+// have already applied .gitignore rules to it. Collectors use it instead of
+// walking the tree, which avoids descending into ignored directories.
+type Lister interface {
+	// ListFiles returns the slash-separated paths of all regular files in
+	// the source, relative to its root.
+	ListFiles() ([]string, error)
+}
+
+// Dir returns a source backed by the OS directory root.
+func Dir(root string) fs.FS {
+	return os.DirFS(root)
+}
@@ -0,0 +1,190 @@
+package source
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// treeFS is a read-only, in-memory file tree whose file contents are loaded
+// on demand. It backs sources that are not directories on disk.
+type treeFS struct {
+	files map[string]*treeEntry
+	dirs  map[string]map[string]bool
+}
+
+type treeEntry struct {
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+	load    func() ([]byte, error)
+}
+
+func newTreeFS() *treeFS {
+	return &treeFS{
+		files: make(map[string]*treeEntry),
+		dirs:  map[string]map[string]bool{".": {}},
+	}
+}
+
+// add registers a regular file at name, creating its parent directories.
+func (t *treeFS) add(name string, e *treeEntry) {
+	t.files[name] = e
+	for name != "." {
+		dir := path.Dir(name)
+		if t.dirs[dir] == nil {
+			t.dirs[dir] = make(map[string]bool)
+		}
+		t.dirs[dir][path.Base(name)] = true
+		name = dir
+	}
+}
+
+func (t *treeFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if e, ok := t.files[name]; ok {
+		content, err := e.load()
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		return &treeFile{info: t.fileInfo(name, e), Reader: bytes.NewReader(content)}, nil
+	}
+
+	if _, ok := t.dirs[name]; ok {
+		entries, err := t.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		return &treeDir{info: dirInfo(name), entries: entries}, nil
+	}
+
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+func (t *treeFS) Stat(name string) (fs.FileInfo, error) {
+	if e, ok := t.files[name]; ok {
+		return t.fileInfo(name, e), nil
+	}
+	if _, ok := t.dirs[name]; ok {
+		return dirInfo(name), nil
+	}
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+func (t *treeFS) ReadFile(name string) ([]byte, error) {
+	e, ok := t.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+	content, err := e.load()
+	if err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+	return content, nil
+}
+
+func (t *treeFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	children, ok := t.dirs[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	entries := make([]fs.DirEntry, 0, len(children))
+	for child := range children {
+		full := path.Join(name, child)
+		info, err := t.Stat(full)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// paths returns the sorted names of all regular files in the tree.
+func (t *treeFS) paths() []string {
+	paths := make([]string, 0, len(t.files))
+	for name := range t.files {
+		paths = append(paths, name)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func (t *treeFS) fileInfo(name string, e *treeEntry) *treeInfo {
+	return &treeInfo{name: path.Base(name), size: e.size, mode: e.mode, modTime: e.modTime}
+}
+
+func dirInfo(name string) *treeInfo {
+	return &treeInfo{name: path.Base(name), mode: fs.ModeDir | 0755}
+}
+
+type treeInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (i *treeInfo) Name() string       { return i.name }
+func (i *treeInfo) Size() int64        { return i.size }
+func (i *treeInfo) Mode() fs.FileMode  { return i.mode }
+func (i *treeInfo) ModTime() time.Time { return i.modTime }
+func (i *treeInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i *treeInfo) Sys() any           { return nil }
+
+type treeFile struct {
+	*bytes.Reader
+	info fs.FileInfo
+}
+
+func (f *treeFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *treeFile) Close() error               { return nil }
+
+type treeDir struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *treeDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *treeDir) Close() error               { return nil }
+
+func (d *treeDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: fs.ErrInvalid}
+}
+
+func (d *treeDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	remaining := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(remaining) {
+		n = len(remaining)
+	}
+	d.offset += n
+	return remaining[:n], nil
+}
+
+// cleanPath normalizes an archive path into an fs.FS name, returning false
+// for entries that cannot be represented, such as the archive root itself.
+// Leading "/" and ".." elements are dropped, so entries can't escape the tree.
+func cleanPath(name string) (string, bool) {
+	name = strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(name, "\\", "/")), "/")
+	if name == "" || !fs.ValidPath(name) {
+		return "", false
+	}
+	return name, true
+}
@@ -0,0 +1,214 @@
+// Package usage keeps the ledger of LLM calls: a JSON Lines file with one
+// entry per call, recording its tokens, latency and estimated cost along
+// with the command and project it was made for.
+package usage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/amenophis1er/mktools/internal/git"
+	"github.com/amenophis1er/mktools/internal/home"
+)
+
+// Entry is one LLM call. Cost is nil when the model has no price in the
+// configuration.
+type Entry struct {
+	Time         time.Time `json:"time"`
+	Command      string    `json:"command,omitempty"`
+	Project      string    `json:"project,omitempty"`
+	Provider     string    `json:"provider"`
+	Model        string    `json:"model"`
+	InputTokens  int       `json:"input_tokens"`
+	OutputTokens int       `json:"output_tokens"`
+	LatencyMS    int64     `json:"latency_ms"`
+	Cost         *float64  `json:"cost,omitempty"`
+}
+
+// DefaultPath returns the ledger location used when the configuration
+// doesn't set one: $XDG_DATA_HOME/mktools/usage.jsonl, or
+// ~/.local/share/mktools/usage.jsonl.
+func DefaultPath() string {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		dir = filepath.Join(home.Dir(), ".local", "share")
+	}
+	return filepath.Join(dir, "mktools", "usage.jsonl")
+}
+
+// Append adds e to the ledger at path. Each entry is written with a single
+// call, so concurrent mktools processes don't interleave their lines.
+func Append(path string, e Entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode usage entry: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create ledger directory: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open ledger: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write ledger: %w", err)
+	}
+	return f.Close()
+}
+
+// Read returns the entries of the ledger at path made at or after since.
+// Lines that can't be parsed are skipped.
+func Read(path string, since time.Time) ([]Entry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ledger: %w", err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		if e.Time.Before(since) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read ledger: %w", err)
+	}
+	return entries, nil
+}
+
+// Groupings accepted by Summarize.
+var Groupings = []string{"day", "model", "command", "project"}
+
+// Row totals the entries sharing a key. Unpriced counts the calls whose
+// cost is unknown and therefore missing from Cost.
+type Row struct {
+	Key          string
+	Calls        int
+	InputTokens  int
+	OutputTokens int
+	Cost         float64
+	Unpriced     int
+	Latency      time.Duration
+}
+
+// AverageLatency is the mean duration of the calls.
+func (r *Row) AverageLatency() time.Duration {
+	if r.Calls == 0 {
+		return 0
+	}
+	return r.Latency / time.Duration(r.Calls)
+}
+
+func (r *Row) add(e Entry) {
+	r.Calls++
+	r.InputTokens += e.InputTokens
+	r.OutputTokens += e.OutputTokens
+	r.Latency += time.Duration(e.LatencyMS) * time.Millisecond
+	if e.Cost != nil {
+		r.Cost += *e.Cost
+	} else {
+		r.Unpriced++
+	}
+}
+
+// Summarize groups entries by day, model, command or project, and returns
+// the rows sorted by key and their total.
+func Summarize(entries []Entry, by string) ([]*Row, *Row, error) {
+	var key func(Entry) string
+	switch by {
+	case "day":
+		key = func(e Entry) string { return e.Time.Local().Format("2006-01-02") }
+	case "model":
+		key = func(e Entry) string { return e.Provider + "/" + e.Model }
+	case "command":
+		key = func(e Entry) string { return e.Command }
+	case "project":
+		key = func(e Entry) string { return e.Project }
+	default:
+		return nil, nil, fmt.Errorf("invalid grouping: %s (must be %s)", by, strings.Join(Groupings, ", "))
+	}
+
+	groups := make(map[string]*Row)
+	total := &Row{Key: "TOTAL"}
+	for _, e := range entries {
+		k := key(e)
+		if k == "" {
+			k = "-"
+		}
+		row, ok := groups[k]
+		if !ok {
+			row = &Row{Key: k}
+			groups[k] = row
+		}
+		row.add(e)
+		total.add(e)
+	}
+
+	rows := make([]*Row, 0, len(groups))
+	for _, row := range groups {
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].Key < rows[j].Key
+	})
+	return rows, total, nil
+}
+
+type contextKey int
+
+const (
+	commandKey contextKey = iota
+	projectKey
+)
+
+// WithCommand records the mktools command making the calls under ctx.
+func WithCommand(ctx context.Context, command string) context.Context {
+	return context.WithValue(ctx, commandKey, command)
+}
+
+// WithProject records the project the calls under ctx are about.
+func WithProject(ctx context.Context, dir string) context.Context {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	return context.WithValue(ctx, projectKey, dir)
+}
+
+// Command returns the command recorded in ctx.
+func Command(ctx context.Context) string {
+	command, _ := ctx.Value(commandKey).(string)
+	return command
+}
+
+// Project returns the project recorded in ctx, or else the repository or
+// directory mktools runs in.
+func Project(ctx context.Context) string {
+	if dir, ok := ctx.Value(projectKey).(string); ok {
+		return dir
+	}
+	if root, err := git.Root("."); err == nil {
+		return filepath.Clean(root)
+	}
+	dir, _ := os.Getwd()
+	return dir
+}
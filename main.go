@@ -1,14 +1,21 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
 	"github.com/amenophis1er/mktools/cmd"
+	"github.com/amenophis1er/mktools/internal/plugin"
 )
 
 func main() {
 	if err := cmd.Execute(); err != nil {
+		// External plugins report their own errors; keep their exit status
+		var exitErr *plugin.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.Code)
+		}
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
@@ -0,0 +1,426 @@
+package apply
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/amenophis1er/mktools/internal/config"
+	"github.com/amenophis1er/mktools/internal/contextfile"
+	"github.com/amenophis1er/mktools/internal/diff"
+	"github.com/amenophis1er/mktools/internal/metadata"
+	ctxplugin "github.com/amenophis1er/mktools/plugins/context"
+	"github.com/spf13/cobra"
+)
+
+type ApplyPlugin struct {
+	config *config.Config
+}
+
+type ApplyOptions struct {
+	ContextFile string
+	Dir         string
+	DryRun      bool
+	Yes         bool
+	Force       bool
+}
+
+// change is the new state of one file requested by a response.
+type change struct {
+	path    string
+	exists  bool
+	old     string
+	new     string
+	delete  bool
+	fromSum string
+}
+
+func New(cfg *config.Config) *ApplyPlugin {
+	return &ApplyPlugin{
+		config: cfg,
+	}
+}
+
+func (p *ApplyPlugin) Name() string {
+	return "apply"
+}
+
+func (p *ApplyPlugin) Description() string {
+	return "Apply file changes from an LLM response to the working tree"
+}
+
+func (p *ApplyPlugin) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().String("context", "", "context file the response was based on (default is the latest context in --dir)")
+	cmd.Flags().StringP("dir", "C", ".", "project directory to apply changes to")
+	cmd.Flags().Bool("dry-run", false, "only show the changes that would be applied")
+	cmd.Flags().BoolP("yes", "y", false, "apply without asking for confirmation")
+	cmd.Flags().Bool("force", false, "apply even if files changed since the context was generated")
+}
+
+func (p *ApplyPlugin) Execute(ctx context.Context, cmd *cobra.Command, args []string) error {
+	opts, err := p.parseFlags(cmd)
+	if err != nil {
+		return err
+	}
+
+	// Read the response, "-" meaning stdin
+	var response []byte
+	if args[0] == "-" {
+		response, err = io.ReadAll(os.Stdin)
+	} else {
+		response, err = os.ReadFile(args[0])
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	// Load the context the response was based on
+	contextPath, meta, err := p.loadBaseContext(opts)
+	if err != nil {
+		return err
+	}
+	if meta == nil && !opts.Force {
+		return fmt.Errorf("no context file found in %s to verify files against (use --context or --force)", opts.Dir)
+	}
+	if contextPath != "" {
+		fmt.Printf("Verifying against %s\n", contextPath)
+	}
+
+	changes, err := p.collectChanges(string(response), opts.Dir)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		fmt.Println("No file changes found in response")
+		return nil
+	}
+
+	// Refuse files that changed since the model saw them
+	if meta != nil && !opts.Force {
+		if conflicts := findConflicts(changes, meta); len(conflicts) > 0 {
+			for _, c := range conflicts {
+				fmt.Fprintf(os.Stderr, "Conflict: %s\n", c)
+			}
+			return fmt.Errorf("%d file(s) changed since the context was generated (use --force to apply anyway)", len(conflicts))
+		}
+	}
+
+	// Preview
+	for _, c := range changes {
+		oldName, newName := "a/"+c.path, "b/"+c.path
+		if !c.exists {
+			oldName = diff.DevNull
+		}
+		if c.delete {
+			newName = diff.DevNull
+		}
+		fmt.Print(diff.Unified(oldName, newName, c.old, c.new))
+	}
+
+	if opts.DryRun {
+		return nil
+	}
+
+	if !opts.Yes {
+		if args[0] == "-" {
+			return fmt.Errorf("cannot ask for confirmation while reading the response from stdin (use --yes)")
+		}
+		if !confirm(fmt.Sprintf("Apply changes to %d file(s)?", len(changes))) {
+			fmt.Println("Aborted")
+			return nil
+		}
+	}
+
+	backup, err := writeChanges(opts.Dir, changes)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Applied changes to %d file(s)\n", len(changes))
+	if backup != "" {
+		fmt.Printf("Backup of replaced files saved to %s\n", backup)
+	}
+	return nil
+}
+
+func (p *ApplyPlugin) parseFlags(cmd *cobra.Command) (*ApplyOptions, error) {
+	opts := &ApplyOptions{}
+
+	var err error
+
+	opts.ContextFile, err = cmd.Flags().GetString("context")
+	if err != nil {
+		return nil, fmt.Errorf("error getting context flag: %w", err)
+	}
+
+	opts.Dir, err = cmd.Flags().GetString("dir")
+	if err != nil {
+		return nil, fmt.Errorf("error getting dir flag: %w", err)
+	}
+
+	opts.DryRun, err = cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		return nil, fmt.Errorf("error getting dry-run flag: %w", err)
+	}
+
+	opts.Yes, err = cmd.Flags().GetBool("yes")
+	if err != nil {
+		return nil, fmt.Errorf("error getting yes flag: %w", err)
+	}
+
+	opts.Force, err = cmd.Flags().GetBool("force")
+	if err != nil {
+		return nil, fmt.Errorf("error getting force flag: %w", err)
+	}
+
+	return opts, nil
+}
+
+func (p *ApplyPlugin) loadBaseContext(opts *ApplyOptions) (string, *metadata.Metadata, error) {
+	if opts.ContextFile == "" {
+		path, meta := ctxplugin.FindContext(opts.Dir)
+		return path, meta, nil
+	}
+
+	content, err := os.ReadFile(opts.ContextFile)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read context file: %w", err)
+	}
+	meta, err := metadata.ParseFromContent(string(content))
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid context file %s: %w", opts.ContextFile, err)
+	}
+	return opts.ContextFile, meta, nil
+}
+
+// collectChanges finds whole-file sections and unified diffs in a response
+// and resolves each into the new content of a file under dir.
+func (p *ApplyPlugin) collectChanges(response, dir string) ([]*change, error) {
+	byPath := make(map[string]*change)
+	add := func(path string) (*change, error) {
+		if err := contextfile.ValidatePath(path); err != nil {
+			return nil, err
+		}
+		path = filepath.Clean(filepath.FromSlash(path))
+		if _, dup := byPath[path]; dup {
+			return nil, fmt.Errorf("response changes %s more than once", path)
+		}
+
+		c := &change{path: path}
+		content, err := os.ReadFile(filepath.Join(dir, path))
+		if err == nil {
+			c.exists = true
+			c.old = string(content)
+			sum := sha256.Sum256(content)
+			c.fromSum = hex.EncodeToString(sum[:])
+		} else if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		byPath[path] = c
+		return c, nil
+	}
+
+	for _, patch := range diff.ParsePatches(response) {
+		c, err := add(patch.Path())
+		if err != nil {
+			return nil, err
+		}
+		if !c.exists && !patch.IsNew() {
+			return nil, fmt.Errorf("cannot patch %s: file does not exist", c.path)
+		}
+		c.new, err = patch.Apply(c.old)
+		if err != nil {
+			return nil, err
+		}
+		c.delete = patch.IsDelete()
+	}
+
+	for _, f := range contextfile.ParseSections(response) {
+		if isPatch(f) {
+			continue // already handled above
+		}
+		// A heading like "## Example" over a code block is prose, not a
+		// new file; only paths that look like one are created
+		if !looksLikePath(f.Path) {
+			if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(f.Path))); err != nil {
+				fmt.Fprintf(os.Stderr, "Skipping section %q: not a file path\n", f.Path)
+				continue
+			}
+		}
+		c, err := add(f.Path)
+		if err != nil {
+			return nil, err
+		}
+		c.new = f.Content
+
+		// Replies rarely keep the blank line that marks a final newline
+		// in the context format, so keep the file's existing convention
+		if c.new != "" && !strings.HasSuffix(c.new, "\n") && (!c.exists || strings.HasSuffix(c.old, "\n")) {
+			c.new += "\n"
+		}
+	}
+
+	changes := make([]*change, 0, len(byPath))
+	for _, c := range byPath {
+		if c.exists && !c.delete && c.old == c.new {
+			continue
+		}
+		changes = append(changes, c)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].path < changes[j].path })
+
+	return changes, nil
+}
+
+// looksLikePath reports whether a section heading names a file by having a
+// directory or an extension.
+func looksLikePath(path string) bool {
+	return strings.Contains(path, "/") || len(filepath.Ext(path)) > 1
+}
+
+func isPatch(f contextfile.File) bool {
+	switch f.Language {
+	case "diff", "patch":
+		return true
+	}
+	return len(diff.ParsePatches(f.Content)) > 0
+}
+
+// findConflicts returns the paths whose current content differs from what
+// the base context recorded. New files conflict if something now exists at
+// their path.
+func findConflicts(changes []*change, meta *metadata.Metadata) []string {
+	var conflicts []string
+	for _, c := range changes {
+		expected, known := meta.FileChecksums[c.path]
+		switch {
+		case known && c.fromSum != expected:
+			conflicts = append(conflicts, c.path)
+		case !known && c.exists:
+			conflicts = append(conflicts, c.path+" (not in context)")
+		}
+	}
+	return conflicts
+}
+
+// writeChanges backs up every file it replaces, then writes all new
+// contents to temporary files before renaming them into place, restoring
+// the backup if any step fails.
+func writeChanges(dir string, changes []*change) (string, error) {
+	backupDir := ""
+	for _, c := range changes {
+		if !c.exists {
+			continue
+		}
+		if backupDir == "" {
+			// Applies within the same second each get their own directory
+			base := filepath.Join(dir, ctxplugin.BackupDir)
+			if err := os.MkdirAll(base, 0755); err != nil {
+				return "", fmt.Errorf("failed to create backup directory: %w", err)
+			}
+			var err error
+			backupDir, err = os.MkdirTemp(base, time.Now().Format("20060102-150405")+"-*")
+			if err != nil {
+				return "", fmt.Errorf("failed to create backup directory: %w", err)
+			}
+		}
+		target := filepath.Join(backupDir, c.path)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return "", fmt.Errorf("failed to create backup directory: %w", err)
+		}
+		if err := os.WriteFile(target, []byte(c.old), 0644); err != nil {
+			return "", fmt.Errorf("failed to back up %s: %w", c.path, err)
+		}
+	}
+
+	// Stage new contents next to their targets
+	staged := make(map[string]string)
+	cleanup := func() {
+		for _, tmp := range staged {
+			os.Remove(tmp)
+		}
+	}
+	for _, c := range changes {
+		if c.delete {
+			continue
+		}
+		target := filepath.Join(dir, c.path)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			cleanup()
+			return "", fmt.Errorf("failed to create directory for %s: %w", c.path, err)
+		}
+		tmp, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".mktools-*")
+		if err != nil {
+			cleanup()
+			return "", fmt.Errorf("failed to stage %s: %w", c.path, err)
+		}
+		staged[c.path] = tmp.Name()
+		_, err = tmp.WriteString(c.new)
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Chmod(tmp.Name(), fileMode(target))
+		}
+		if err != nil {
+			cleanup()
+			return "", fmt.Errorf("failed to stage %s: %w", c.path, err)
+		}
+	}
+
+	// Swap everything into place
+	var done []*change
+	for _, c := range changes {
+		target := filepath.Join(dir, c.path)
+		var err error
+		if c.delete {
+			err = os.Remove(target)
+		} else {
+			err = os.Rename(staged[c.path], target)
+		}
+		if err != nil {
+			rollback(dir, done)
+			cleanup()
+			return "", fmt.Errorf("failed to update %s, changes rolled back: %w", c.path, err)
+		}
+		done = append(done, c)
+	}
+
+	return backupDir, nil
+}
+
+func rollback(dir string, done []*change) {
+	for _, c := range done {
+		target := filepath.Join(dir, c.path)
+		if c.exists {
+			os.WriteFile(target, []byte(c.old), fileMode(target))
+		} else {
+			os.Remove(target)
+		}
+	}
+}
+
+func fileMode(path string) os.FileMode {
+	if info, err := os.Stat(path); err == nil {
+		return info.Mode().Perm()
+	}
+	return 0644
+}
+
+func confirm(prompt string) bool {
+	fmt.Printf("%s [y/N] ", prompt)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
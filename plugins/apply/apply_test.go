@@ -0,0 +1,79 @@
+package apply
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/amenophis1er/mktools/internal/config"
+)
+
+func TestCollectChangesSkipsProseHeadings(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Makefile"), []byte("all:\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	response := "Here is the fix.\n\n" +
+		"## main.go\n\n```go\npackage main\n```\n\n" +
+		"## Example\n\n```bash\nmake all\n```\n\n" +
+		"## Makefile\n\n```make\nall: build\n```\n"
+
+	changes, err := New(config.DefaultConfig()).collectChanges(response, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	for _, c := range changes {
+		paths = append(paths, c.path)
+	}
+	// Existing files are changed whatever their name; new ones need a
+	// path-like heading
+	if len(paths) != 2 || paths[0] != "Makefile" || paths[1] != "main.go" {
+		t.Errorf("changed paths = %v, want [Makefile main.go]", paths)
+	}
+}
+
+func TestWriteChangesUniqueBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(path, []byte("one\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two applies in the same second must not share a backup directory
+	first, err := writeChanges(dir, []*change{{path: "notes.txt", exists: true, old: "one\n", new: "two\n"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := writeChanges(dir, []*change{{path: "notes.txt", exists: true, old: "two\n", new: "three\n"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == "" || first == second {
+		t.Fatalf("backup directories = %q, %q, want two different ones", first, second)
+	}
+
+	for dir, want := range map[string]string{first: "one\n", second: "two\n"} {
+		got, err := os.ReadFile(filepath.Join(dir, "notes.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("backup in %s = %q, want %q", dir, got, want)
+		}
+	}
+	if got, _ := os.ReadFile(path); string(got) != "three\n" {
+		t.Errorf("notes.txt = %q, want three", got)
+	}
+
+	// Creating files only needs no backup
+	backup, err := writeChanges(dir, []*change{{path: "new.txt", new: "new\n"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backup != "" {
+		t.Errorf("backup = %q, want none when no file is replaced", backup)
+	}
+}
@@ -0,0 +1,313 @@
+package ask
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amenophis1er/mktools/internal/config"
+	"github.com/amenophis1er/mktools/internal/git"
+	"github.com/amenophis1er/mktools/internal/llm"
+	"github.com/amenophis1er/mktools/internal/metadata"
+	"github.com/amenophis1er/mktools/internal/prompt"
+	"github.com/amenophis1er/mktools/internal/usage"
+	ctxplugin "github.com/amenophis1er/mktools/plugins/context"
+	"github.com/spf13/cobra"
+)
+
+// DefaultSystemPrompt is used unless --system is given or the prompt
+// template sets its own.
+const DefaultSystemPrompt = `You are an experienced software engineer helping with the project described in the context below.
+Answer the question using the project's files, and refer to them by path.
+When you suggest changes to a file, show the complete new file in a "## path" section followed by a fenced code block, so they can be applied with "mktools apply".`
+
+type AskPlugin struct {
+	config   *config.Config
+	contexts *ctxplugin.ContextPlugin
+}
+
+type AskOptions struct {
+	ContextFile string
+	System      string
+	Prompt      string
+	Path        string
+	Save        string
+	Model       string
+	NoCache     bool
+}
+
+func New(cfg *config.Config, contexts *ctxplugin.ContextPlugin) *AskPlugin {
+	return &AskPlugin{
+		config:   cfg,
+		contexts: contexts,
+	}
+}
+
+func (p *AskPlugin) Name() string {
+	return "ask"
+}
+
+func (p *AskPlugin) Description() string {
+	return "Ask the configured model a question about a project"
+}
+
+func (p *AskPlugin) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().String("context-file", "", "use an existing context file instead of generating one")
+	cmd.Flags().String("system", "", "custom system prompt")
+	cmd.Flags().StringP("prompt", "p", "", "render the named prompt template (see mktools prompt list)")
+	cmd.Flags().String("path", "", "project directory, instead of the second argument (default: current directory)")
+	cmd.Flags().String("save", "", "write a transcript of the question and answer to this file")
+	cmd.Flags().String("model", "", "model to use (default from config)")
+	cmd.Flags().Bool("no-cache", false, "don't reuse or store cached responses")
+}
+
+func (p *AskPlugin) Execute(ctx context.Context, cmd *cobra.Command, args []string) error {
+	opts, err := p.parseFlags(cmd)
+	if err != nil {
+		return err
+	}
+
+	var question string
+	if len(args) > 0 {
+		question = strings.TrimSpace(args[0])
+	}
+	if question == "" && opts.Prompt == "" {
+		return fmt.Errorf("question is empty")
+	}
+	path := "."
+	switch {
+	case len(args) > 1 && opts.Path != "":
+		return fmt.Errorf("give the project directory as an argument or with --path, not both")
+	case len(args) > 1:
+		path = args[1]
+	case opts.Path != "":
+		path = opts.Path
+	}
+
+	ctx = usage.WithProject(ctx, path)
+	llmConfig := p.config.LLM
+	llmConfig.Cache.Enabled = llmConfig.Cache.Enabled && !opts.NoCache
+	provider, err := llm.New(llmConfig)
+	if err != nil {
+		return err
+	}
+
+	system := DefaultSystemPrompt
+	var message, source string
+	if opts.Prompt != "" {
+		tmpl, err := p.loadPrompt(opts.Prompt)
+		if err != nil {
+			return err
+		}
+		if tmpl.System != "" {
+			system = tmpl.System
+		}
+		message, source, err = p.renderPrompt(tmpl, path, question, opts)
+		if err != nil {
+			return err
+		}
+		if question == "" {
+			question = "(prompt " + opts.Prompt + ")"
+		}
+	} else {
+		content, from, err := p.loadContext(path, opts)
+		if err != nil {
+			return err
+		}
+		message, source = BuildPrompt(metadata.Strip(content), question), from
+	}
+	if opts.System != "" {
+		system = opts.System
+	}
+
+	req := &llm.Request{
+		Model:  opts.Model,
+		System: system,
+		Messages: []llm.Message{
+			{Role: llm.RoleUser, Content: message},
+		},
+	}
+
+	start := time.Now()
+	resp, err := provider.Stream(ctx, req, func(text string) error {
+		_, err := fmt.Print(text)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get answer: %w", err)
+	}
+	if !strings.HasSuffix(resp.Content, "\n") {
+		fmt.Println()
+	}
+	if resp.Cached {
+		fmt.Fprintf(os.Stderr, "\n%s: cached answer, %d input / %d output tokens saved (use --no-cache for a fresh one)\n",
+			resp.Model, resp.Usage.InputTokens, resp.Usage.OutputTokens)
+	} else {
+		fmt.Fprintf(os.Stderr, "\n%s: %d input / %d output tokens in %s\n",
+			resp.Model, resp.Usage.InputTokens, resp.Usage.OutputTokens, time.Since(start).Round(100*time.Millisecond))
+	}
+
+	if opts.Save != "" {
+		transcript := formatTranscript(question, source, system, resp)
+		if err := os.MkdirAll(filepath.Dir(opts.Save), 0755); err != nil {
+			return fmt.Errorf("failed to create transcript directory: %w", err)
+		}
+		if err := os.WriteFile(opts.Save, []byte(transcript), 0644); err != nil {
+			return fmt.Errorf("failed to write transcript: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Transcript saved to %s\n", opts.Save)
+	}
+
+	return nil
+}
+
+// loadContext returns the project context and a description of where it
+// came from.
+func (p *AskPlugin) loadContext(path string, opts *AskOptions) (string, string, error) {
+	if opts.ContextFile != "" {
+		content, err := os.ReadFile(opts.ContextFile)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read context file: %w", err)
+		}
+		return string(content), opts.ContextFile, nil
+	}
+
+	content, err := p.contexts.Generate(path, nil)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate context: %w", err)
+	}
+	return content, "generated from " + path, nil
+}
+
+func (p *AskPlugin) loadPrompt(name string) (*prompt.Prompt, error) {
+	library, err := prompt.Load(p.config.Prompts)
+	if err != nil {
+		return nil, err
+	}
+	return library.Get(name)
+}
+
+// renderPrompt renders a prompt template into the message sent to the
+// model. The context is only generated if the template uses it.
+func (p *AskPlugin) renderPrompt(tmpl *prompt.Prompt, path, question string, opts *AskOptions) (string, string, error) {
+	source := "prompt " + tmpl.Name
+	load := sync.OnceValues(func() (string, error) {
+		content, from, err := p.loadContext(path, opts)
+		if err == nil {
+			source += ", context " + from
+		}
+		return content, err
+	})
+
+	data := prompt.NewData(question,
+		func() (string, error) {
+			content, err := load()
+			return metadata.Strip(content), err
+		},
+		func() ([]string, error) {
+			content, err := load()
+			if err != nil {
+				return nil, err
+			}
+			m, err := metadata.ParseFromContent(content)
+			if err != nil {
+				return nil, fmt.Errorf("context has no file list: %w", err)
+			}
+			files := make([]string, 0, len(m.FileChecksums))
+			for name := range m.FileChecksums {
+				files = append(files, name)
+			}
+			sort.Strings(files)
+			return files, nil
+		},
+		func() (string, error) {
+			root, err := git.Root(path)
+			if err != nil {
+				return "", err
+			}
+			return git.Run(root, "diff", "HEAD", "--no-color", "--no-ext-diff")
+		},
+	)
+
+	message, err := tmpl.Render(data)
+	if err != nil {
+		return "", "", err
+	}
+	return message, source, nil
+}
+
+// BuildPrompt combines a project context and a question into the user
+// message sent to the model.
+func BuildPrompt(projectContext, question string) string {
+	var b strings.Builder
+	b.WriteString("<context>\n")
+	b.WriteString(strings.TrimSpace(projectContext))
+	b.WriteString("\n</context>\n\n")
+	b.WriteString(question)
+	return b.String()
+}
+
+func formatTranscript(question, source, system string, resp *llm.Response) string {
+	var b strings.Builder
+	b.WriteString("# Question\n\n")
+	b.WriteString(question + "\n\n")
+	b.WriteString(fmt.Sprintf("Model: %s\n", resp.Model))
+	b.WriteString(fmt.Sprintf("Context: %s\n", source))
+	b.WriteString(fmt.Sprintf("Date: %s\n", time.Now().Format(time.RFC3339)))
+	b.WriteString(fmt.Sprintf("Tokens: %d input, %d output\n\n", resp.Usage.InputTokens, resp.Usage.OutputTokens))
+	if system != DefaultSystemPrompt {
+		b.WriteString("## System Prompt\n\n")
+		b.WriteString(system + "\n\n")
+	}
+	b.WriteString("# Answer\n\n")
+	b.WriteString(strings.TrimRight(resp.Content, "\n") + "\n")
+	return b.String()
+}
+
+func (p *AskPlugin) parseFlags(cmd *cobra.Command) (*AskOptions, error) {
+	opts := &AskOptions{}
+
+	var err error
+
+	opts.ContextFile, err = cmd.Flags().GetString("context-file")
+	if err != nil {
+		return nil, fmt.Errorf("error getting context-file flag: %w", err)
+	}
+
+	opts.System, err = cmd.Flags().GetString("system")
+	if err != nil {
+		return nil, fmt.Errorf("error getting system flag: %w", err)
+	}
+
+	opts.Prompt, err = cmd.Flags().GetString("prompt")
+	if err != nil {
+		return nil, fmt.Errorf("error getting prompt flag: %w", err)
+	}
+
+	opts.Path, err = cmd.Flags().GetString("path")
+	if err != nil {
+		return nil, fmt.Errorf("error getting path flag: %w", err)
+	}
+
+	opts.Save, err = cmd.Flags().GetString("save")
+	if err != nil {
+		return nil, fmt.Errorf("error getting save flag: %w", err)
+	}
+
+	opts.Model, err = cmd.Flags().GetString("model")
+	if err != nil {
+		return nil, fmt.Errorf("error getting model flag: %w", err)
+	}
+
+	opts.NoCache, err = cmd.Flags().GetBool("no-cache")
+	if err != nil {
+		return nil, fmt.Errorf("error getting no-cache flag: %w", err)
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,205 @@
+package chat
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/amenophis1er/mktools/internal/config"
+	"github.com/amenophis1er/mktools/internal/llm"
+	"github.com/amenophis1er/mktools/internal/usage"
+	"github.com/amenophis1er/mktools/plugins/ask"
+	ctxplugin "github.com/amenophis1er/mktools/plugins/context"
+	"github.com/spf13/cobra"
+)
+
+type ChatPlugin struct {
+	config   *config.Config
+	contexts *ctxplugin.ContextPlugin
+}
+
+type ChatOptions struct {
+	System  string
+	Model   string
+	NoCache bool
+}
+
+// errQuit ends the conversation.
+var errQuit = errors.New("quit")
+
+func New(cfg *config.Config, contexts *ctxplugin.ContextPlugin) *ChatPlugin {
+	return &ChatPlugin{
+		config:   cfg,
+		contexts: contexts,
+	}
+}
+
+func (p *ChatPlugin) Name() string {
+	return "chat"
+}
+
+func (p *ChatPlugin) Description() string {
+	return "Chat with the configured model about a project"
+}
+
+func (p *ChatPlugin) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().String("system", "", "custom system prompt")
+	cmd.Flags().String("model", "", "model to use (default from config)")
+	cmd.Flags().Bool("no-cache", false, "don't reuse or store cached responses")
+}
+
+func (p *ChatPlugin) Execute(ctx context.Context, cmd *cobra.Command, args []string) error {
+	opts, err := p.parseFlags(cmd)
+	if err != nil {
+		return err
+	}
+
+	path := "."
+	if len(args) > 0 {
+		path = args[0]
+	}
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		return fmt.Errorf("%s is not a project directory", path)
+	}
+
+	ctx = usage.WithProject(ctx, path)
+	llmConfig := p.config.LLM
+	llmConfig.Cache.Enabled = llmConfig.Cache.Enabled && !opts.NoCache
+	provider, err := llm.New(llmConfig)
+	if err != nil {
+		return err
+	}
+
+	system := ask.DefaultSystemPrompt
+	if opts.System != "" {
+		system = opts.System
+	}
+	s := &session{
+		root:     path,
+		contexts: p.contexts,
+		provider: provider,
+		model:    opts.Model,
+		system:   system,
+		files:    make(map[string]*file),
+		dropped:  make(map[string]bool),
+		started:  time.Now(),
+	}
+	if _, err := s.refresh(); err != nil {
+		return err
+	}
+
+	model := opts.Model
+	if model == "" {
+		model = p.config.LLM.Model
+	}
+	fmt.Printf("Chatting with %s about %s: %d files, ~%d tokens of context.\n",
+		model, path, len(s.files), llm.EstimateTokens(s.render()))
+	fmt.Println("Type /help for commands, /quit or Ctrl-D to exit.")
+
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for {
+		fmt.Print("\n> ")
+		if !scanner.Scan() {
+			fmt.Println()
+			return scanner.Err()
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "/"):
+			err = s.command(ctx, line)
+		default:
+			err = s.ask(ctx, line)
+		}
+		if errors.Is(err, errQuit) {
+			return nil
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+	}
+}
+
+// ask sends a question with the conversation so far. The context is brought
+// up to date with the files on disk first. Ctrl-C interrupts the answer
+// without ending the chat.
+func (s *session) ask(parent context.Context, question string) error {
+	if updated := s.sync(); len(updated) > 0 {
+		fmt.Fprintf(os.Stderr, "Context updated: %s\n", strings.Join(updated, ", "))
+	}
+
+	ctx, stop := signal.NotifyContext(parent, os.Interrupt)
+	defer stop()
+
+	messages := append(s.history, llm.Message{Role: llm.RoleUser, Content: question})
+	start := time.Now()
+	resp, err := s.provider.Stream(ctx, s.request(messages), func(text string) error {
+		_, err := fmt.Print(text)
+		return err
+	})
+	fmt.Println()
+	if err != nil {
+		if ctx.Err() != nil {
+			fmt.Fprintln(os.Stderr, "(interrupted)")
+			return nil
+		}
+		return err
+	}
+
+	s.history = append(messages, llm.Message{Role: llm.RoleAssistant, Content: resp.Content})
+	if resp.Cached {
+		fmt.Fprintln(os.Stderr, "(cached answer)")
+		return nil
+	}
+	s.usage.InputTokens += resp.Usage.InputTokens
+	s.usage.OutputTokens += resp.Usage.OutputTokens
+	fmt.Fprintf(os.Stderr, "(%d input / %d output tokens in %s)\n",
+		resp.Usage.InputTokens, resp.Usage.OutputTokens, time.Since(start).Round(100*time.Millisecond))
+	return nil
+}
+
+func (s *session) request(messages []llm.Message) *llm.Request {
+	return &llm.Request{
+		Model:    s.model,
+		System:   s.systemPrompt(),
+		Messages: messages,
+	}
+}
+
+// systemPrompt puts the project files in the system prompt rather than in
+// the first message, so changed files replace their old content instead of
+// being repeated further down the conversation.
+func (s *session) systemPrompt() string {
+	return s.system + "\n\n<context>\n" + s.render() + "</context>"
+}
+
+func (p *ChatPlugin) parseFlags(cmd *cobra.Command) (*ChatOptions, error) {
+	opts := &ChatOptions{}
+
+	var err error
+
+	opts.System, err = cmd.Flags().GetString("system")
+	if err != nil {
+		return nil, fmt.Errorf("error getting system flag: %w", err)
+	}
+
+	opts.Model, err = cmd.Flags().GetString("model")
+	if err != nil {
+		return nil, fmt.Errorf("error getting model flag: %w", err)
+	}
+
+	opts.NoCache, err = cmd.Flags().GetBool("no-cache")
+	if err != nil {
+		return nil, fmt.Errorf("error getting no-cache flag: %w", err)
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,351 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/amenophis1er/mktools/internal/collect"
+	"github.com/amenophis1er/mktools/internal/contextfile"
+	"github.com/amenophis1er/mktools/internal/llm"
+	ctxplugin "github.com/amenophis1er/mktools/plugins/context"
+)
+
+// session is one conversation and the project files the model can see,
+// keyed by slash-separated path relative to root.
+type session struct {
+	root     string
+	contexts *ctxplugin.ContextPlugin
+	provider llm.Provider
+	model    string
+	system   string
+	files    map[string]*file
+	dropped  map[string]bool
+	history  []llm.Message
+	usage    llm.Usage
+	started  time.Time
+}
+
+// file is a file in the context and the stats it had when it was read.
+type file struct {
+	content string
+	size    int64
+	modTime time.Time
+}
+
+const help = `Commands:
+  /files               list the files in the context
+  /add <path|glob>...  add files to the context
+  /drop <path|glob>... remove files (or directories) from the context
+  /refresh             collect the project files again
+  /tokens              count the tokens the next question would use
+  /save [file]         save the conversation as markdown
+  /clear               forget the conversation, keeping the context
+  /quit                end the chat
+
+Files in the context are re-read before each question when they change on disk.`
+
+func (s *session) command(ctx context.Context, line string) error {
+	fields := strings.Fields(line)
+	name, args := fields[0], fields[1:]
+
+	switch name {
+	case "/help", "/?":
+		fmt.Println(help)
+	case "/quit", "/exit", "/q":
+		return errQuit
+	case "/files":
+		s.listFiles()
+	case "/add":
+		if len(args) == 0 {
+			return fmt.Errorf("usage: /add <path|glob>...")
+		}
+		for _, arg := range args {
+			if err := s.add(arg); err != nil {
+				return err
+			}
+		}
+	case "/drop":
+		if len(args) == 0 {
+			return fmt.Errorf("usage: /drop <path|glob>...")
+		}
+		for _, arg := range args {
+			if err := s.drop(arg); err != nil {
+				return err
+			}
+		}
+	case "/refresh":
+		summary, err := s.refresh()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Context refreshed: %s (%d files)\n", summary, len(s.files))
+	case "/tokens":
+		return s.tokens(ctx)
+	case "/save":
+		name := fmt.Sprintf("chat-%s.md", s.started.Format("20060102-150405"))
+		if len(args) > 0 {
+			name = args[0]
+		}
+		return s.save(name)
+	case "/clear":
+		s.history = nil
+		fmt.Println("Conversation cleared.")
+	default:
+		return fmt.Errorf("unknown command %s (type /help for commands)", name)
+	}
+	return nil
+}
+
+// refresh collects the project files again, keeping files added by hand
+// and leaving out dropped ones.
+func (s *session) refresh() (string, error) {
+	result, err := s.contexts.Collect(s.root, nil)
+	if err != nil {
+		return "", err
+	}
+
+	files := make(map[string]*file)
+	for p, e := range result.Entries {
+		if s.dropped[e.Name] {
+			continue
+		}
+		files[e.Name] = &file{content: result.Files[p], size: e.Size, modTime: e.ModTime}
+	}
+
+	// Files added with /add aren't collected; keep them while they exist
+	for name := range s.files {
+		if _, ok := files[name]; !ok {
+			if f, err := s.read(name); err == nil {
+				files[name] = f
+			}
+		}
+	}
+
+	var added, updated, removed int
+	for name, f := range files {
+		old, ok := s.files[name]
+		switch {
+		case !ok:
+			added++
+		case old.content != f.content:
+			updated++
+		}
+	}
+	for name := range s.files {
+		if _, ok := files[name]; !ok {
+			removed++
+		}
+	}
+	s.files = files
+
+	return fmt.Sprintf("%d added, %d updated, %d removed", added, updated, removed), nil
+}
+
+// sync re-reads files whose size or modification time changed and removes
+// deleted ones, returning the affected paths.
+func (s *session) sync() []string {
+	var changed []string
+	for name, f := range s.files {
+		info, err := os.Stat(s.diskPath(name))
+		if err != nil {
+			delete(s.files, name)
+			changed = append(changed, name+" (deleted)")
+			continue
+		}
+		if info.Size() == f.size && info.ModTime().Equal(f.modTime) {
+			continue
+		}
+		updated, err := s.read(name)
+		if err != nil {
+			delete(s.files, name)
+			changed = append(changed, name+" (removed)")
+			continue
+		}
+		if updated.content != f.content {
+			changed = append(changed, name)
+		}
+		s.files[name] = updated
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+func (s *session) add(pattern string) error {
+	matches, err := filepath.Glob(filepath.Join(s.root, pattern))
+	if err != nil {
+		return fmt.Errorf("invalid pattern %s: %w", pattern, err)
+	}
+	if len(matches) == 0 {
+		return fmt.Errorf("no files match %s", pattern)
+	}
+
+	for _, match := range matches {
+		rel, err := filepath.Rel(s.root, match)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return fmt.Errorf("%s is outside the project", match)
+		}
+		name := filepath.ToSlash(rel)
+
+		info, err := os.Stat(match)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			fmt.Printf("Skipping directory %s (use a glob such as %s/*.go)\n", name, name)
+			continue
+		}
+
+		f, err := s.read(name)
+		if err != nil {
+			fmt.Printf("Skipping %s: %v\n", name, err)
+			continue
+		}
+		delete(s.dropped, name)
+		s.files[name] = f
+		fmt.Printf("Added %s (~%d tokens)\n", name, llm.EstimateTokens(f.content))
+	}
+	return nil
+}
+
+// drop removes files matching pattern, a path, a glob or a directory. They
+// stay out of the context on /refresh.
+func (s *session) drop(pattern string) error {
+	pattern = strings.TrimSuffix(filepath.ToSlash(filepath.Clean(pattern)), "/")
+
+	var names []string
+	for name := range s.files {
+		matched, err := path.Match(pattern, name)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %s: %w", pattern, err)
+		}
+		if matched || strings.HasPrefix(name, pattern+"/") {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("no files in the context match %s", pattern)
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		delete(s.files, name)
+		s.dropped[name] = true
+		fmt.Printf("Dropped %s\n", name)
+	}
+	return nil
+}
+
+func (s *session) read(name string) (*file, error) {
+	p := s.diskPath(name)
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("not a regular file")
+	}
+	content, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	if !collect.IsText(content) {
+		return nil, fmt.Errorf("binary file")
+	}
+	return &file{content: string(content), size: info.Size(), modTime: info.ModTime()}, nil
+}
+
+func (s *session) diskPath(name string) string {
+	return filepath.Join(s.root, filepath.FromSlash(name))
+}
+
+func (s *session) names() []string {
+	names := make([]string, 0, len(s.files))
+	for name := range s.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// render formats the files like the structure and contents parts of a
+// context document.
+func (s *session) render() string {
+	names := s.names()
+
+	var b strings.Builder
+	b.WriteString("# File Structure\n\n```\n")
+	for _, name := range names {
+		b.WriteString(name + "\n")
+	}
+	b.WriteString("```\n\n")
+
+	b.WriteString(contextfile.ContentsHeading + "\n\n")
+	for _, name := range names {
+		b.WriteString(contextfile.Section(name, s.files[name].content))
+	}
+	return b.String()
+}
+
+func (s *session) listFiles() {
+	if len(s.files) == 0 {
+		fmt.Println("The context has no files.")
+		return
+	}
+	total := 0
+	for _, name := range s.names() {
+		tokens := llm.EstimateTokens(s.files[name].content)
+		total += tokens
+		fmt.Printf("  %-60s ~%d tokens\n", name, tokens)
+	}
+	fmt.Printf("%d files, ~%d tokens\n", len(s.files), total)
+}
+
+func (s *session) tokens(ctx context.Context) error {
+	// Count with a placeholder question, as the API needs a user message
+	messages := append(s.history, llm.Message{Role: llm.RoleUser, Content: "?"})
+	n, err := s.provider.CountTokens(ctx, s.request(messages))
+	if err != nil {
+		return fmt.Errorf("failed to count tokens: %w", err)
+	}
+	fmt.Printf("Next question: %d input tokens (%d files, %d messages)\n", n, len(s.files), len(s.history))
+	fmt.Printf("So far: %d input / %d output tokens\n", s.usage.InputTokens, s.usage.OutputTokens)
+	return nil
+}
+
+func (s *session) save(name string) error {
+	var b strings.Builder
+	b.WriteString("# Chat\n\n")
+	b.WriteString(fmt.Sprintf("Project: %s\n", s.root))
+	b.WriteString(fmt.Sprintf("Date: %s\n", s.started.Format(time.RFC3339)))
+	b.WriteString(fmt.Sprintf("Tokens: %d input, %d output\n\n", s.usage.InputTokens, s.usage.OutputTokens))
+
+	b.WriteString("Files in context:\n\n")
+	for _, name := range s.names() {
+		b.WriteString("- " + name + "\n")
+	}
+	b.WriteString("\n")
+
+	for _, m := range s.history {
+		if m.Role == llm.RoleUser {
+			b.WriteString("# You\n\n")
+		} else {
+			b.WriteString("# Assistant\n\n")
+		}
+		b.WriteString(strings.TrimRight(m.Content, "\n") + "\n\n")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := os.WriteFile(name, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("failed to save chat: %w", err)
+	}
+	fmt.Printf("Chat saved to %s\n", name)
+	return nil
+}
@@ -0,0 +1,372 @@
+package commitmsg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/amenophis1er/mktools/internal/config"
+	"github.com/amenophis1er/mktools/internal/git"
+	"github.com/amenophis1er/mktools/internal/llm"
+	ctxplugin "github.com/amenophis1er/mktools/plugins/context"
+	"github.com/spf13/cobra"
+)
+
+// maxDiffSize bounds the diff sent to the model. Larger diffs are cut, and
+// the model still sees the full list of changed files.
+const maxDiffSize = 100 << 10
+
+// hookMarker identifies hooks installed by mktools, so they can be replaced
+// or removed without touching anyone else's hook.
+const hookMarker = "# Installed by mktools commit-msg"
+
+type CommitMsgPlugin struct {
+	config *config.Config
+}
+
+type CommitMsgOptions struct {
+	Write         bool
+	Output        string
+	InstallHook   bool
+	UninstallHook bool
+	Force         bool
+	Model         string
+	NoCache       bool
+}
+
+func New(cfg *config.Config) *CommitMsgPlugin {
+	return &CommitMsgPlugin{
+		config: cfg,
+	}
+}
+
+func (p *CommitMsgPlugin) Name() string {
+	return "commit-msg"
+}
+
+func (p *CommitMsgPlugin) Description() string {
+	return "Write a commit message for the staged changes"
+}
+
+func (p *CommitMsgPlugin) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolP("write", "w", false, "write the message to .git/COMMIT_EDITMSG instead of printing it")
+	cmd.Flags().String("output", "", "write the message to this file, keeping its comment lines (used by the hook)")
+	cmd.Flags().Bool("install-hook", false, "install a prepare-commit-msg hook that fills in the message")
+	cmd.Flags().Bool("uninstall-hook", false, "remove the hook installed with --install-hook")
+	cmd.Flags().Bool("force", false, "replace an existing prepare-commit-msg hook")
+	cmd.Flags().String("model", "", "model to use (default from config)")
+	cmd.Flags().Bool("no-cache", false, "don't reuse or store cached responses")
+}
+
+func (p *CommitMsgPlugin) Execute(ctx context.Context, cmd *cobra.Command, args []string) error {
+	opts, err := p.parseFlags(cmd)
+	if err != nil {
+		return err
+	}
+
+	root, err := git.Root(".")
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case opts.InstallHook:
+		return p.installHook(root, opts.Force)
+	case opts.UninstallHook:
+		return p.uninstallHook(root)
+	}
+
+	diff, err := git.Run(root, "diff", "--staged", "--no-color", "--no-ext-diff", "-U5")
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(diff) == "" {
+		return fmt.Errorf("no staged changes (stage them with git add)")
+	}
+
+	llmConfig := p.config.LLM
+	llmConfig.Cache.Enabled = llmConfig.Cache.Enabled && !opts.NoCache
+	provider, err := llm.New(llmConfig)
+	if err != nil {
+		return err
+	}
+
+	prompt, err := p.buildPrompt(root, diff)
+	if err != nil {
+		return err
+	}
+	resp, err := provider.Complete(ctx, &llm.Request{
+		Model:    opts.Model,
+		System:   p.systemPrompt(),
+		Messages: []llm.Message{{Role: llm.RoleUser, Content: prompt}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to generate commit message: %w", err)
+	}
+
+	message := cleanMessage(resp.Content)
+	if message == "" {
+		return fmt.Errorf("the model returned an empty commit message")
+	}
+	for _, warning := range p.check(message) {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+
+	switch {
+	case opts.Output != "":
+		return writeMessage(opts.Output, message, true)
+	case opts.Write:
+		path, err := git.Path(root, "COMMIT_EDITMSG")
+		if err != nil {
+			return err
+		}
+		if err := writeMessage(path, message, false); err != nil {
+			return err
+		}
+		fmt.Printf("Commit message written to %s\n", path)
+		fmt.Printf("Commit with: git commit -e -F %s\n", path)
+	default:
+		fmt.Println(message)
+	}
+	return nil
+}
+
+func (p *CommitMsgPlugin) systemPrompt() string {
+	cfg := p.config.Commit
+
+	var b strings.Builder
+	b.WriteString("You write git commit messages for the staged changes you are shown.\n")
+	b.WriteString("Reply with the commit message only, without code fences or commentary: a subject line, ")
+	b.WriteString("then, if the change needs explaining, a blank line and a body wrapped at 72 columns ")
+	b.WriteString("that says what changed and why.\n")
+	b.WriteString("Write the subject in the imperative mood, without a trailing period.\n")
+	if cfg.MaxSubjectLength > 0 {
+		b.WriteString(fmt.Sprintf("The subject line must be at most %d characters.\n", cfg.MaxSubjectLength))
+	}
+	if cfg.Convention == "" || cfg.Convention == "conventional" {
+		b.WriteString("Follow the Conventional Commits format for the subject: type(scope): description, ")
+		b.WriteString("where type is one of feat, fix, docs, style, refactor, perf, test, build, ci, chore or revert, ")
+		b.WriteString("and the scope is optional. Mark breaking changes with ! after the type or scope.\n")
+	}
+	b.WriteString("Match the style of the recent commit subjects when they follow the same convention.\n")
+	if cfg.Instructions != "" {
+		b.WriteString("\n" + strings.TrimSpace(cfg.Instructions) + "\n")
+	}
+	return b.String()
+}
+
+// buildPrompt gathers what the model needs besides the diff: the project
+// type and branch, the changed files and recent commit subjects.
+func (p *CommitMsgPlugin) buildPrompt(root, diff string) (string, error) {
+	var b strings.Builder
+
+	if info, err := ctxplugin.DetectProject(root); err == nil {
+		b.WriteString(fmt.Sprintf("Project type: %s\n", info.Type))
+		if info.GitBranch != "" {
+			b.WriteString(fmt.Sprintf("Branch: %s\n", info.GitBranch))
+		}
+		b.WriteString("\n")
+	}
+
+	files, err := git.ChangedFiles(root, "--staged")
+	if err != nil {
+		return "", err
+	}
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	b.WriteString("Staged files:\n")
+	for _, path := range paths {
+		b.WriteString(fmt.Sprintf("%s %s\n", files[path], path))
+	}
+	b.WriteString("\n")
+
+	// A new repository has no history yet
+	if log, err := git.Run(root, "log", "-n", "10", "--no-merges", "--pretty=format:%s"); err == nil && strings.TrimSpace(log) != "" {
+		b.WriteString("Recent commit subjects:\n")
+		b.WriteString(strings.TrimSpace(log) + "\n\n")
+	}
+
+	if len(diff) > maxDiffSize {
+		diff = diff[:maxDiffSize] + "\n[diff truncated]\n"
+	}
+	b.WriteString("Staged diff:\n")
+	b.WriteString(diff)
+	return b.String(), nil
+}
+
+var conventionalSubject = regexp.MustCompile(`^[a-z]+(\([^()]+\))?!?: \S`)
+
+// check returns the ways message breaks the configured convention. They are
+// reported rather than fixed, since the message is meant to be reviewed.
+func (p *CommitMsgPlugin) check(message string) []string {
+	cfg := p.config.Commit
+	subject, _, _ := strings.Cut(message, "\n")
+
+	var warnings []string
+	if cfg.MaxSubjectLength > 0 && len([]rune(subject)) > cfg.MaxSubjectLength {
+		warnings = append(warnings, fmt.Sprintf("subject is %d characters, longer than %d", len([]rune(subject)), cfg.MaxSubjectLength))
+	}
+	if (cfg.Convention == "" || cfg.Convention == "conventional") && !conventionalSubject.MatchString(subject) {
+		warnings = append(warnings, "subject doesn't follow the Conventional Commits format")
+	}
+	return warnings
+}
+
+// cleanMessage removes the code fences and blank lines models sometimes wrap
+// a message in.
+func cleanMessage(content string) string {
+	lines := strings.Split(strings.TrimSpace(content), "\n")
+	if len(lines) > 1 && strings.HasPrefix(lines[0], "```") && strings.HasPrefix(lines[len(lines)-1], "```") {
+		lines = lines[1 : len(lines)-1]
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// writeMessage writes message to path. With keepComments, the comment
+// lines git put in the file (the status summary) are kept below it.
+func writeMessage(path, message string, keepComments bool) error {
+	content := message + "\n"
+	if keepComments {
+		if existing, err := os.ReadFile(path); err == nil {
+			var comments []string
+			for _, line := range strings.Split(string(existing), "\n") {
+				if strings.HasPrefix(line, "#") {
+					comments = append(comments, line)
+				}
+			}
+			if len(comments) > 0 {
+				content += "\n" + strings.Join(comments, "\n") + "\n"
+			}
+		}
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write commit message: %w", err)
+	}
+	return nil
+}
+
+func (p *CommitMsgPlugin) hookPath(root string) (string, error) {
+	hooks, err := git.Path(root, "hooks")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(hooks, "prepare-commit-msg"), nil
+}
+
+// installHook writes a prepare-commit-msg hook that fills in a message when
+// none was given on the command line. A failure never blocks the commit.
+func (p *CommitMsgPlugin) installHook(root string, force bool) error {
+	path, err := p.hookPath(root)
+	if err != nil {
+		return err
+	}
+	if existing, err := os.ReadFile(path); err == nil && !strings.Contains(string(existing), hookMarker) && !force {
+		return fmt.Errorf("%s already exists (use --force to replace it)", path)
+	}
+
+	// Prefer the mktools on PATH, so upgrades are picked up
+	exe := "mktools"
+	if _, err := exec.LookPath(exe); err != nil {
+		if exe, err = os.Executable(); err != nil {
+			return fmt.Errorf("failed to locate mktools: %w", err)
+		}
+	}
+
+	hook := fmt.Sprintf(`#!/bin/sh
+%s
+# Fills in a commit message for the staged changes unless one was given
+# with -m, -F, a template, or the commit is a merge, squash or amend.
+case "$2" in
+  message|template|merge|squash|commit) exit 0 ;;
+esac
+%s commit-msg --output "$1" || true
+`, hookMarker, shellQuote(exe))
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create hooks directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(hook), 0755); err != nil {
+		return fmt.Errorf("failed to write hook: %w", err)
+	}
+	fmt.Printf("Installed prepare-commit-msg hook at %s\n", path)
+	return nil
+}
+
+// shellQuote quotes s as a single word for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func (p *CommitMsgPlugin) uninstallHook(root string) error {
+	path, err := p.hookPath(root)
+	if err != nil {
+		return err
+	}
+	existing, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		fmt.Println("No prepare-commit-msg hook installed")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read hook: %w", err)
+	}
+	if !strings.Contains(string(existing), hookMarker) {
+		return fmt.Errorf("%s was not installed by mktools; remove it by hand", path)
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove hook: %w", err)
+	}
+	fmt.Printf("Removed %s\n", path)
+	return nil
+}
+
+func (p *CommitMsgPlugin) parseFlags(cmd *cobra.Command) (*CommitMsgOptions, error) {
+	opts := &CommitMsgOptions{}
+
+	var err error
+
+	opts.Write, err = cmd.Flags().GetBool("write")
+	if err != nil {
+		return nil, fmt.Errorf("error getting write flag: %w", err)
+	}
+
+	opts.Output, err = cmd.Flags().GetString("output")
+	if err != nil {
+		return nil, fmt.Errorf("error getting output flag: %w", err)
+	}
+
+	opts.InstallHook, err = cmd.Flags().GetBool("install-hook")
+	if err != nil {
+		return nil, fmt.Errorf("error getting install-hook flag: %w", err)
+	}
+
+	opts.UninstallHook, err = cmd.Flags().GetBool("uninstall-hook")
+	if err != nil {
+		return nil, fmt.Errorf("error getting uninstall-hook flag: %w", err)
+	}
+
+	opts.Force, err = cmd.Flags().GetBool("force")
+	if err != nil {
+		return nil, fmt.Errorf("error getting force flag: %w", err)
+	}
+
+	opts.Model, err = cmd.Flags().GetString("model")
+	if err != nil {
+		return nil, fmt.Errorf("error getting model flag: %w", err)
+	}
+
+	opts.NoCache, err = cmd.Flags().GetBool("no-cache")
+	if err != nil {
+		return nil, fmt.Errorf("error getting no-cache flag: %w", err)
+	}
+
+	return opts, nil
+}
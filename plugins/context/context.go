@@ -3,103 +3,166 @@ package context
 import (
 	"bytes"
 	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"github.com/spf13/cobra"
 	"io"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"sort"
 	"strings"
-	"unicode/utf8"
 	"time"
 
+	"github.com/amenophis1er/mktools/internal/cache"
+	"github.com/amenophis1er/mktools/internal/collect"
 	"github.com/amenophis1er/mktools/internal/config"
+	"github.com/amenophis1er/mktools/internal/contextfile"
 	"github.com/amenophis1er/mktools/internal/filesize"
-	"github.com/amenophis1er/mktools/internal/ignore"
+	"github.com/amenophis1er/mktools/internal/home"
 	"github.com/amenophis1er/mktools/internal/metadata"
+	"github.com/amenophis1er/mktools/internal/source"
 )
 
 type ContextPlugin struct {
 	config   *config.Config
 	metadata *metadata.Metadata
+	status   io.Writer
+
+	// noSectionCache skips the section cache, for --no-cache and for
+	// estimates, which must not write anything
+	noSectionCache bool
 }
 
+// ContextOptions are the settings of one context generation. The JSON
+// names are those accepted by "mktools serve"; the options that only make
+// sense on the command line have none.
 type ContextOptions struct {
-	OutputFile        string
-	StructureOnly     bool
-	ContentOnly       bool
-	Format            string
-	MaxFiles          int
-	AdditionalIgnores []string
+	OutputFile        string   `json:"-"`
+	StructureOnly     bool     `json:"structure_only,omitempty"`
+	ContentOnly       bool     `json:"content_only,omitempty"`
+	Format            string   `json:"format,omitempty"`
+	MaxFiles          int      `json:"max_files,omitempty"`
+	AdditionalIgnores []string `json:"ignore,omitempty"`
+	Source            string   `json:"source,omitempty"`
+	Rev               string   `json:"rev,omitempty"`
+	Force             bool     `json:"-"`
+	NoCache           bool     `json:"no_cache,omitempty"`
+	Estimate          bool     `json:"-"`
 }
 
 var contextFilePatterns = []string{
-    "context.md",
-    "context.txt",
-    "context-*.md",
-    "context-*.txt",
+	"context.md",
+	"context.txt",
+	"context-*.md",
+	"context-*.txt",
 }
 
+// SectionCacheName is the cache store holding rendered file sections.
+// Entries expire after sectionCacheTTL and the store is kept under
+// sectionCacheMaxSize, so copies of project files don't pile up.
+const (
+	SectionCacheName    = "sections"
+	sectionCacheTTL     = 7 * 24 * time.Hour
+	sectionCacheMaxSize = 64 << 20
+)
+
+// BackupDir is where "mktools apply" keeps copies of the files it replaces,
+// relative to the project root.
+const BackupDir = ".mktools/backup"
+
 type contextFile struct {
-    path     string
-    format   string
-    metadata *metadata.Metadata
+	path     string
+	format   string
+	metadata *metadata.Metadata
 }
 
-
 func (p *ContextPlugin) detectContextFiles(dir string) ([]contextFile, error) {
-    var files []contextFile
-
-    // Helper function to check file content for metadata
-    checkFile := func(path string) error {
-        content, err := os.ReadFile(path)
-        if err != nil {
-            return nil // Skip unreadable files
-        }
-
-        // Check for metadata marker
-        if bytes.Contains(content, []byte(metadata.MetadataMarker)) {
-            meta, err := metadata.ParseFromContent(string(content))
-            if err != nil {
-                return nil // Skip invalid metadata
-            }
-
-            format := "md"
-            if strings.HasSuffix(path, ".txt") {
-                format = "txt"
-            }
-
-            files = append(files, contextFile{
-                path:     path,
-                format:   format,
-                metadata: meta,
-            })
-        }
-        return nil
-    }
-
-    // Check for existing context files
-    for _, pattern := range contextFilePatterns {
-        matches, err := filepath.Glob(filepath.Join(dir, pattern))
-        if err != nil {
-            continue
-        }
-
-        for _, match := range matches {
-            if err := checkFile(match); err != nil {
-                continue
-            }
-        }
-    }
-
-    return files, nil
+	var files []contextFile
+
+	// Helper function to check file content for metadata
+	checkFile := func(path string) error {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil // Skip unreadable files
+		}
+
+		// Check for metadata marker
+		if bytes.Contains(content, []byte(metadata.MetadataMarker)) {
+			meta, err := metadata.ParseFromContent(string(content))
+			if err != nil {
+				return nil // Skip invalid metadata
+			}
+
+			format := "md"
+			if strings.HasSuffix(path, ".txt") {
+				format = "txt"
+			}
+
+			files = append(files, contextFile{
+				path:     path,
+				format:   format,
+				metadata: meta,
+			})
+		}
+		return nil
+	}
+
+	// Check for existing context files
+	for _, pattern := range contextFilePatterns {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			continue
+		}
+
+		for _, match := range matches {
+			if err := checkFile(match); err != nil {
+				continue
+			}
+		}
+	}
+
+	return files, nil
+}
+
+// FindContext returns the most recently generated context file in dir and
+// its metadata. The path is empty when dir has no context file.
+func FindContext(dir string) (string, *metadata.Metadata) {
+	files, err := (&ContextPlugin{}).detectContextFiles(dir)
+	if err != nil || len(files) == 0 {
+		return "", nil
+	}
+
+	latest := files[0]
+	for _, cf := range files[1:] {
+		if cf.metadata.GeneratedAt.After(latest.metadata.GeneratedAt) {
+			latest = cf
+		}
+	}
+	return latest.path, latest.metadata
 }
 
 func New(cfg *config.Config) *ContextPlugin {
 	return &ContextPlugin{
 		config:   cfg,
 		metadata: metadata.New(),
+		status:   os.Stdout,
+	}
+}
+
+// Fork returns a plugin with its own copy of the configuration. Generate
+// and Collect apply their options to the configuration of the plugin they
+// are called on, so long-running servers fork one per call.
+func (p *ContextPlugin) Fork() *ContextPlugin {
+	cfg := *p.config
+	return &ContextPlugin{
+		config:   &cfg,
+		metadata: metadata.New(),
+		status:   p.status,
 	}
 }
 
@@ -112,12 +175,17 @@ func (p *ContextPlugin) Description() string {
 }
 
 func (p *ContextPlugin) AddFlags(cmd *cobra.Command) {
-	cmd.Flags().StringP("output", "o", "", "output file (default is ./context.md)")
+	cmd.Flags().StringP("output", "o", "", "output file, or - for stdout (default is ./context.md)")
 	cmd.Flags().BoolP("structure-only", "s", false, "only include file structure")
 	cmd.Flags().BoolP("content-only", "c", false, "only include file contents")
 	cmd.Flags().StringP("format", "f", "", "output format (md or txt)")
 	cmd.Flags().Int("max-files", 0, "maximum number of files to process (0 = use config value)")
 	cmd.Flags().StringSlice("ignore", nil, "additional patterns to ignore")
+	cmd.Flags().String("source", "", "file source (auto, walk or git; default from config)")
+	cmd.Flags().String("rev", "", "build the context from a git revision instead of the working copy")
+	cmd.Flags().Bool("force", false, "regenerate even if an up-to-date context exists")
+	cmd.Flags().Bool("no-cache", false, "ignore existing contexts and the section cache")
+	cmd.Flags().Bool("estimate", false, "report the size, token count and cost of the context without writing it")
 }
 
 func (p *ContextPlugin) Execute(ctx context.Context, cmd *cobra.Command, args []string) error {
@@ -127,15 +195,12 @@ func (p *ContextPlugin) Execute(ctx context.Context, cmd *cobra.Command, args []
 		return err
 	}
 
-	// Apply options to config
-	if opts.Format != "" {
-		p.config.Context.OutputFormat = opts.Format
-	}
-	if opts.StructureOnly {
-		p.config.Context.IncludeFileContent = false
-	}
-	if opts.ContentOnly {
-		p.config.Context.IncludeFileStructure = false
+	p.applyOptions(opts)
+
+	// Keep stdout clean for the context itself when writing it there
+	p.status = os.Stdout
+	if opts.OutputFile == "-" {
+		p.status = os.Stderr
 	}
 
 	// Default to current directory if no path provided
@@ -144,84 +209,329 @@ func (p *ContextPlugin) Execute(ctx context.Context, cmd *cobra.Command, args []
 		path = args[0]
 	}
 
-    // Check for existing context files
-    contextFiles, err := p.detectContextFiles(path)
-    if err == nil && len(contextFiles) > 0 {
-        for _, cf := range contextFiles {
-            // Check if source files have changed
-            changed, err := cf.metadata.HasSourceChanged(path)
-            if err == nil && !changed {
-                fmt.Printf("No changes detected. Using existing context file: %s\n", cf.path)
-                content, err := os.ReadFile(cf.path)
-                if err == nil {
-                    fmt.Println(string(content))
-                    return nil
-                }
-            }
-        }
-    }
-
-	// Check for existing context file
-	existingContext := p.findExistingContext(path)
-	if existingContext != "" {
-		existing, err := os.ReadFile(existingContext)
-		if err == nil {
-			existingMeta, err := metadata.ParseFromContent(string(existing))
-			if err == nil {
-				changed, err := existingMeta.HasSourceChanged(path)
-				if err == nil && !changed {
-					fmt.Println("No changes detected in source files. Using existing context.")
-					fmt.Println(string(existing))
-					return nil
-				}
-			}
-		}
+	if opts.Estimate {
+		return p.estimate(path, opts)
 	}
 
 	// Detect project info
-	projectInfo, err := detectProject(path)
+	projectInfo, err := DetectProject(path)
 	if err != nil {
 		return fmt.Errorf("failed to detect project info: %w", err)
 	}
 
+	// Open the file tree to read from
+	fsys, err := p.openSource(path, opts, projectInfo)
+	if err != nil {
+		return fmt.Errorf("failed to open source: %w", err)
+	}
+
+	genOpts, err := p.generationOptions(opts, projectInfo)
+	if err != nil {
+		return err
+	}
+	var signKey ed25519.PrivateKey
+	if p.config.Context.SignKey != "" {
+		signKey, err = metadata.LoadSigningKey(home.Expand(p.config.Context.SignKey))
+		if err != nil {
+			return fmt.Errorf("failed to load signing key: %w", err)
+		}
+	}
+	p.metadata.SetOptions(genOpts)
+	p.metadata.GitHead = projectInfo.GitCommit
+	if root, err := filepath.Abs(path); err == nil {
+		p.metadata.Root = root
+	}
+
+	// Check for existing context files generated with the same options.
+	// Those describe the working copy, so they can't stand in for a
+	// context of another revision or of an archive. An up-to-date one is
+	// reused as is; the newest stale one is updated incrementally.
+	var previous *contextFile
+	stale := false
+	if opts.Rev == "" && !source.IsArchive(path) && !opts.NoCache {
+		contextFiles, _ := p.detectContextFiles(path)
+		for i, cf := range contextFiles {
+			if cf.metadata.OptionsFingerprint != p.metadata.OptionsFingerprint {
+				continue
+			}
+
+			// Check if source files have changed
+			changes, err := cf.metadata.SourceChanges(path)
+			if err != nil {
+				continue
+			}
+			if changes.Empty() && !opts.Force {
+				return p.useExisting(cf.path, opts.OutputFile)
+			}
+			if !changes.Empty() {
+				p.infof("Context file %s is stale: %s\n", cf.path, changes.Summary())
+			}
+			if previous == nil || cf.metadata.GeneratedAt.After(previous.metadata.GeneratedAt) {
+				previous = &contextFiles[i]
+				stale = !changes.Empty()
+			}
+		}
+	}
+
+	// Determine output location. An existing context is updated in place.
+	outputFile := opts.OutputFile
+	if outputFile == "" && previous != nil {
+		outputFile = previous.path
+	}
+	if outputFile == "" {
+		outputDir := path
+		if source.IsArchive(path) {
+			outputDir = filepath.Dir(path)
+		}
+		outputFile = p.determineOutputFile(outputDir)
+	}
+
 	// Collect files with options
-	files, err := p.collectFiles(path, opts)
+	collectOpts, err := p.collectOptions(path, fsys, opts, projectInfo, outputFile)
 	if err != nil {
-		return fmt.Errorf("failed to collect files: %w", err)
+		return err
+	}
+	var result *collect.Result
+	reused := 0
+	if stale && reflect.DeepEqual(*previous.metadata.Collector, collectOpts) {
+		result, reused, err = p.collectIncremental(fsys, collectOpts, previous)
+		if err != nil {
+			return fmt.Errorf("failed to collect files: %w", err)
+		}
+	}
+	if result == nil {
+		result, err = p.collectFiles(fsys, collectOpts)
+		if err != nil {
+			return fmt.Errorf("failed to collect files: %w", err)
+		}
 	}
+	files := result.Files
 
 	// Calculate checksums for the collected files
 	if err := p.metadata.CalculateSourceChecksum(files); err != nil {
 		return fmt.Errorf("failed to calculate checksums: %w", err)
 	}
+	p.metadata.RecordFiles(collectOpts, result.Entries)
 
 	// Format output
-	output := p.formatOutput(projectInfo, files)
-
-	// Determine output location
-	outputFile := opts.OutputFile
-	if outputFile == "" {
-		outputFile = p.determineOutputFile(path)
+	output, err := p.formatOutput(projectInfo, files, signKey)
+	if err != nil {
+		return err
 	}
 
 	// Write output
-	if outputFile != "" {
+	if outputFile != "-" {
 		// Ensure directory exists
 		if err := os.MkdirAll(filepath.Dir(outputFile), 0755); err != nil {
 			return fmt.Errorf("failed to create output directory: %w", err)
 		}
 
-		if err := os.WriteFile(outputFile, []byte(output), 0644); err != nil {
+		if err := writeFileAtomic(outputFile, []byte(output)); err != nil {
 			return fmt.Errorf("failed to write output file: %w", err)
 		}
-		fmt.Printf("Context generated and saved to %s\n", outputFile)
+		if reused > 0 {
+			fmt.Printf("Context updated in %s (%d of %d files unchanged)\n", outputFile, reused, len(files))
+		} else {
+			fmt.Printf("Context generated and saved to %s\n", outputFile)
+		}
+	} else {
+		fmt.Print(output)
+	}
+
+	return nil
+}
+
+// Generate builds the context for path in memory and returns it, metadata
+// block included. Unlike Execute, it neither reuses nor writes context files.
+// Warnings are written to stderr. A nil opts uses the configured defaults.
+func (p *ContextPlugin) Generate(path string, opts *ContextOptions) (string, error) {
+	projectInfo, result, err := p.generate(path, opts, nil)
+	if err != nil {
+		return "", err
+	}
+	return p.formatOutput(projectInfo, result.Files, nil)
+}
+
+// GenerateTo is Generate writing the context to w as it is rendered, one
+// file section at a time, rather than returning it as one string. The body
+// is rendered twice, first to checksum it for the metadata block that
+// precedes it. Errors before anything was written come from generating the
+// context; later ones are errors writing to w.
+func (p *ContextPlugin) GenerateTo(w io.Writer, path string, opts *ContextOptions) error {
+	projectInfo, result, err := p.generate(path, opts, nil)
+	if err != nil {
+		return err
+	}
+	sections := p.sections(result.Files)
+
+	hash := metadata.BodyHash()
+	p.writeBody(hash, projectInfo, sections)
+	p.metadata.SetBodyHash(hash)
+
+	if _, err := io.WriteString(w, p.metadata.String()); err != nil {
+		return err
+	}
+	return p.writeBody(w, projectInfo, sections)
+}
+
+// Collect returns the files a context for path would contain, without
+// rendering it. A nil opts uses the configured defaults.
+func (p *ContextPlugin) Collect(path string, opts *ContextOptions) (*collect.Result, error) {
+	_, result, err := p.generate(path, opts, nil)
+	return result, err
+}
+
+// Recollect is Collect for callers that collect the same project again and
+// again: files whose size and modification time match those in previous,
+// an earlier result, are taken from it instead of being read.
+func (p *ContextPlugin) Recollect(path string, opts *ContextOptions, previous *collect.Result) (*collect.Result, error) {
+	_, result, err := p.generate(path, opts, previous)
+	return result, err
+}
+
+// generate collects the files of a context for path and records them in
+// the metadata. Contents that match previous, when it is set, are taken from
+// it rather than read again.
+func (p *ContextPlugin) generate(path string, opts *ContextOptions, previous *collect.Result) (*ProjectInfo, *collect.Result, error) {
+	if opts == nil {
+		opts = &ContextOptions{}
+	}
+	p.applyOptions(opts)
+	p.status = os.Stderr
+	p.metadata = metadata.New()
+
+	projectInfo, err := DetectProject(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to detect project info: %w", err)
+	}
+	fsys, err := p.openSource(path, opts, projectInfo)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open source: %w", err)
+	}
+
+	genOpts, err := p.generationOptions(opts, projectInfo)
+	if err != nil {
+		return nil, nil, err
+	}
+	genOpts.Signed = false
+	p.metadata.SetOptions(genOpts)
+	p.metadata.GitHead = projectInfo.GitCommit
+	if root, err := filepath.Abs(path); err == nil {
+		p.metadata.Root = root
+	}
+
+	collectOpts, err := p.collectOptions(path, fsys, opts, projectInfo, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	var result *collect.Result
+	if previous != nil {
+		result, _, err = p.collectReusing(fsys, collectOpts, func(e collect.Entry) (string, bool) {
+			known, ok := previous.Entries[e.Path]
+			if !ok || known.Size != e.Size || !known.ModTime.Equal(e.ModTime) {
+				return "", false
+			}
+			content, ok := previous.Files[e.Path]
+			return content, ok
+		})
 	} else {
-		fmt.Println(output)
+		result, err = p.collectFiles(fsys, collectOpts)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to collect files: %w", err)
+	}
+	if err := p.metadata.CalculateSourceChecksum(result.Files); err != nil {
+		return nil, nil, fmt.Errorf("failed to calculate checksums: %w", err)
+	}
+	p.metadata.RecordFiles(collectOpts, result.Entries)
+
+	return projectInfo, result, nil
+}
+
+// applyOptions applies command-line options that override the config.
+func (p *ContextPlugin) applyOptions(opts *ContextOptions) {
+	if opts.Format != "" {
+		p.config.Context.OutputFormat = opts.Format
+	}
+	if opts.StructureOnly {
+		p.config.Context.IncludeFileContent = false
+	}
+	if opts.ContentOnly {
+		p.config.Context.IncludeFileStructure = false
+	}
+	p.noSectionCache = opts.NoCache || opts.Estimate
+}
+
+// useExisting serves an up-to-date context file instead of regenerating it,
+// honoring the requested output location.
+func (p *ContextPlugin) useExisting(contextPath, outputFile string) error {
+	if outputFile == "" || sameFile(contextPath, outputFile) {
+		fmt.Printf("Context is up to date: %s (use --force to regenerate)\n", contextPath)
+		return nil
+	}
+
+	content, err := os.ReadFile(contextPath)
+	if err != nil {
+		return fmt.Errorf("failed to read existing context: %w", err)
 	}
 
+	if outputFile == "-" {
+		fmt.Print(string(content))
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(outputFile), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	if err := writeFileAtomic(outputFile, content); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	fmt.Printf("Context is up to date; copied %s to %s\n", contextPath, outputFile)
 	return nil
 }
 
+// generationOptions returns the effective settings that shape the context,
+// used to decide whether an existing context can be reused.
+func (p *ContextPlugin) generationOptions(opts *ContextOptions, projectInfo *ProjectInfo) (metadata.Options, error) {
+	if _, err := filesize.Parse(p.config.Context.MaxFileSize); err != nil {
+		return metadata.Options{}, fmt.Errorf("invalid max file size: %w", err)
+	}
+
+	maxFiles := p.config.Context.MaxFilesToInclude
+	if opts.MaxFiles > 0 {
+		maxFiles = opts.MaxFiles
+	}
+
+	var patterns []string
+	patterns = append(patterns, p.config.Context.IgnorePatterns...)
+	patterns = append(patterns, opts.AdditionalIgnores...)
+
+	return metadata.Options{
+		Revision:         projectInfo.GitRevision,
+		Archive:          projectInfo.Archive,
+		Format:           p.config.Context.OutputFormat,
+		IncludeStructure: p.config.Context.IncludeFileStructure,
+		IncludeContent:   p.config.Context.IncludeFileContent,
+		Source:           p.fileSource(opts, projectInfo),
+		IncludeUntracked: p.config.Context.IncludeUntracked,
+		IgnorePatterns:   patterns,
+		MaxFileSize:      p.config.Context.MaxFileSize,
+		MaxFiles:         maxFiles,
+		SectionFormat:    sectionFormat,
+		Signed:           p.config.Context.SignKey != "",
+	}, nil
+}
+
+func (p *ContextPlugin) infof(format string, args ...any) {
+	fmt.Fprintf(p.status, format, args...)
+}
+
+func sameFile(a, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(infoA, infoB)
+}
+
 func (p *ContextPlugin) parseFlags(cmd *cobra.Command) (*ContextOptions, error) {
 	opts := &ContextOptions{}
 
@@ -257,66 +567,100 @@ func (p *ContextPlugin) parseFlags(cmd *cobra.Command) (*ContextOptions, error)
 		return nil, fmt.Errorf("error getting ignore patterns: %w", err)
 	}
 
-	// Validate flags
-	if opts.StructureOnly && opts.ContentOnly {
-		return nil, fmt.Errorf("cannot use both --structure-only and --content-only")
+	opts.Source, err = cmd.Flags().GetString("source")
+	if err != nil {
+		return nil, fmt.Errorf("error getting source flag: %w", err)
 	}
 
-	if opts.Format != "" && opts.Format != "md" && opts.Format != "txt" {
-		return nil, fmt.Errorf("invalid format: %s (must be 'md' or 'txt')", opts.Format)
+	opts.Rev, err = cmd.Flags().GetString("rev")
+	if err != nil {
+		return nil, fmt.Errorf("error getting rev flag: %w", err)
 	}
 
-	if opts.MaxFiles < 0 {
-		return nil, fmt.Errorf("max-files must be >= 0")
+	opts.Force, err = cmd.Flags().GetBool("force")
+	if err != nil {
+		return nil, fmt.Errorf("error getting force flag: %w", err)
+	}
+
+	opts.NoCache, err = cmd.Flags().GetBool("no-cache")
+	if err != nil {
+		return nil, fmt.Errorf("error getting no-cache flag: %w", err)
+	}
+
+	opts.Estimate, err = cmd.Flags().GetBool("estimate")
+	if err != nil {
+		return nil, fmt.Errorf("error getting estimate flag: %w", err)
+	}
+
+	// Validate flags
+	if err := opts.Validate(); err != nil {
+		return nil, err
 	}
 
 	return opts, nil
 }
 
-func (p *ContextPlugin) findExistingContext(path string) string {
-	candidates := []string{
-		filepath.Join(path, "context.md"),
-		filepath.Join(path, "context.txt"),
+// Validate checks that the options are consistent and in range.
+func (opts *ContextOptions) Validate() error {
+	if opts.StructureOnly && opts.ContentOnly {
+		return fmt.Errorf("cannot use both --structure-only and --content-only")
 	}
 
-	for _, candidate := range candidates {
-		if content, err := os.ReadFile(candidate); err == nil {
-			if bytes.Contains(content, []byte(metadata.MetadataMarker)) {
-				return candidate
-			}
-		}
+	if opts.Format != "" && opts.Format != "md" && opts.Format != "txt" {
+		return fmt.Errorf("invalid format: %s (must be 'md' or 'txt')", opts.Format)
+	}
+
+	if opts.MaxFiles < 0 {
+		return fmt.Errorf("max-files must be >= 0")
+	}
+
+	switch opts.Source {
+	case "", "auto", "walk", "git":
+		// valid
+	default:
+		return fmt.Errorf("invalid source: %s (must be 'auto', 'walk' or 'git')", opts.Source)
 	}
 
-	return ""
+	return nil
 }
 
 func (p *ContextPlugin) determineOutputFile(path string) string {
-    ext := ".md"
-    if p.config.Context.OutputFormat == "txt" {
-        ext = ".txt"
-    }
+	ext := ".md"
+	if p.config.Context.OutputFormat == "txt" {
+		ext = ".txt"
+	}
+
+	baseName := filepath.Join(path, "context")
+	outputFile := baseName + ext
 
-    baseName := filepath.Join(path, "context")
-    outputFile := baseName + ext
+	// Check if file exists
+	if _, err := os.Stat(outputFile); err == nil {
+		// File exists, try with timestamp
+		timestamp := time.Now().Format("20060102-150405")
+		outputFile = baseName + "-" + timestamp + ext
 
-    // Check if file exists
-    if _, err := os.Stat(outputFile); err == nil {
-        // File exists, try with timestamp
-        timestamp := time.Now().Format("20060102-150405")
-        outputFile = baseName + "-" + timestamp + ext
-    }
+		// Don't overwrite a context generated within the same second
+		for i := 2; fileExistsOS(outputFile); i++ {
+			outputFile = fmt.Sprintf("%s-%s-%d%s", baseName, timestamp, i, ext)
+		}
+	}
 
-    return outputFile
+	return outputFile
 }
 
 type ProjectInfo struct {
-	Type      string
-	GitBranch string
-	GitStatus string
-	HasGit    bool
+	Type        string `json:"type"`
+	GitBranch   string `json:"git_branch,omitempty"`
+	GitStatus   string `json:"git_status,omitempty"`
+	GitRevision string `json:"git_revision,omitempty"`
+	GitCommit   string `json:"git_commit,omitempty"`
+	HasGit      bool   `json:"has_git"`
+	Archive     string `json:"archive,omitempty"`
 }
 
-func detectProject(path string) (*ProjectInfo, error) {
+// DetectProject reports the project type and, when path is the root of a
+// git repository, its branch, commit and status.
+func DetectProject(path string) (*ProjectInfo, error) {
 	info := &ProjectInfo{}
 
 	// Detect Git
@@ -330,6 +674,13 @@ func detectProject(path string) (*ProjectInfo, error) {
 			info.GitBranch = strings.TrimSpace(string(out))
 		}
 
+		// Get the commit HEAD points to
+		cmd = exec.Command("git", "rev-parse", "HEAD")
+		cmd.Dir = path
+		if out, err := cmd.Output(); err == nil {
+			info.GitCommit = strings.TrimSpace(string(out))
+		}
+
 		// Get git status
 		cmd = exec.Command("git", "status", "--porcelain")
 		cmd.Dir = path
@@ -343,194 +694,265 @@ func detectProject(path string) (*ProjectInfo, error) {
 	}
 
 	// Project type detection
+	info.Type = detectProjectType(source.Dir(path))
+
+	return info, nil
+}
+
+func detectProjectType(fsys fs.FS) string {
 	switch {
-	case fileExists(filepath.Join(path, "package.json")):
-		info.Type = "nodejs"
-	case fileExists(filepath.Join(path, "go.mod")):
-		info.Type = "go"
-	case fileExists(filepath.Join(path, "requirements.txt")):
-		info.Type = "python"
-	case fileExists(filepath.Join(path, "composer.json")):
-		info.Type = "php"
-	case fileExists(filepath.Join(path, "Cargo.toml")):
-		info.Type = "rust"
+	case fileExists(fsys, "package.json"):
+		return "nodejs"
+	case fileExists(fsys, "go.mod"):
+		return "go"
+	case fileExists(fsys, "requirements.txt"):
+		return "python"
+	case fileExists(fsys, "composer.json"):
+		return "php"
+	case fileExists(fsys, "Cargo.toml"):
+		return "rust"
 	default:
-		info.Type = "unknown"
+		return "unknown"
 	}
-
-	return info, nil
 }
 
-func (p *ContextPlugin) collectFiles(root string, opts *ContextOptions) (map[string]string, error) {
-    files := make(map[string]string)
-    maxSize, err := filesize.Parse(p.config.Context.MaxFileSize)
-    if err != nil {
-        return nil, fmt.Errorf("invalid max file size: %w", err)
-    }
+// openSource returns the file tree the context is built from. For archives
+// and --rev it also updates projectInfo to describe that tree rather than
+// the working copy.
+func (p *ContextPlugin) openSource(path string, opts *ContextOptions, projectInfo *ProjectInfo) (fs.FS, error) {
+	if source.IsArchive(path) {
+		if opts.Rev != "" {
+			return nil, fmt.Errorf("--rev cannot be used with an archive")
+		}
 
-    // Create ignore list
-    ignoreList := ignore.New()
+		fsys, err := source.Archive(path)
+		if err != nil {
+			return nil, err
+		}
 
-	// Add configured ignore patterns
-    ignoreList.AddPatterns(p.config.Context.IgnorePatterns)
-    ignoreList.AddPatterns(opts.AdditionalIgnores)
-
-    // Detect and ignore existing context files
-    contextFiles, err := p.detectContextFiles(root)
-    if err == nil { // Don't fail if detection fails
-        for _, cf := range contextFiles {
-            relPath, err := filepath.Rel(root, cf.path)
-            if err == nil {
-                ignoreList.AddPattern(relPath)
-            }
-        }
-    }
-
-    // Add dynamic ignore patterns for context files
-    for _, pattern := range contextFilePatterns {
-        ignoreList.AddPattern(pattern)
-    }
-
-	// Load .gitignore if it exists
-	gitignorePath := filepath.Join(root, ".gitignore")
-	if err := ignoreList.LoadGitignore(gitignorePath); err != nil {
-		return nil, fmt.Errorf("error loading .gitignore: %w", err)
+		projectInfo.Type = detectProjectType(fsys)
+		projectInfo.Archive = filepath.Base(path)
+		return fsys, nil
 	}
 
-	// Add project-specific ignores
-	ignoreList.AddPatterns(getProjectSpecificIgnores(root))
+	if opts.Rev != "" {
+		fsys, rev, err := source.GitRevision(path, opts.Rev)
+		if err != nil {
+			return nil, err
+		}
 
-	// Determine max files to process
-	maxFiles := p.config.Context.MaxFilesToInclude
-	if opts.MaxFiles > 0 {
-		maxFiles = opts.MaxFiles
+		projectInfo.Type = detectProjectType(fsys)
+		projectInfo.GitBranch = rev.Name
+		projectInfo.GitStatus = ""
+		projectInfo.GitRevision = rev.Commit
+		projectInfo.GitCommit = rev.Commit
+		return fsys, nil
 	}
 
-	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+	if p.fileSource(opts, projectInfo) == "git" {
+		return source.GitWorktree(path, p.config.Context.IncludeUntracked), nil
+	}
+	return source.Dir(path), nil
+}
 
-		// Get relative path for pattern matching
-		relPath, err := filepath.Rel(root, path)
-		if err != nil {
-			return err
-		}
+// fileSource resolves the effective file source for a run. "auto" selects git
+// when the project root is a git repository and falls back to walking the
+// filesystem otherwise.
+func (p *ContextPlugin) fileSource(opts *ContextOptions, projectInfo *ProjectInfo) string {
+	source := opts.Source
+	if source == "" {
+		source = p.config.Context.Source
+	}
 
-		// Skip directories based on ignore list
-		if info.IsDir() {
-			if ignoreList.ShouldIgnore(relPath) {
-				return filepath.SkipDir
-			}
-			return nil
+	switch source {
+	case "walk", "git":
+		return source
+	default:
+		if projectInfo != nil && projectInfo.HasGit {
+			return "git"
 		}
+		return "walk"
+	}
+}
 
-		// Skip files based on ignore list and other criteria
-		if ignoreList.ShouldIgnore(relPath) {
-			return nil
-		}
+// collectOptions resolves the collector settings for a run: configured and
+// command-line ignores, existing context files, the output file itself and
+// project-specific build directories.
+func (p *ContextPlugin) collectOptions(root string, fsys fs.FS, opts *ContextOptions, projectInfo *ProjectInfo, outputFile string) (collect.Options, error) {
+	maxSize, err := filesize.Parse(p.config.Context.MaxFileSize)
+	if err != nil {
+		return collect.Options{}, fmt.Errorf("invalid max file size: %w", err)
+	}
 
-		// Skip files based on size
-		if info.Size() > maxSize {
-			return nil
+	// Add configured ignore patterns
+	var patterns []string
+	patterns = append(patterns, p.config.Context.IgnorePatterns...)
+	patterns = append(patterns, opts.AdditionalIgnores...)
+
+	// Add dynamic ignore patterns for context files
+	patterns = append(patterns, contextFilePatterns...)
+
+	// Detect and ignore existing context files, and the one about to be
+	// written when it lives inside the project. They're sorted and
+	// deduplicated so rerunning into the same file records the same options.
+	existing := make(map[string]bool)
+	if outputFile != "" && outputFile != "-" {
+		if relPath, err := filepath.Rel(root, outputFile); err == nil && !strings.HasPrefix(relPath, "..") {
+			existing[filepath.ToSlash(relPath)] = true
 		}
-
-		// Skip binary files based on extension
-		if isBinaryExtension(strings.ToLower(filepath.Ext(relPath))) {
-			return nil
+	}
+	contextFiles, err := p.detectContextFiles(root)
+	if err == nil { // Don't fail if detection fails
+		for _, cf := range contextFiles {
+			if relPath, err := filepath.Rel(root, cf.path); err == nil {
+				existing[filepath.ToSlash(relPath)] = true
+			}
 		}
+	}
+	existingPatterns := make([]string, 0, len(existing))
+	for relPath := range existing {
+		existingPatterns = append(existingPatterns, relPath)
+	}
+	sort.Strings(existingPatterns)
+	patterns = append(patterns, existingPatterns...)
 
-		// Read and check file content
-		content, err := os.ReadFile(path)
-		if err != nil {
-			return nil // Skip files we can't read
-		}
+	// Never include backups written by "mktools apply"
+	patterns = append(patterns, BackupDir+"/")
 
-		// Skip binary and special files
-		if !isTextContent(content) {
-			return nil
-		}
+	// Add project-specific ignores
+	patterns = append(patterns, getProjectSpecificIgnores(fsys)...)
 
-		files[relPath] = string(content)
+	// Determine max files to process
+	maxFiles := p.config.Context.MaxFilesToInclude
+	if opts.MaxFiles > 0 {
+		maxFiles = opts.MaxFiles
+	}
 
-		// Check max files limit
-		if maxFiles > 0 && len(files) >= maxFiles {
-			return io.EOF
-		}
+	return collect.Options{
+		Source:           p.fileSource(opts, projectInfo),
+		IncludeUntracked: p.config.Context.IncludeUntracked,
+		IgnorePatterns:   patterns,
+		MaxFileSize:      maxSize,
+		MaxFiles:         maxFiles,
+	}, nil
+}
 
-		return nil
-	})
+func (p *ContextPlugin) collectFiles(fsys fs.FS, opts collect.Options) (*collect.Result, error) {
+	collector, err := collect.New(fsys, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := collector.Collect()
+	if err != nil {
+		return nil, err
+	}
 
-	if err == io.EOF {
-		fmt.Printf("Warning: Only including first %d files due to limit\n", maxFiles)
-		return files, nil
+	if result.Truncated {
+		p.infof("Warning: Only including first %d files due to limit\n", opts.MaxFiles)
 	}
 
-	return files, err
+	return result, nil
 }
 
-func shouldIgnorePath(path string, patterns []string) bool {
-	// Always ignore .git directory and its contents
-	if path == ".git" || strings.HasPrefix(path, ".git/") {
-		return true
+// collectIncremental collects the same files as collectFiles, but takes the
+// content of files whose size and modification time haven't changed from the
+// previous context instead of reading them again. It returns a nil result
+// when the previous context can't be reused, such as a structure-only one.
+func (p *ContextPlugin) collectIncremental(fsys fs.FS, opts collect.Options, previous *contextFile) (*collect.Result, int, error) {
+	content, err := os.ReadFile(previous.path)
+	if err != nil {
+		return nil, 0, nil
+	}
+	doc, err := contextfile.Parse(string(content))
+	if err != nil || len(doc.Files) != len(previous.metadata.FileChecksums) {
+		return nil, 0, nil
 	}
 
-	for _, pattern := range patterns {
-		if matched, _ := filepath.Match(pattern, path); matched {
-			return true
-		}
-		// Handle directory patterns that end with "/"
-		if strings.HasSuffix(pattern, "/") {
-			if matched, _ := filepath.Match(pattern[:len(pattern)-1], path); matched {
-				return true
-			}
+	// Only trust sections that still match their recorded checksum
+	sections := make(map[string]string, len(doc.Files))
+	for _, f := range doc.Files {
+		sum := sha256.Sum256([]byte(f.Content))
+		if previous.metadata.FileChecksums[f.Path] == hex.EncodeToString(sum[:]) {
+			sections[f.Path] = f.Content
 		}
 	}
-	return false
+
+	return p.collectReusing(fsys, opts, func(e collect.Entry) (string, bool) {
+		info, known := previous.metadata.Files[e.Path]
+		section, ok := sections[e.Path]
+		return section, ok && known && info.Size == e.Size && info.ModTime.Equal(e.ModTime)
+	})
 }
 
-func shouldSkipFile(path string, info os.FileInfo, maxSize int64, patterns []string) bool {
-	// Check size
-	if info.Size() > maxSize {
-		return true
+// collectReusing collects the same files as collectFiles, taking the content
+// of each from reuse when it has it and reading the rest. It also returns
+// the number of files reused.
+func (p *ContextPlugin) collectReusing(fsys fs.FS, opts collect.Options, reuse func(e collect.Entry) (string, bool)) (*collect.Result, int, error) {
+	collector, err := collect.New(fsys, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	result := &collect.Result{
+		Files:   make(map[string]string),
+		Entries: make(map[string]collect.Entry),
+	}
+	reused := 0
+	result.Truncated, err = collector.Walk(func(e collect.Entry) (bool, error) {
+		if content, ok := reuse(e); ok {
+			result.Files[e.Path] = content
+			result.Entries[e.Path] = e
+			reused++
+			return true, nil
+		}
+
+		content, ok := collector.Read(e)
+		if !ok {
+			return false, nil
+		}
+		result.Files[e.Path] = content
+		result.Entries[e.Path] = e
+		return true, nil
+	})
+	if err != nil {
+		return nil, 0, err
 	}
 
-	// Check patterns
-	if shouldIgnorePath(path, patterns) {
-		return true
+	if result.Truncated {
+		p.infof("Warning: Only including first %d files due to limit\n", opts.MaxFiles)
 	}
 
-	// Check extension for binary/non-text files
-	ext := strings.ToLower(filepath.Ext(path))
-	return isBinaryExtension(ext)
+	return result, reused, nil
 }
 
-func isBinaryExtension(ext string) bool {
-	binaryExts := map[string]bool{
-		// Executables
-		".exe": true, ".dll": true, ".so": true, ".dylib": true,
-		// Archives
-		".zip": true, ".tar": true, ".gz": true, ".rar": true, ".7z": true,
-		// Images
-		".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".bmp": true,
-		".ico": true, ".svg": true, ".webp": true,
-		// Audio/Video
-		".mp3": true, ".wav": true, ".ogg": true, ".mp4": true, ".avi": true,
-		".mov": true, ".wmv": true, ".flv": true,
-		// Documents
-		".pdf": true, ".doc": true, ".docx": true, ".xls": true, ".xlsx": true,
-		".ppt": true, ".pptx": true,
-		// Other binary formats
-		".bin": true, ".dat": true, ".db": true, ".sqlite": true,
+// writeFileAtomic replaces path with data through a temporary file in the
+// same directory, so readers never see a partially written context.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
 	}
-	return binaryExts[ext]
+	return os.Rename(tmp.Name(), path)
 }
 
-func getProjectSpecificIgnores(root string) []string {
+func getProjectSpecificIgnores(fsys fs.FS) []string {
 	var ignores []string
 
 	// Node.js project
-	if fileExists(filepath.Join(root, "package.json")) {
+	if fileExists(fsys, "package.json") {
 		ignores = append(ignores,
 			"node_modules/",
 			"dist/",
@@ -542,7 +964,7 @@ func getProjectSpecificIgnores(root string) []string {
 	}
 
 	// Go project
-	if fileExists(filepath.Join(root, "go.mod")) {
+	if fileExists(fsys, "go.mod") {
 		ignores = append(ignores,
 			"vendor/",
 			"bin/",
@@ -551,8 +973,8 @@ func getProjectSpecificIgnores(root string) []string {
 	}
 
 	// Python project
-	if fileExists(filepath.Join(root, "requirements.txt")) ||
-		fileExists(filepath.Join(root, "setup.py")) {
+	if fileExists(fsys, "requirements.txt") ||
+		fileExists(fsys, "setup.py") {
 		ignores = append(ignores,
 			"venv/",
 			"env/",
@@ -568,7 +990,7 @@ func getProjectSpecificIgnores(root string) []string {
 	}
 
 	// Java/Maven project
-	if fileExists(filepath.Join(root, "pom.xml")) {
+	if fileExists(fsys, "pom.xml") {
 		ignores = append(ignores,
 			"target/",
 			"*.class",
@@ -579,96 +1001,136 @@ func getProjectSpecificIgnores(root string) []string {
 	return ignores
 }
 
-func isTextContent(content []byte) bool {
-	if len(content) == 0 {
-		return true
+// formatOutput renders the context. The metadata header is rendered last,
+// so it can record the checksum of the body and, when key is set, sign it.
+func (p *ContextPlugin) formatOutput(projectInfo *ProjectInfo, files map[string]string, key ed25519.PrivateKey) (string, error) {
+	return p.formatSections(projectInfo, p.sections(files), key)
+}
+
+// sections renders the section of each file, keyed by path. Sections are
+// empty when the context doesn't include file contents. Rendered sections
+// are cached by file checksum and rendering settings.
+func (p *ContextPlugin) sections(files map[string]string) map[string]string {
+	sections := make(map[string]string, len(files))
+	if !p.config.Context.IncludeFileContent {
+		for path := range files {
+			sections[path] = ""
+		}
+		return sections
 	}
 
-	// Check for null bytes which usually indicate binary data
-	for _, b := range content {
-		if b == 0 {
-			return false
+	// The cache is an optimization; render without it if it's unavailable
+	var store *cache.Store
+	if !p.noSectionCache {
+		store, _ = cache.Open(SectionCacheName)
+	}
+	if store == nil {
+		for path, content := range files {
+			sections[path] = contextfile.Section(path, content)
 		}
+		return sections
 	}
 
-	// Try to detect text by checking if content is valid UTF-8
-	return utf8.Valid(content)
+	// The size limit is enforced once for the whole context rather than
+	// after every Put
+	store.SetLimits(sectionCacheTTL, 0)
+	stored := 0
+	for path, content := range files {
+		key := cache.Key(sectionFormat, p.config.Context.OutputFormat, path, p.metadata.FileChecksums[path])
+		if section, ok := store.Get(key); ok {
+			sections[path] = string(section)
+			continue
+		}
+		sections[path] = contextfile.Section(path, content)
+		if store.Put(key, []byte(sections[path])) == nil {
+			stored++
+		}
+	}
+	if stored > 0 {
+		store.SetLimits(sectionCacheTTL, sectionCacheMaxSize)
+		store.Prune()
+	}
+	return sections
 }
 
-func (p *ContextPlugin) formatOutput(projectInfo *ProjectInfo, files map[string]string) string {
+// formatSections renders the context from the already rendered sections of
+// its files.
+func (p *ContextPlugin) formatSections(projectInfo *ProjectInfo, sections map[string]string, key ed25519.PrivateKey) (string, error) {
 	var output strings.Builder
+	p.writeBody(&output, projectInfo, sections)
 
-	// Add metadata header
-	output.WriteString(p.metadata.String())
+	body := output.String()
+	p.metadata.SetBody(body)
+	if key != nil {
+		if err := p.metadata.Sign(key); err != nil {
+			return "", fmt.Errorf("failed to sign context: %w", err)
+		}
+	}
+
+	return p.metadata.String() + body, nil
+}
+
+// writeBody writes the text that follows the metadata block: the project
+// information and file structure in one piece, then each file section.
+func (p *ContextPlugin) writeBody(w io.Writer, projectInfo *ProjectInfo, sections map[string]string) error {
+	var output strings.Builder
 	output.WriteString("\n\n")
 
 	// Add project info
 	output.WriteString("# Project Information\n\n")
 	output.WriteString(fmt.Sprintf("Type: %s\n", projectInfo.Type))
-	if projectInfo.HasGit {
+	if projectInfo.GitRevision != "" {
+		output.WriteString(fmt.Sprintf("Git Revision: %s (%s)\n", projectInfo.GitBranch, projectInfo.GitRevision))
+	} else if projectInfo.HasGit {
 		output.WriteString(fmt.Sprintf("Git Branch: %s\n", projectInfo.GitBranch))
 		output.WriteString(fmt.Sprintf("Git Status: %s\n", projectInfo.GitStatus))
 	}
 	output.WriteString("\n")
 
+	paths := make([]string, 0, len(sections))
+	for path := range sections {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
 	// Add file structure
 	if p.config.Context.IncludeFileStructure {
 		output.WriteString("# File Structure\n\n```\n")
-		paths := make([]string, 0, len(files))
-		for path := range files {
-			paths = append(paths, path)
-		}
-		sort.Strings(paths)
 		for _, path := range paths {
 			output.WriteString(path + "\n")
 		}
 		output.WriteString("```\n\n")
 	}
 
-	// Add file contents
-	if p.config.Context.IncludeFileContent {
-		output.WriteString("# File Contents\n\n")
-		paths := make([]string, 0, len(files))
-		for path := range files {
-			paths = append(paths, path)
-		}
-		sort.Strings(paths)
-		for _, path := range paths {
-			// Get file extension safely
-			ext := filepath.Ext(path)
-			language := ""
-			if len(ext) > 0 {
-				// Remove the dot from extension
-				language = ext[1:]
-			}
+	if !p.config.Context.IncludeFileContent {
+		_, err := io.WriteString(w, output.String())
+		return err
+	}
 
-			output.WriteString(fmt.Sprintf("## %s\n\n```%s\n%s\n```\n\n",
-				path,
-				language,
-				files[path]))
+	// Add file contents
+	output.WriteString("# File Contents\n\n")
+	if _, err := io.WriteString(w, output.String()); err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if _, err := io.WriteString(w, sections[path]); err != nil {
+			return err
 		}
 	}
-
-	return output.String()
+	return nil
 }
 
-func fileExists(path string) bool {
+// sectionFormat versions the rendering of file sections. Bump it whenever
+// contextfile.Section changes so existing contexts are regenerated and
+// cached sections are not reused.
+const sectionFormat = "1"
+
+func fileExistsOS(path string) bool {
 	_, err := os.Stat(path)
 	return err == nil
 }
 
-// isText reports whether a given content appears to be text data.
-func isText(content []byte) bool {
-	if len(content) == 0 {
-		return true
-	}
-
-	// Check for null bytes which usually indicate binary data
-	for _, b := range content {
-		if b == 0 {
-			return false
-		}
-	}
-
-	return true
+func fileExists(fsys fs.FS, name string) bool {
+	_, err := fs.Stat(fsys, name)
+	return err == nil
 }
@@ -0,0 +1,103 @@
+package context
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/amenophis1er/mktools/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// gitRepo creates a repository whose tag v1 has notes.txt saying "one" and
+// whose HEAD has it saying "two".
+func gitRepo(t *testing.T) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	run := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	write := func(content string) {
+		if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run("init", "-q")
+	write("one\n")
+	run("add", "notes.txt")
+	run("commit", "-q", "-m", "one")
+	run("tag", "v1")
+	write("two\n")
+	run("commit", "-q", "-am", "two")
+	return dir
+}
+
+func runContext(t *testing.T, dir string, args ...string) {
+	// Keep rendered sections out of the user's cache
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	p := New(config.DefaultConfig())
+	cmd := &cobra.Command{Use: "context"}
+	p.AddFlags(cmd)
+	if err := cmd.ParseFlags(args); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Execute(context.Background(), cmd, []string{dir}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRevisionContextNotReused(t *testing.T) {
+	dir := gitRepo(t)
+
+	runContext(t, dir, "--rev", "v1")
+	revContext, err := os.ReadFile(filepath.Join(dir, "context.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(revContext), "one") {
+		t.Fatalf("context of v1 doesn't hold its notes.txt:\n%s", revContext)
+	}
+
+	// The working copy differs from v1, but the context of v1 must be
+	// neither updated in place nor reported as up to date
+	runContext(t, dir)
+
+	after, err := os.ReadFile(filepath.Join(dir, "context.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(revContext) {
+		t.Error("context of v1 was overwritten by a context of the working copy")
+	}
+	contexts, err := filepath.Glob(filepath.Join(dir, "context-*.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contexts) != 1 {
+		t.Fatalf("contexts = %v, want one new context of the working copy", contexts)
+	}
+	current, err := os.ReadFile(contexts[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(current), "two") {
+		t.Errorf("context of the working copy doesn't hold its notes.txt:\n%s", current)
+	}
+
+	// That context is then the one reused
+	runContext(t, dir)
+	if again, _ := filepath.Glob(filepath.Join(dir, "context-*.md")); len(again) != 1 {
+		t.Errorf("contexts = %v, want the working copy context reused", again)
+	}
+}
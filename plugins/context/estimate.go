@@ -0,0 +1,118 @@
+package context
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/amenophis1er/mktools/internal/llm"
+)
+
+// estimateTopFiles is the number of files listed by --estimate.
+const estimateTopFiles = 20
+
+// estimateModel is a configured model the context may be sent to.
+type estimateModel struct {
+	provider string
+	model    string
+	role     string
+}
+
+// estimate collects and renders the context for path in memory and reports
+// its size, the cost of sending it to the configured models and whether it
+// fits their context windows. Nothing is written.
+func (p *ContextPlugin) estimate(path string, opts *ContextOptions) error {
+	projectInfo, result, err := p.generate(path, opts, nil)
+	if err != nil {
+		return err
+	}
+	// Each file is rendered once, for both the total and its own share
+	sections := p.sections(result.Files)
+	output, err := p.formatSections(projectInfo, sections, nil)
+	if err != nil {
+		return err
+	}
+	tokens := llm.EstimateTokens(output)
+
+	fmt.Printf("Context estimate for %s (%s project)\n\n", path, projectInfo.Type)
+	fmt.Printf("  Files:       %s\n", formatCount(len(result.Files)))
+	fmt.Printf("  Characters:  %s\n", formatCount(len(output)))
+	fmt.Printf("  Tokens:      ~%s (at about 4 characters per token)\n\n", formatCount(tokens))
+
+	cfg := p.config.LLM
+	models := []estimateModel{{provider: cfg.Provider, model: cfg.Model}}
+	if fb := cfg.Fallback; fb != nil && fb.Provider != "" {
+		models = append(models, estimateModel{provider: fb.Provider, model: fb.Model, role: " (fallback)"})
+	}
+
+	unknown := false
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MODEL\tTOKENS\tINPUT COST\tCONTEXT WINDOW\tFITS")
+	for _, m := range models {
+		cost, window, fits := "-", "-", "unknown"
+		info, ok := cfg.LookupModel(m.model)
+		unknown = unknown || !ok || info.ContextWindow == 0
+		if ok {
+			cost = fmt.Sprintf("$%.4f", info.Cost(tokens, 0))
+			if info.ContextWindow > 0 {
+				window = formatCount(info.ContextWindow)
+				share := float64(tokens) / float64(info.ContextWindow) * 100
+				if tokens <= info.ContextWindow {
+					fits = fmt.Sprintf("yes (%.0f%% of the window)", share)
+				} else {
+					fits = fmt.Sprintf("NO (%.0f%% of the window)", share)
+				}
+			}
+		}
+		fmt.Fprintf(w, "%s/%s%s\t~%s\t%s\t%s\t%s\n", m.provider, m.model, m.role, formatCount(tokens), cost, window, fits)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if p.config.Context.IncludeFileContent && len(result.Files) > 0 {
+		type fileTokens struct {
+			path   string
+			tokens int
+		}
+		files := make([]fileTokens, 0, len(result.Files))
+		for path, section := range sections {
+			files = append(files, fileTokens{path: path, tokens: llm.EstimateTokens(section)})
+		}
+		sort.Slice(files, func(i, j int) bool {
+			if files[i].tokens != files[j].tokens {
+				return files[i].tokens > files[j].tokens
+			}
+			return files[i].path < files[j].path
+		})
+		if len(files) > estimateTopFiles {
+			files = files[:estimateTopFiles]
+		}
+
+		fmt.Printf("\nLargest files:\n\n")
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "FILE\tTOKENS\tSHARE")
+		for _, f := range files {
+			fmt.Fprintf(w, "%s\t~%s\t%.1f%%\n", f.path, formatCount(f.tokens), float64(f.tokens)/float64(tokens)*100)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if unknown {
+		fmt.Println("\nSet the prices and context window of your models under llm.models for a complete estimate.")
+	}
+	return nil
+}
+
+// formatCount formats n with thousands separators.
+func formatCount(n int) string {
+	s := strconv.Itoa(n)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
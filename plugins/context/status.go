@@ -0,0 +1,189 @@
+package context
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/amenophis1er/mktools/internal/contextfile"
+	"github.com/amenophis1er/mktools/internal/diff"
+	"github.com/amenophis1er/mktools/internal/metadata"
+)
+
+// ContextState is the freshness of a context file: "fresh" when it still
+// matches the files it was generated from, "stale" with the changes since
+// when it doesn't, and "unknown" with the error when it can't be checked.
+type ContextState struct {
+	Path        string            `json:"path"`
+	GeneratedAt time.Time         `json:"generated_at"`
+	State       string            `json:"state"`
+	Changes     *metadata.Changes `json:"changes,omitempty"`
+	Error       string            `json:"error,omitempty"`
+}
+
+// States checks every context file in dir, newest first.
+func (p *ContextPlugin) States(dir string) ([]ContextState, error) {
+	contextFiles, err := p.detectContextFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Newest first
+	sort.Slice(contextFiles, func(i, j int) bool {
+		return contextFiles[i].metadata.GeneratedAt.After(contextFiles[j].metadata.GeneratedAt)
+	})
+
+	states := make([]ContextState, 0, len(contextFiles))
+	for _, cf := range contextFiles {
+		state := ContextState{Path: cf.path, GeneratedAt: cf.metadata.GeneratedAt}
+
+		changes, err := cf.metadata.SourceChanges(dir)
+		switch {
+		case err != nil:
+			state.State, state.Error = "unknown", err.Error()
+		case changes.Empty():
+			state.State = "fresh"
+		default:
+			state.State, state.Changes = "stale", changes
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// Status reports, for each context file in dir, whether it still matches the
+// files it was generated from and what changed since.
+func (p *ContextPlugin) Status(dir string) error {
+	states, err := p.States(dir)
+	if err != nil {
+		return err
+	}
+	if len(states) == 0 {
+		fmt.Printf("No context files found in %s\n", dir)
+		return nil
+	}
+
+	for _, state := range states {
+		generated := state.GeneratedAt.Local().Format("2006-01-02 15:04:05")
+
+		switch state.State {
+		case "unknown":
+			fmt.Printf("%s: unknown (generated %s): %s\n", state.Path, generated, state.Error)
+		case "fresh":
+			fmt.Printf("%s: fresh (generated %s)\n", state.Path, generated)
+		default:
+			fmt.Printf("%s: stale (generated %s): %s\n", state.Path, generated, state.Changes.Summary())
+			printChanges(state.Changes)
+		}
+	}
+
+	return nil
+}
+
+// Diff compares two context files: which files were added, modified or
+// removed between them, followed by the content differences unless
+// nameOnly is set.
+func (p *ContextPlugin) Diff(pathA, pathB string, nameOnly bool) error {
+	docA, err := readContextFile(pathA)
+	if err != nil {
+		return err
+	}
+	docB, err := readContextFile(pathB)
+	if err != nil {
+		return err
+	}
+
+	changes := compareChecksums(docA.Metadata, docB.Metadata)
+	if changes.Empty() {
+		fmt.Println("No differences in file contents")
+		return nil
+	}
+
+	fmt.Printf("%s -> %s: %s\n", pathA, pathB, changes.Summary())
+	printChanges(changes)
+
+	if nameOnly {
+		return nil
+	}
+
+	// Show content differences for files both contexts include contents for
+	var paths []string
+	paths = append(paths, changes.Added...)
+	paths = append(paths, changes.Modified...)
+	paths = append(paths, changes.Removed...)
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		a, inA := docA.File(path)
+		b, inB := docB.File(path)
+		if !inA && !inB {
+			continue
+		}
+
+		fromName, toName := "a/"+path, "b/"+path
+		if _, known := docA.Metadata.FileChecksums[path]; !known {
+			fromName = diff.DevNull
+		}
+		if _, known := docB.Metadata.FileChecksums[path]; !known {
+			toName = diff.DevNull
+		}
+
+		fmt.Println()
+		fmt.Print(diff.Unified(fromName, toName, a.Content, b.Content))
+	}
+
+	return nil
+}
+
+func readContextFile(path string) (*contextfile.Document, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read context file: %w", err)
+	}
+
+	doc, err := contextfile.Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if doc.Metadata == nil {
+		return nil, fmt.Errorf("%s has no mktools metadata", path)
+	}
+	return doc, nil
+}
+
+// compareChecksums returns the files that differ between two contexts.
+func compareChecksums(a, b *metadata.Metadata) *metadata.Changes {
+	changes := &metadata.Changes{}
+	for path, sumB := range b.FileChecksums {
+		sumA, ok := a.FileChecksums[path]
+		switch {
+		case !ok:
+			changes.Added = append(changes.Added, path)
+		case sumA != sumB:
+			changes.Modified = append(changes.Modified, path)
+		}
+	}
+	for path := range a.FileChecksums {
+		if _, ok := b.FileChecksums[path]; !ok {
+			changes.Removed = append(changes.Removed, path)
+		}
+	}
+
+	sort.Strings(changes.Added)
+	sort.Strings(changes.Modified)
+	sort.Strings(changes.Removed)
+	return changes
+}
+
+func printChanges(changes *metadata.Changes) {
+	for _, path := range changes.Added {
+		fmt.Printf("  A %s\n", path)
+	}
+	for _, path := range changes.Modified {
+		fmt.Printf("  M %s\n", path)
+	}
+	for _, path := range changes.Removed {
+		fmt.Printf("  D %s\n", path)
+	}
+}
@@ -0,0 +1,98 @@
+package context
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/amenophis1er/mktools/internal/contextfile"
+)
+
+// UnpackOptions controls how a context file is restored to disk.
+type UnpackOptions struct {
+	OutputDir string
+	Force     bool
+	Strict    bool
+}
+
+// Unpack recreates the files embedded in a context file under opts.OutputDir
+// and verifies each one against the checksums recorded in its metadata.
+// Mismatches are reported rather than treated as errors unless opts.Strict
+// is set, because restoring a context edited by an LLM is a supported use.
+func (p *ContextPlugin) Unpack(contextPath string, opts UnpackOptions) error {
+	content, err := os.ReadFile(contextPath)
+	if err != nil {
+		return fmt.Errorf("failed to read context file: %w", err)
+	}
+
+	doc, err := contextfile.Parse(string(content))
+	if err != nil {
+		return fmt.Errorf("failed to parse context file: %w", err)
+	}
+	if len(doc.Files) == 0 {
+		return fmt.Errorf("%s contains no file contents to unpack", contextPath)
+	}
+	if doc.Metadata == nil {
+		fmt.Println("Warning: no metadata found, files cannot be verified")
+	}
+
+	// Validate every path before writing anything
+	for _, f := range doc.Files {
+		if err := contextfile.ValidatePath(f.Path); err != nil {
+			return err
+		}
+		target := filepath.Join(opts.OutputDir, filepath.FromSlash(f.Path))
+		if _, err := os.Stat(target); err == nil && !opts.Force {
+			return fmt.Errorf("%s already exists (use --force to overwrite)", target)
+		}
+	}
+
+	var mismatched []string
+	restored := make(map[string]bool)
+	for _, f := range doc.Files {
+		target := filepath.Join(opts.OutputDir, filepath.FromSlash(f.Path))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", f.Path, err)
+		}
+		if err := os.WriteFile(target, []byte(f.Content), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", f.Path, err)
+		}
+		restored[f.Path] = true
+
+		if doc.Metadata == nil {
+			continue
+		}
+		sum := sha256.Sum256([]byte(f.Content))
+		if expected, ok := doc.Metadata.FileChecksums[f.Path]; !ok || expected != hex.EncodeToString(sum[:]) {
+			mismatched = append(mismatched, f.Path)
+		}
+	}
+
+	fmt.Printf("Restored %d files to %s\n", len(doc.Files), opts.OutputDir)
+
+	var missing []string
+	if doc.Metadata != nil {
+		for path := range doc.Metadata.FileChecksums {
+			if !restored[path] {
+				missing = append(missing, path)
+			}
+		}
+	}
+	sort.Strings(missing)
+
+	for _, path := range mismatched {
+		fmt.Printf("Checksum mismatch: %s\n", path)
+	}
+	for _, path := range missing {
+		fmt.Printf("Missing from context: %s\n", path)
+	}
+
+	if opts.Strict && len(mismatched)+len(missing) > 0 {
+		return fmt.Errorf("%d file(s) failed verification", len(mismatched)+len(missing))
+	}
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package context
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/amenophis1er/mktools/internal/contextfile"
+	"github.com/amenophis1er/mktools/internal/metadata"
+)
+
+// VerifyOptions controls how a context file is verified.
+type VerifyOptions struct {
+	// KeyFile is a PEM public (or private) key the context must be signed
+	// with. Without it, the key embedded in the signature is used.
+	KeyFile       string
+	AllowUnsigned bool
+}
+
+// Verify checks that a context file is intact: its signature matches the
+// metadata, the body matches the recorded body checksum, and every embedded
+// file matches its recorded checksum. Problems are listed before an error is
+// returned.
+func (p *ContextPlugin) Verify(contextPath string, opts VerifyOptions) error {
+	var trusted ed25519.PublicKey
+	if opts.KeyFile != "" {
+		key, err := metadata.LoadPublicKey(opts.KeyFile)
+		if err != nil {
+			return err
+		}
+		trusted = key
+	}
+
+	content, err := os.ReadFile(contextPath)
+	if err != nil {
+		return fmt.Errorf("failed to read context file: %w", err)
+	}
+	doc, err := contextfile.Parse(string(content))
+	if err != nil {
+		return fmt.Errorf("failed to parse context file: %w", err)
+	}
+	if doc.Metadata == nil {
+		return fmt.Errorf("%s has no metadata to verify", contextPath)
+	}
+	meta := doc.Metadata
+
+	var problems []string
+
+	// Signature
+	switch err := meta.VerifySignature(trusted); {
+	case err == nil:
+		signer, _ := meta.SignerKey()
+		if trusted != nil {
+			fmt.Printf("Signature: valid, trusted key %s\n", metadata.KeyFingerprint(signer))
+		} else {
+			fmt.Printf("Signature: valid, embedded key %s (pass --key to check the signer)\n", metadata.KeyFingerprint(signer))
+		}
+	case errors.Is(err, metadata.ErrUnsigned):
+		fmt.Println("Signature: none")
+		if !opts.AllowUnsigned || trusted != nil {
+			problems = append(problems, "context is not signed")
+		}
+	default:
+		fmt.Printf("Signature: invalid (%v)\n", err)
+		problems = append(problems, err.Error())
+	}
+
+	// Body
+	body, _ := metadata.Body(string(content))
+	switch {
+	case meta.BodyChecksum == "":
+		fmt.Println("Body: no checksum recorded")
+		if meta.Signature != nil {
+			problems = append(problems, "signed context has no body checksum")
+		}
+	case meta.VerifyBody(body):
+		fmt.Println("Body: matches checksum")
+	default:
+		fmt.Println("Body: modified after generation")
+		problems = append(problems, "body does not match its checksum")
+	}
+
+	// Per-file checksums
+	files := make(map[string]string, len(doc.Files))
+	for _, f := range doc.Files {
+		files[f.Path] = f.Content
+	}
+	computed := metadata.New()
+	if err := computed.CalculateSourceChecksum(files); err != nil {
+		return fmt.Errorf("failed to calculate checksums: %w", err)
+	}
+
+	var mismatched, unexpected, missing []string
+	for path, sum := range computed.FileChecksums {
+		expected, ok := meta.FileChecksums[path]
+		switch {
+		case !ok:
+			unexpected = append(unexpected, path)
+		case expected != sum:
+			mismatched = append(mismatched, path)
+		}
+	}
+	if len(doc.Files) > 0 {
+		for path := range meta.FileChecksums {
+			if _, ok := files[path]; !ok {
+				missing = append(missing, path)
+			}
+		}
+	}
+	sort.Strings(mismatched)
+	sort.Strings(unexpected)
+	sort.Strings(missing)
+
+	for _, path := range mismatched {
+		fmt.Printf("Checksum mismatch: %s\n", path)
+		problems = append(problems, "checksum mismatch: "+path)
+	}
+	for _, path := range unexpected {
+		fmt.Printf("Not in metadata: %s\n", path)
+		problems = append(problems, "unrecorded file: "+path)
+	}
+	for _, path := range missing {
+		fmt.Printf("Missing from context: %s\n", path)
+		problems = append(problems, "missing file: "+path)
+	}
+
+	switch {
+	case len(doc.Files) == 0:
+		fmt.Println("Files: no file contents to verify")
+	case len(missing)+len(mismatched)+len(unexpected) == 0 && computed.ChecksumSource != meta.ChecksumSource:
+		problems = append(problems, "source checksum does not match")
+		fmt.Println("Files: source checksum does not match")
+	default:
+		fmt.Printf("Files: %d of %d verified\n", len(doc.Files)-len(mismatched)-len(unexpected), len(meta.FileChecksums))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%s failed verification: %d problem(s)", contextPath, len(problems))
+	}
+	fmt.Printf("%s verified\n", contextPath)
+	return nil
+}
+
+// Keygen creates an ed25519 key pair for signing contexts.
+func (p *ContextPlugin) Keygen(path string) error {
+	pub, err := metadata.GenerateKeyFiles(path)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Private key written to %s\n", path)
+	fmt.Printf("Public key written to %s.pub\n", path)
+	fmt.Printf("Key fingerprint: %s\n", metadata.KeyFingerprint(pub))
+	fmt.Println("Set context.sign_key to the private key path to sign generated contexts.")
+	return nil
+}
@@ -0,0 +1,177 @@
+// Package mcp serves a project to Model Context Protocol clients, such as
+// editor agents and desktop LLM applications, over JSON-RPC on stdio. The
+// tools only see the files a context would contain, so clients are bound by
+// the same ignore policy as "mktools context".
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/amenophis1er/mktools/internal/collect"
+	"github.com/amenophis1er/mktools/internal/config"
+	ctxplugin "github.com/amenophis1er/mktools/plugins/context"
+	"github.com/amenophis1er/mktools/version"
+	"github.com/spf13/cobra"
+)
+
+type MCPPlugin struct {
+	config *config.Config
+}
+
+type MCPOptions struct {
+	AdditionalIgnores []string
+}
+
+func New(cfg *config.Config) *MCPPlugin {
+	return &MCPPlugin{
+		config: cfg,
+	}
+}
+
+func (p *MCPPlugin) Name() string {
+	return "mcp"
+}
+
+func (p *MCPPlugin) Description() string {
+	return "Serve a project to MCP clients over stdio"
+}
+
+func (p *MCPPlugin) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceP("ignore", "i", []string{}, "additional patterns to hide from clients")
+}
+
+// Execute serves the project at args[0], or the current directory, until
+// stdin is closed. Stdout carries the protocol, so logs go to stderr.
+func (p *MCPPlugin) Execute(ctx context.Context, cmd *cobra.Command, args []string) error {
+	opts, err := p.parseFlags(cmd)
+	if err != nil {
+		return err
+	}
+
+	path := "."
+	if len(args) > 0 {
+		path = args[0]
+	}
+	root, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve path: %w", err)
+	}
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return fmt.Errorf("not a directory: %s", path)
+	}
+
+	// Clients start the server from anywhere, so the project's own
+	// configuration applies rather than the current directory's
+	cfg, err := config.LoadDir(root)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	s := &server{root: root, opts: opts, contexts: ctxplugin.New(cfg)}
+	fmt.Fprintf(os.Stderr, "mktools MCP server for %s ready on stdio\n", root)
+	return serve(os.Stdin, os.Stdout, s.handlers())
+}
+
+func (p *MCPPlugin) parseFlags(cmd *cobra.Command) (*MCPOptions, error) {
+	opts := &MCPOptions{}
+	var err error
+
+	opts.AdditionalIgnores, err = cmd.Flags().GetStringSlice("ignore")
+	if err != nil {
+		return nil, fmt.Errorf("error getting ignore flag: %w", err)
+	}
+
+	return opts, nil
+}
+
+// server holds the state of one MCP session.
+type server struct {
+	root     string
+	opts     *MCPOptions
+	contexts *ctxplugin.ContextPlugin
+
+	// files is the last collect result, whose contents are reused for
+	// files that haven't changed since
+	files *collect.Result
+}
+
+func (s *server) handlers() map[string]handler {
+	return map[string]handler{
+		"initialize":                s.initialize,
+		"notifications/initialized": func(json.RawMessage) (any, *rpcError) { return nil, nil },
+		"ping":                      func(json.RawMessage) (any, *rpcError) { return nil, nil },
+		"tools/list":                s.listTools,
+		"tools/call":                s.callTool,
+	}
+}
+
+func (s *server) initialize(params json.RawMessage) (any, *rpcError) {
+	return map[string]any{
+		"protocolVersion": ProtocolVersion,
+		"capabilities": map[string]any{
+			"tools": map[string]any{},
+		},
+		"serverInfo": map[string]any{
+			"name":    "mktools",
+			"version": version.Version,
+		},
+		"instructions": "Tools to explore the project at " + s.root + ". Paths are relative to the project root. " +
+			"Files hidden by the project's ignore policy can't be listed, read or searched.",
+	}, nil
+}
+
+func (s *server) listTools(params json.RawMessage) (any, *rpcError) {
+	list := make([]map[string]any, 0, len(tools))
+	for _, t := range tools {
+		list = append(list, map[string]any{
+			"name":        t.name,
+			"description": t.description,
+			"inputSchema": t.schema,
+		})
+	}
+	return map[string]any{"tools": list}, nil
+}
+
+// callTool runs a tool. Failures of the tool itself are reported in the
+// result with isError, so the client's model can see and react to them.
+func (s *server) callTool(params json.RawMessage) (any, *rpcError) {
+	var call struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	}
+	if err := json.Unmarshal(params, &call); err != nil {
+		return nil, errorf(codeInvalidParams, "invalid params: %v", err)
+	}
+
+	var t *tool
+	for i := range tools {
+		if tools[i].name == call.Name {
+			t = &tools[i]
+		}
+	}
+	if t == nil {
+		return nil, errorf(codeInvalidParams, "unknown tool: %s", call.Name)
+	}
+
+	args := call.Arguments
+	if len(args) == 0 || string(args) == "null" {
+		args = json.RawMessage("{}")
+	}
+	text, err := t.run(s, args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", call.Name, err)
+		return toolResult(err.Error(), true), nil
+	}
+	return toolResult(text, false), nil
+}
+
+func toolResult(text string, isError bool) map[string]any {
+	return map[string]any{
+		"content": []map[string]any{{"type": "text", "text": text}},
+		"isError": isError,
+	}
+}
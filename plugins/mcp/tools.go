@@ -0,0 +1,321 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/amenophis1er/mktools/internal/collect"
+	"github.com/amenophis1er/mktools/internal/metadata"
+	ctxplugin "github.com/amenophis1er/mktools/plugins/context"
+)
+
+const (
+	// defaultSearchResults and maxSearchResults bound the matches returned
+	// by search.
+	defaultSearchResults = 50
+	maxSearchResults     = 500
+
+	// maxMatchLength truncates long matching lines, such as minified code.
+	maxMatchLength = 300
+)
+
+// tool is an MCP tool. run decodes its JSON arguments and returns the text
+// given to the client.
+type tool struct {
+	name        string
+	description string
+	schema      map[string]any
+	run         func(s *server, args json.RawMessage) (string, error)
+}
+
+var tools = []tool{
+	{
+		name:        "get_context",
+		description: "Generate the mktools context of the project: its type, git information, file structure and file contents.",
+		schema: objectSchema(map[string]any{
+			"structure_only": property("boolean", "Only include the file structure"),
+			"content_only":   property("boolean", "Only include the file contents"),
+			"ignore": map[string]any{
+				"type":        "array",
+				"items":       map[string]any{"type": "string"},
+				"description": "Additional gitignore-style patterns to leave out",
+			},
+		}),
+		run: (*server).getContext,
+	},
+	{
+		name:        "list_files",
+		description: "List the project files with their sizes in bytes.",
+		schema: objectSchema(map[string]any{
+			"pattern": property("string", "Glob matched against the path, or the file name when it has no slash (e.g. *.go, cmd/*.go)"),
+		}),
+		run: (*server).listFiles,
+	},
+	{
+		name:        "read_file",
+		description: "Read a project file, optionally limited to a range of lines.",
+		schema: objectSchema(map[string]any{
+			"path":       property("string", "Path relative to the project root"),
+			"start_line": property("integer", "First line to return, starting at 1"),
+			"end_line":   property("integer", "Last line to return"),
+		}, "path"),
+		run: (*server).readFile,
+	},
+	{
+		name:        "project_info",
+		description: "Report the project type and, for git repositories, the branch, commit and status.",
+		schema:      objectSchema(map[string]any{}),
+		run:         (*server).projectInfo,
+	},
+	{
+		name:        "search",
+		description: "Search the project files for a string or regular expression and return the matching lines as path:line: text.",
+		schema: objectSchema(map[string]any{
+			"query":       property("string", "Text to search for"),
+			"regex":       property("boolean", "Treat query as a regular expression (RE2 syntax)"),
+			"ignore_case": property("boolean", "Match regardless of case"),
+			"max_results": property("integer", fmt.Sprintf("Maximum number of matches (default %d, at most %d)", defaultSearchResults, maxSearchResults)),
+		}, "query"),
+		run: (*server).search,
+	},
+}
+
+func objectSchema(properties map[string]any, required ...string) map[string]any {
+	schema := map[string]any{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func property(typ, description string) map[string]any {
+	return map[string]any{"type": typ, "description": description}
+}
+
+func decodeArgs(args json.RawMessage, v any) error {
+	if err := json.Unmarshal(args, v); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
+
+// collect returns the files a context of the project would contain. Files
+// outside this set are hidden from every tool. Each call still walks the
+// project, to see added, removed and modified files, but only reads the
+// files whose size or modification time changed since the previous one.
+func (s *server) collect() (*collect.Result, error) {
+	result, err := s.contexts.Fork().Recollect(s.root, &ctxplugin.ContextOptions{
+		AdditionalIgnores: s.opts.AdditionalIgnores,
+	}, s.files)
+	if err != nil {
+		return nil, err
+	}
+	s.files = result
+	return result, nil
+}
+
+func (s *server) getContext(args json.RawMessage) (string, error) {
+	var a struct {
+		StructureOnly bool     `json:"structure_only"`
+		ContentOnly   bool     `json:"content_only"`
+		Ignore        []string `json:"ignore"`
+	}
+	if err := decodeArgs(args, &a); err != nil {
+		return "", err
+	}
+	if a.StructureOnly && a.ContentOnly {
+		return "", fmt.Errorf("structure_only and content_only are mutually exclusive")
+	}
+
+	content, err := s.contexts.Fork().Generate(s.root, &ctxplugin.ContextOptions{
+		StructureOnly:     a.StructureOnly,
+		ContentOnly:       a.ContentOnly,
+		AdditionalIgnores: append(append([]string{}, s.opts.AdditionalIgnores...), a.Ignore...),
+	})
+	if err != nil {
+		return "", err
+	}
+	return metadata.Strip(content), nil
+}
+
+func (s *server) listFiles(args json.RawMessage) (string, error) {
+	var a struct {
+		Pattern string `json:"pattern"`
+	}
+	if err := decodeArgs(args, &a); err != nil {
+		return "", err
+	}
+	if a.Pattern != "" {
+		if _, err := path.Match(a.Pattern, ""); err != nil {
+			return "", fmt.Errorf("invalid pattern: %s", a.Pattern)
+		}
+	}
+
+	result, err := s.collect()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, name := range sortedPaths(result) {
+		slashed := filepath.ToSlash(name)
+		if a.Pattern != "" {
+			target := slashed
+			if !strings.Contains(a.Pattern, "/") {
+				target = path.Base(slashed)
+			}
+			if ok, _ := path.Match(a.Pattern, target); !ok {
+				continue
+			}
+		}
+		fmt.Fprintf(&b, "%s\t%d\n", slashed, result.Entries[name].Size)
+		n++
+	}
+	if n == 0 {
+		return "No matching files", nil
+	}
+	if result.Truncated {
+		b.WriteString("(the list stops at the configured file limit)\n")
+	}
+	return b.String(), nil
+}
+
+func (s *server) readFile(args json.RawMessage) (string, error) {
+	var a struct {
+		Path      string `json:"path"`
+		StartLine int    `json:"start_line"`
+		EndLine   int    `json:"end_line"`
+	}
+	if err := decodeArgs(args, &a); err != nil {
+		return "", err
+	}
+	if a.Path == "" {
+		return "", fmt.Errorf("path is required")
+	}
+
+	result, err := s.collect()
+	if err != nil {
+		return "", err
+	}
+	name := filepath.Clean(filepath.FromSlash(strings.TrimPrefix(a.Path, "./")))
+	content, ok := result.Files[name]
+	if !ok {
+		return "", fmt.Errorf("%s is not a project file, or is hidden by the ignore policy", a.Path)
+	}
+	if a.StartLine == 0 && a.EndLine == 0 {
+		return content, nil
+	}
+
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	start, end := a.StartLine, a.EndLine
+	if start < 1 {
+		start = 1
+	}
+	if end == 0 || end > len(lines) {
+		end = len(lines)
+	}
+	if start > end {
+		return "", fmt.Errorf("line range %d-%d is outside the file (%d lines)", a.StartLine, a.EndLine, len(lines))
+	}
+	return strings.Join(lines[start-1:end], ""), nil
+}
+
+func (s *server) projectInfo(args json.RawMessage) (string, error) {
+	info, err := ctxplugin.DetectProject(s.root)
+	if err != nil {
+		return "", err
+	}
+	out, err := json.MarshalIndent(struct {
+		Root string `json:"root"`
+		*ctxplugin.ProjectInfo
+	}{s.root, info}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+func (s *server) search(args json.RawMessage) (string, error) {
+	var a struct {
+		Query      string `json:"query"`
+		Regex      bool   `json:"regex"`
+		IgnoreCase bool   `json:"ignore_case"`
+		MaxResults int    `json:"max_results"`
+	}
+	if err := decodeArgs(args, &a); err != nil {
+		return "", err
+	}
+	if a.Query == "" {
+		return "", fmt.Errorf("query is required")
+	}
+
+	expr := a.Query
+	if !a.Regex {
+		expr = regexp.QuoteMeta(expr)
+	}
+	if a.IgnoreCase {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return "", fmt.Errorf("invalid regular expression: %w", err)
+	}
+
+	limit := a.MaxResults
+	if limit <= 0 {
+		limit = defaultSearchResults
+	}
+	if limit > maxSearchResults {
+		limit = maxSearchResults
+	}
+
+	result, err := s.collect()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, name := range sortedPaths(result) {
+		for i, line := range strings.Split(result.Files[name], "\n") {
+			if !re.MatchString(line) {
+				continue
+			}
+			if n == limit {
+				fmt.Fprintf(&b, "(stopped after %d matches)\n", limit)
+				return b.String(), nil
+			}
+			line = strings.TrimRight(line, "\r")
+			if len(line) > maxMatchLength {
+				line = line[:maxMatchLength] + "..."
+			}
+			fmt.Fprintf(&b, "%s:%d: %s\n", filepath.ToSlash(name), i+1, line)
+			n++
+		}
+	}
+	if n == 0 {
+		return "No matches", nil
+	}
+	return b.String(), nil
+}
+
+func sortedPaths(result *collect.Result) []string {
+	paths := make([]string, 0, len(result.Files))
+	for name := range result.Files {
+		paths = append(paths, name)
+	}
+	sort.Strings(paths)
+	return paths
+}
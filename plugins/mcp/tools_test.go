@@ -0,0 +1,63 @@
+package mcp
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/amenophis1er/mktools/internal/config"
+	ctxplugin "github.com/amenophis1er/mktools/plugins/context"
+)
+
+func readNotes(t *testing.T, s *server) string {
+	t.Helper()
+	text, err := s.readFile(json.RawMessage(`{"path": "notes.txt"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return text
+}
+
+func TestCollectReadsChangedFilesOnly(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "notes.txt")
+	modTime := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	write := func(content string, modTime time.Time) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.Context.Source = "walk"
+	s := &server{root: root, opts: &MCPOptions{}, contexts: ctxplugin.New(cfg)}
+
+	write("one\n", modTime)
+	if got := readNotes(t, s); got != "one\n" {
+		t.Fatalf("notes.txt = %q, want one", got)
+	}
+
+	// Same size and modification time: the session keeps what it read
+	write("two\n", modTime)
+	if got := readNotes(t, s); got != "one\n" {
+		t.Errorf("notes.txt = %q, want the content read before", got)
+	}
+
+	write("two\n", modTime.Add(time.Second))
+	if got := readNotes(t, s); got != "two\n" {
+		t.Errorf("notes.txt = %q, want two once it changed", got)
+	}
+
+	// Removed files disappear from the session
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.readFile(json.RawMessage(`{"path": "notes.txt"}`)); err == nil {
+		t.Error("read a removed file")
+	}
+}
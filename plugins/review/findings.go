@@ -0,0 +1,267 @@
+package review
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/amenophis1er/mktools/version"
+)
+
+// Finding is one problem the reviewer found.
+type Finding struct {
+	File     string `json:"file"`
+	Line     int    `json:"line,omitempty"`
+	Severity string `json:"severity"`
+	Rule     string `json:"rule,omitempty"`
+	Message  string `json:"message"`
+}
+
+var severityRank = map[string]int{
+	"note":    1,
+	"warning": 2,
+	"error":   3,
+}
+
+// parseFindings reads the model's reply, tolerating the code fences and
+// prose models sometimes put around JSON.
+func parseFindings(content string) ([]Finding, error) {
+	start := strings.Index(content, "{")
+	end := strings.LastIndex(content, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("the model didn't reply with findings: %s", abbreviate(content))
+	}
+
+	var reply struct {
+		Findings []Finding `json:"findings"`
+	}
+	if err := json.Unmarshal([]byte(content[start:end+1]), &reply); err != nil {
+		return nil, fmt.Errorf("failed to parse findings: %w", err)
+	}
+
+	findings := make([]Finding, 0, len(reply.Findings))
+	for _, f := range reply.Findings {
+		if strings.TrimSpace(f.Message) == "" {
+			continue
+		}
+		f.File = strings.TrimPrefix(strings.TrimPrefix(strings.TrimPrefix(f.File, "a/"), "b/"), "./")
+		f.Severity = normalizeSeverity(f.Severity)
+		f.Message = strings.TrimSpace(f.Message)
+		if f.Line < 0 {
+			f.Line = 0
+		}
+		findings = append(findings, f)
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].File != findings[j].File {
+			return findings[i].File < findings[j].File
+		}
+		return findings[i].Line < findings[j].Line
+	})
+	return findings, nil
+}
+
+// normalizeSeverity maps the other scales models use onto error, warning
+// and note.
+func normalizeSeverity(severity string) string {
+	switch strings.ToLower(strings.TrimSpace(severity)) {
+	case "error", "critical", "high", "blocker", "major":
+		return "error"
+	case "warning", "warn", "medium":
+		return "warning"
+	default:
+		return "note"
+	}
+}
+
+func countAtLeast(findings []Finding, severity string) int {
+	if severity == "" {
+		return 0
+	}
+	n := 0
+	for _, f := range findings {
+		if severityRank[f.Severity] >= severityRank[severity] {
+			n++
+		}
+	}
+	return n
+}
+
+func summarize(findings []Finding) string {
+	if len(findings) == 0 {
+		return "No findings"
+	}
+	counts := make(map[string]int)
+	for _, f := range findings {
+		counts[f.Severity]++
+	}
+	var parts []string
+	for _, severity := range []string{"error", "warning", "note"} {
+		if n := counts[severity]; n > 0 {
+			parts = append(parts, plural(n, severity))
+		}
+	}
+	return fmt.Sprintf("%s: %s", plural(len(findings), "finding"), strings.Join(parts, ", "))
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", word)
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
+
+func abbreviate(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) > 200 {
+		return s[:200] + "..."
+	}
+	return s
+}
+
+func writeFindings(w io.Writer, format string, findings []Finding) error {
+	switch format {
+	case "json":
+		return writeJSON(w, struct {
+			Findings []Finding `json:"findings"`
+		}{findings})
+	case "sarif":
+		return writeJSON(w, toSARIF(findings))
+	default:
+		return writeText(w, findings)
+	}
+}
+
+// writeText prints findings in the file:line: severity: message form that
+// editors and terminals link to.
+func writeText(w io.Writer, findings []Finding) error {
+	for _, f := range findings {
+		location := f.File
+		if f.Line > 0 {
+			location = fmt.Sprintf("%s:%d", f.File, f.Line)
+		}
+		rule := ""
+		if f.Rule != "" {
+			rule = " [" + f.Rule + "]"
+		}
+		if _, err := fmt.Fprintf(w, "%s: %s: %s%s\n", location, f.Severity, f.Message, rule); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(w, summarize(findings))
+	return err
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("failed to write findings: %w", err)
+	}
+	return nil
+}
+
+// The subset of SARIF 2.1.0 that code scanning tools read.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version,omitempty"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID string `json:"id"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+func toSARIF(findings []Finding) *sarifLog {
+	rules := []sarifRule{}
+	seen := make(map[string]bool)
+	results := make([]sarifResult, 0, len(findings))
+
+	for _, f := range findings {
+		rule := f.Rule
+		if rule == "" {
+			rule = "review"
+		}
+		if !seen[rule] {
+			seen[rule] = true
+			rules = append(rules, sarifRule{ID: rule})
+		}
+
+		location := sarifLocation{
+			PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: f.File},
+			},
+		}
+		if f.Line > 0 {
+			location.PhysicalLocation.Region = &sarifRegion{StartLine: f.Line}
+		}
+
+		results = append(results, sarifResult{
+			RuleID:    rule,
+			Level:     f.Severity,
+			Message:   sarifMessage{Text: f.Message},
+			Locations: []sarifLocation{location},
+		})
+	}
+
+	return &sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "mktools",
+				Version:        version.Version,
+				InformationURI: "https://github.com/amenophis1er/mktools",
+				Rules:          rules,
+			}},
+			Results: results,
+		}},
+	}
+}
@@ -0,0 +1,152 @@
+package review
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFindings(t *testing.T) {
+	content := "Here is my review:\n```json\n" + `{"findings": [
+		{"file": "b/main.go", "line": 12, "severity": "High", "rule": "correctness", "message": " nil map write "},
+		{"file": "./cmd/root.go", "line": -3, "severity": "warn", "message": "unchecked error"},
+		{"file": "a/main.go", "line": 4, "severity": "nit", "message": "rename x"},
+		{"file": "main.go", "line": 8, "severity": "error", "message": "   "}
+	]}` + "\n```\nLet me know if you have questions."
+
+	got, err := parseFindings(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Finding{
+		{File: "cmd/root.go", Line: 0, Severity: "warning", Message: "unchecked error"},
+		{File: "main.go", Line: 4, Severity: "note", Message: "rename x"},
+		{File: "main.go", Line: 12, Severity: "error", Rule: "correctness", Message: "nil map write"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findings =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestParseFindingsEmpty(t *testing.T) {
+	got, err := parseFindings(`{"findings": []}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || len(got) != 0 {
+		t.Errorf("findings = %#v, want an empty list", got)
+	}
+}
+
+func TestParseFindingsInvalid(t *testing.T) {
+	for _, content := range []string{
+		"The change looks good to me.",
+		`{"findings": [{"file": "main.go",}]}`,
+	} {
+		if _, err := parseFindings(content); err == nil {
+			t.Errorf("parseFindings(%q) succeeded, want an error", content)
+		}
+	}
+}
+
+var testFindings = []Finding{
+	{File: "main.go", Line: 12, Severity: "error", Rule: "correctness", Message: "nil map write"},
+	{File: "go.mod", Severity: "note", Message: "toolchain is old"},
+}
+
+func TestWriteText(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeFindings(&buf, "text", testFindings); err != nil {
+		t.Fatal(err)
+	}
+	want := "main.go:12: error: nil map write [correctness]\n" +
+		"go.mod: note: toolchain is old\n" +
+		"2 findings: 1 error, 1 note\n"
+	if buf.String() != want {
+		t.Errorf("text =\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	writeFindings(&buf, "text", nil)
+	if buf.String() != "No findings\n" {
+		t.Errorf("text without findings = %q", buf.String())
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeFindings(&buf, "json", testFindings); err != nil {
+		t.Fatal(err)
+	}
+
+	var got struct {
+		Findings []Finding `json:"findings"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Findings, testFindings) {
+		t.Errorf("findings = %+v, want %+v", got.Findings, testFindings)
+	}
+	if strings.Contains(buf.String(), `"line": 0`) || strings.Contains(buf.String(), `"rule": ""`) {
+		t.Errorf("empty line and rule should be omitted:\n%s", buf.String())
+	}
+}
+
+func TestWriteSARIF(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeFindings(&buf, "sarif", testFindings); err != nil {
+		t.Fatal(err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("log = %+v", log)
+	}
+	run := log.Runs[0]
+	if run.Tool.Driver.Name != "mktools" {
+		t.Errorf("driver = %+v", run.Tool.Driver)
+	}
+	if !reflect.DeepEqual(run.Tool.Driver.Rules, []sarifRule{{ID: "correctness"}, {ID: "review"}}) {
+		t.Errorf("rules = %+v", run.Tool.Driver.Rules)
+	}
+	if len(run.Results) != 2 {
+		t.Fatalf("results = %+v", run.Results)
+	}
+
+	first := run.Results[0]
+	if first.RuleID != "correctness" || first.Level != "error" || first.Message.Text != "nil map write" {
+		t.Errorf("first result = %+v", first)
+	}
+	loc := first.Locations[0].PhysicalLocation
+	if loc.ArtifactLocation.URI != "main.go" || loc.Region == nil || loc.Region.StartLine != 12 {
+		t.Errorf("first location = %+v", loc)
+	}
+
+	second := run.Results[1]
+	if second.RuleID != "review" || second.Level != "note" || second.Locations[0].PhysicalLocation.Region != nil {
+		t.Errorf("second result = %+v", second)
+	}
+}
+
+func TestCountAtLeast(t *testing.T) {
+	tests := []struct {
+		severity string
+		want     int
+	}{
+		{"", 0},
+		{"error", 1},
+		{"warning", 1},
+		{"note", 2},
+	}
+	for _, tt := range tests {
+		if got := countAtLeast(testFindings, tt.severity); got != tt.want {
+			t.Errorf("countAtLeast(%q) = %d, want %d", tt.severity, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package review
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/amenophis1er/mktools/internal/collect"
+	"github.com/amenophis1er/mktools/internal/config"
+	"github.com/amenophis1er/mktools/internal/git"
+	"github.com/amenophis1er/mktools/internal/llm"
+	ctxplugin "github.com/amenophis1er/mktools/plugins/context"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// maxDiffSize bounds the diff sent to the model.
+	maxDiffSize = 100 << 10
+
+	// maxContentSize bounds the full contents of the changed files sent
+	// along with the diff. Files past it are reviewed from the diff alone.
+	maxContentSize = 200 << 10
+
+	// maxOutputTokens leaves room for long lists of findings.
+	maxOutputTokens = 8192
+)
+
+type ReviewPlugin struct {
+	config *config.Config
+}
+
+type ReviewOptions struct {
+	Range   string
+	Format  string
+	Output  string
+	FailOn  string
+	Model   string
+	NoCache bool
+}
+
+func New(cfg *config.Config) *ReviewPlugin {
+	return &ReviewPlugin{
+		config: cfg,
+	}
+}
+
+func (p *ReviewPlugin) Name() string {
+	return "review"
+}
+
+func (p *ReviewPlugin) Description() string {
+	return "Review a diff with the configured model"
+}
+
+func (p *ReviewPlugin) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().String("range", "", "revision range to review, as base..head or base...head (default: uncommitted changes)")
+	cmd.Flags().StringP("format", "f", "text", "output format (text, json, sarif)")
+	cmd.Flags().StringP("output", "o", "", "write the findings to this file instead of stdout")
+	cmd.Flags().String("fail-on", "", "exit non-zero on findings of this severity or worse (error, warning, note)")
+	cmd.Flags().String("model", "", "model to use (default from config)")
+	cmd.Flags().Bool("no-cache", false, "don't reuse or store cached responses")
+}
+
+func (p *ReviewPlugin) Execute(ctx context.Context, cmd *cobra.Command, args []string) error {
+	opts, err := p.parseFlags(cmd)
+	if err != nil {
+		return err
+	}
+
+	root, err := git.Root(".")
+	if err != nil {
+		return err
+	}
+
+	// The range comes after --end-of-options so that a value such as
+	// --output=<file> can't be taken for an option.
+	diffArgs := []string{"--end-of-options", "HEAD"}
+	if opts.Range != "" {
+		diffArgs = []string{"--end-of-options", opts.Range}
+	}
+	files, err := git.ChangedFiles(root, diffArgs...)
+	if err != nil {
+		return err
+	}
+	if opts.Range == "" {
+		// New files count as changes before they are added
+		untracked, err := git.Run(root, "ls-files", "--others", "--exclude-standard", "-z")
+		if err != nil {
+			return err
+		}
+		for _, path := range strings.Split(strings.TrimRight(untracked, "\x00"), "\x00") {
+			if path != "" {
+				files[path] = "A"
+			}
+		}
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no changes to review")
+	}
+	diff, err := git.Run(root, append([]string{"diff", "--no-color", "--no-ext-diff", "-U5"}, diffArgs...)...)
+	if err != nil {
+		return err
+	}
+
+	llmConfig := p.config.LLM
+	llmConfig.Cache.Enabled = llmConfig.Cache.Enabled && !opts.NoCache
+	provider, err := llm.New(llmConfig)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Reviewing %s...\n", plural(len(files), "changed file"))
+	resp, err := provider.Complete(ctx, &llm.Request{
+		Model:     opts.Model,
+		System:    p.systemPrompt(),
+		Messages:  []llm.Message{{Role: llm.RoleUser, Content: p.buildPrompt(root, opts.Range, files, diff)}},
+		MaxTokens: maxOutputTokens,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to review changes: %w", err)
+	}
+	if resp.Cached {
+		fmt.Fprintln(os.Stderr, "Using the cached review of these changes (use --no-cache for a fresh one)")
+	}
+
+	findings, err := parseFindings(resp.Content)
+	if err != nil {
+		return err
+	}
+
+	out := os.Stdout
+	if opts.Output != "" {
+		f, err := os.Create(opts.Output)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	if err := writeFindings(out, opts.Format, findings); err != nil {
+		return err
+	}
+	if opts.Output != "" {
+		fmt.Fprintf(os.Stderr, "%s written to %s\n", summarize(findings), opts.Output)
+	}
+
+	if n := countAtLeast(findings, opts.FailOn); n > 0 {
+		return fmt.Errorf("%s at or above %s severity", plural(n, "finding"), opts.FailOn)
+	}
+	return nil
+}
+
+func (p *ReviewPlugin) systemPrompt() string {
+	var b strings.Builder
+	b.WriteString("You are a careful senior engineer reviewing a code change.\n")
+	b.WriteString("Review the diff you are shown against this rubric:\n")
+	for _, item := range p.config.Review.Rubric {
+		b.WriteString("- " + strings.TrimSpace(item) + "\n")
+	}
+	b.WriteString("\nReport real problems in the changed code only; the full files are there for context. ")
+	b.WriteString("Don't praise, summarize or restate the change, and don't report style nits a formatter would fix. ")
+	b.WriteString("If there is nothing worth reporting, return no findings.\n\n")
+	b.WriteString("Reply with a JSON object and nothing else, in this form:\n")
+	b.WriteString(`{"findings": [{"file": "path/from/repo/root", "line": 42, "severity": "warning", "rule": "correctness", "message": "what is wrong and how to fix it"}]}`)
+	b.WriteString("\n\nseverity is error (a bug or vulnerability that must be fixed), warning (likely problem) ")
+	b.WriteString("or note (suggestion). line is the line number in the new version of the file, ")
+	b.WriteString("or 0 for a finding about the whole file. rule is a short lowercase name for the rubric item.\n")
+	return b.String()
+}
+
+// buildPrompt gathers the diff and the new version of each changed file,
+// numbered so the model can point at lines. Untracked files aren't in the
+// diff; their content shows them in full.
+func (p *ReviewPlugin) buildPrompt(root, revRange string, files map[string]string, diff string) string {
+	var b strings.Builder
+
+	if info, err := ctxplugin.DetectProject(root); err == nil {
+		b.WriteString(fmt.Sprintf("Project type: %s\n\n", info.Type))
+	}
+
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	b.WriteString("Changed files:\n")
+	for _, path := range paths {
+		b.WriteString(fmt.Sprintf("%s %s\n", files[path], path))
+	}
+	b.WriteString("\n")
+
+	if len(diff) > maxDiffSize {
+		diff = diff[:maxDiffSize] + "\n[diff truncated]\n"
+	}
+	b.WriteString("Diff:\n")
+	b.WriteString(diff)
+	b.WriteString("\n")
+
+	budget := maxContentSize
+	for _, path := range paths {
+		if files[path] == "D" {
+			continue
+		}
+		content, err := newContent(root, revRange, path)
+		if err != nil || !collect.IsText([]byte(content)) {
+			continue
+		}
+		if len(content) > budget {
+			b.WriteString(fmt.Sprintf("## %s\n\n[content omitted: too large]\n\n", path))
+			continue
+		}
+		budget -= len(content)
+		b.WriteString(fmt.Sprintf("## %s\n\n", path))
+		b.WriteString(numberLines(content))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// newContent reads the version of path after the change: the head of the
+// range, or the working tree when reviewing uncommitted changes. A single
+// revision is diffed against the working tree, so the working tree is read
+// for it too.
+func newContent(root, revRange, path string) (string, error) {
+	i := strings.LastIndex(revRange, "..")
+	if i < 0 {
+		content, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(path)))
+		return string(content), err
+	}
+
+	head := "HEAD"
+	if h := strings.TrimPrefix(revRange[i+2:], "."); h != "" {
+		head = h
+	}
+	return git.Run(root, "show", "--end-of-options", head+":"+path)
+}
+
+func numberLines(content string) string {
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	width := len(fmt.Sprint(len(lines)))
+
+	var b strings.Builder
+	for i, line := range lines {
+		b.WriteString(fmt.Sprintf("%*d| %s\n", width, i+1, line))
+	}
+	return b.String()
+}
+
+func (p *ReviewPlugin) parseFlags(cmd *cobra.Command) (*ReviewOptions, error) {
+	opts := &ReviewOptions{}
+
+	var err error
+
+	opts.Range, err = cmd.Flags().GetString("range")
+	if err != nil {
+		return nil, fmt.Errorf("error getting range flag: %w", err)
+	}
+
+	opts.Format, err = cmd.Flags().GetString("format")
+	if err != nil {
+		return nil, fmt.Errorf("error getting format flag: %w", err)
+	}
+	switch opts.Format {
+	case "text", "json", "sarif":
+		// valid
+	default:
+		return nil, fmt.Errorf("invalid format: %s (must be text, json or sarif)", opts.Format)
+	}
+
+	opts.Output, err = cmd.Flags().GetString("output")
+	if err != nil {
+		return nil, fmt.Errorf("error getting output flag: %w", err)
+	}
+
+	opts.FailOn, err = cmd.Flags().GetString("fail-on")
+	if err != nil {
+		return nil, fmt.Errorf("error getting fail-on flag: %w", err)
+	}
+	if opts.FailOn == "" {
+		opts.FailOn = p.config.Review.FailOn
+	}
+	if opts.FailOn != "" && severityRank[opts.FailOn] == 0 {
+		return nil, fmt.Errorf("invalid fail-on severity: %s (must be error, warning or note)", opts.FailOn)
+	}
+
+	opts.Model, err = cmd.Flags().GetString("model")
+	if err != nil {
+		return nil, fmt.Errorf("error getting model flag: %w", err)
+	}
+
+	opts.NoCache, err = cmd.Flags().GetBool("no-cache")
+	if err != nil {
+		return nil, fmt.Errorf("error getting no-cache flag: %w", err)
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,224 @@
+package review
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/amenophis1er/mktools/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// mockProvider is an Anthropic-compatible server that replies with reply
+// and records the prompts it was sent.
+type mockProvider struct {
+	*httptest.Server
+	reply   string
+	prompts []string
+}
+
+func newMockProvider(t *testing.T, reply string) *mockProvider {
+	m := &mockProvider{reply: reply}
+	m.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Messages) == 0 {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		m.prompts = append(m.prompts, req.Messages[0].Content)
+
+		content, _ := json.Marshal(m.reply)
+		fmt.Fprintf(w, `{"model":"claude-test","content":[{"type":"text","text":%s}],"stop_reason":"end_turn","usage":{"input_tokens":10,"output_tokens":5}}`, content)
+	}))
+	t.Cleanup(m.Close)
+	return m
+}
+
+func (m *mockProvider) config() *config.Config {
+	cfg := config.DefaultConfig()
+	cfg.LLM.Provider = "anthropic"
+	cfg.LLM.Model = "claude-test"
+	cfg.LLM.APIKey = "test-key"
+	cfg.LLM.BaseURL = m.URL
+	cfg.LLM.Retry.MaxAttempts = 1
+	cfg.LLM.Cache.Enabled = false
+	cfg.LLM.Ledger.Enabled = false
+	return cfg
+}
+
+// gitRepo creates a repository with one commit of main.go, changes main.go
+// in the working tree and makes it the current directory.
+func gitRepo(t *testing.T) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	run := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	write := func(content string) {
+		if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run("init", "-q")
+	write("package main\n\nfunc main() {}\n")
+	run("add", "main.go")
+	run("commit", "-q", "-m", "init")
+	write("package main\n\nfunc main() {\n\tvar m map[string]int\n\tm[\"x\"] = 1\n}\n")
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return dir
+}
+
+func runReview(t *testing.T, cfg *config.Config, args ...string) error {
+	p := New(cfg)
+	cmd := &cobra.Command{Use: "review"}
+	p.AddFlags(cmd)
+	if err := cmd.ParseFlags(args); err != nil {
+		t.Fatal(err)
+	}
+	return p.Execute(context.Background(), cmd, nil)
+}
+
+const reviewReply = "```json\n" + `{"findings": [
+	{"file": "main.go", "line": 5, "severity": "error", "rule": "correctness", "message": "write to a nil map"},
+	{"file": "main.go", "line": 4, "severity": "note", "message": "use make"}
+]}` + "\n```"
+
+func TestReview(t *testing.T) {
+	dir := gitRepo(t)
+	mock := newMockProvider(t, reviewReply)
+	output := filepath.Join(dir, "findings.json")
+
+	if err := runReview(t, mock.config(), "--format", "json", "--output", output); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mock.prompts) != 1 {
+		t.Fatalf("provider called %d times, want 1", len(mock.prompts))
+	}
+	prompt := mock.prompts[0]
+	for _, want := range []string{"M main.go", "+\tm[\"x\"] = 1", "## main.go", "5| \tm[\"x\"] = 1"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt is missing %q:\n%s", want, prompt)
+		}
+	}
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Findings []Finding `json:"findings"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Findings) != 2 || got.Findings[0].Line != 4 || got.Findings[1].Severity != "error" {
+		t.Errorf("findings = %+v", got.Findings)
+	}
+}
+
+func TestReviewSingleRevision(t *testing.T) {
+	dir := gitRepo(t)
+	mock := newMockProvider(t, `{"findings": []}`)
+
+	if err := runReview(t, mock.config(), "--range", "HEAD", "--output", filepath.Join(dir, "findings.txt")); err != nil {
+		t.Fatal(err)
+	}
+	// The working tree is diffed against HEAD, so its content is sent
+	if !strings.Contains(mock.prompts[0], "5| \tm[\"x\"] = 1") {
+		t.Errorf("prompt doesn't show the working tree version of main.go:\n%s", mock.prompts[0])
+	}
+}
+
+func TestReviewOptionLikeRange(t *testing.T) {
+	dir := gitRepo(t)
+	mock := newMockProvider(t, `{"findings": []}`)
+	written := filepath.Join(dir, "written")
+
+	for _, revRange := range []string{"--output=" + written, "HEAD..--output=" + written} {
+		if err := runReview(t, mock.config(), "--range", revRange, "--output", filepath.Join(dir, "findings.txt")); err == nil {
+			t.Errorf("range %q: expected an error", revRange)
+		}
+		if _, err := os.Stat(written); err == nil {
+			t.Fatalf("range %q was passed to git as an option", revRange)
+		}
+	}
+}
+
+func TestReviewFailOn(t *testing.T) {
+	tests := []struct {
+		name    string
+		failOn  string
+		reply   string
+		wantErr bool
+	}{
+		{name: "unset", reply: reviewReply},
+		{name: "error", failOn: "error", reply: reviewReply, wantErr: true},
+		{name: "note", failOn: "note", reply: reviewReply, wantErr: true},
+		{name: "below threshold", failOn: "warning", reply: `{"findings": [{"file": "main.go", "line": 4, "severity": "note", "message": "use make"}]}`},
+		{name: "no findings", failOn: "error", reply: `{"findings": []}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := gitRepo(t)
+			mock := newMockProvider(t, tt.reply)
+
+			args := []string{"--output", filepath.Join(dir, "findings.txt")}
+			if tt.failOn != "" {
+				args = append(args, "--fail-on", tt.failOn)
+			}
+			err := runReview(t, mock.config(), args...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReviewFailOnFromConfig(t *testing.T) {
+	dir := gitRepo(t)
+	mock := newMockProvider(t, reviewReply)
+	cfg := mock.config()
+	cfg.Review.FailOn = "error"
+
+	err := runReview(t, cfg, "--output", filepath.Join(dir, "findings.txt"))
+	if err == nil || !strings.Contains(err.Error(), "1 finding at or above error") {
+		t.Errorf("err = %v, want one finding at or above error", err)
+	}
+}
+
+func TestReviewInvalidReply(t *testing.T) {
+	gitRepo(t)
+	mock := newMockProvider(t, "Looks good to me!")
+
+	if err := runReview(t, mock.config()); err == nil {
+		t.Error("expected an error for a reply without findings")
+	}
+}
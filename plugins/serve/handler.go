@@ -0,0 +1,341 @@
+package serve
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/amenophis1er/mktools/internal/config"
+	ctxplugin "github.com/amenophis1er/mktools/plugins/context"
+	"github.com/amenophis1er/mktools/version"
+)
+
+// maxRequestBody bounds the JSON accepted by POST endpoints.
+const maxRequestBody = 1 << 20
+
+// contextRequest is the body of POST /v1/context.
+type contextRequest struct {
+	Path string `json:"path"`
+	ctxplugin.ContextOptions
+}
+
+// fileInfo is an entry of GET /v1/files.
+type fileInfo struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// httpError is an error with the status code it is reported with.
+type httpError struct {
+	status int
+	err    error
+}
+
+func (e *httpError) Error() string {
+	return e.err.Error()
+}
+
+func errorStatus(status int, format string, args ...any) error {
+	return &httpError{status: status, err: fmt.Errorf(format, args...)}
+}
+
+type handler struct {
+	root string
+
+	// realRoot is root with symbolic links resolved, to check where the
+	// paths of requests really lead.
+	realRoot string
+}
+
+// newHandler serves the API for the projects under root to clients that
+// address the server on a loopback name or on addr, the address it
+// listens on.
+func newHandler(root, addr string) (http.Handler, error) {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve path: %w", err)
+	}
+	h := &handler{root: root, realRoot: realRoot}
+
+	mux := http.NewServeMux()
+	mux.Handle("/v1/health", route(http.MethodGet, h.health))
+	mux.Handle("/v1/project", route(http.MethodGet, h.project))
+	mux.Handle("/v1/files", route(http.MethodGet, h.files))
+	mux.Handle("/v1/status", route(http.MethodGet, h.status))
+	mux.Handle("/v1/context", route(http.MethodPost, h.context))
+	return checkHost(addr, mux), nil
+}
+
+// checkHost refuses requests whose Host header is neither a loopback name
+// nor the host of addr. A web page can point its own domain at 127.0.0.1
+// and have the browser call the API (DNS rebinding); such requests still
+// carry the page's domain as Host.
+func checkHost(addr string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !allowedHost(r.Host, addr) {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "host not allowed: " + r.Host})
+			fmt.Fprintf(os.Stderr, "%s %s %d (host %s)\n", r.Method, r.URL.RequestURI(), http.StatusForbidden, r.Host)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func allowedHost(hostport, addr string) bool {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return true
+	}
+
+	// A server listening on a specific address is also reached by it;
+	// one listening on all interfaces names no host to accept
+	bound, _, err := net.SplitHostPort(addr)
+	if err != nil || bound == "" {
+		return false
+	}
+	if ip := net.ParseIP(bound); ip != nil && ip.IsUnspecified() {
+		return false
+	}
+	return strings.EqualFold(host, bound)
+}
+
+// route restricts fn to method, reports its errors as JSON and logs the
+// request to stderr.
+func route(method string, fn func(w http.ResponseWriter, r *http.Request) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		status := http.StatusOK
+
+		var err error
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			err = errorStatus(http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+		} else {
+			err = fn(w, r)
+		}
+		if err != nil {
+			status = http.StatusInternalServerError
+			if he, ok := err.(*httpError); ok {
+				status = he.status
+			}
+			writeJSON(w, status, map[string]string{"error": err.Error()})
+		}
+
+		fmt.Fprintf(os.Stderr, "%s %s %d %s\n", r.Method, r.URL.RequestURI(), status, time.Since(start).Round(time.Millisecond))
+	})
+}
+
+// writeJSON writes v as the response. Once the status is sent, a failed
+// write can only mean the client went away, so it isn't reported.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
+
+// resolve returns the project path a request refers to: the served root,
+// or a path relative to it. Paths that lead outside the root, directly or
+// through a symbolic link, are refused. Only contexts can be built from
+// files, which are archives.
+func (h *handler) resolve(path string, allowFile bool) (string, error) {
+	if path == "" {
+		return h.root, nil
+	}
+	full := filepath.Join(h.root, filepath.FromSlash(path))
+	if !within(h.root, full) {
+		return "", errorStatus(http.StatusForbidden, "path outside the served directory: %s", path)
+	}
+
+	info, err := os.Stat(full)
+	if err != nil {
+		return "", errorStatus(http.StatusNotFound, "no such project: %s", path)
+	}
+	if real, err := filepath.EvalSymlinks(full); err != nil || !within(h.realRoot, real) {
+		return "", errorStatus(http.StatusForbidden, "path outside the served directory: %s", path)
+	}
+	if !info.IsDir() && !allowFile {
+		return "", errorStatus(http.StatusBadRequest, "not a directory: %s", path)
+	}
+	return full, nil
+}
+
+// within reports whether path is root or below it. Both must be clean.
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// contexts returns a context plugin configured for the project at path,
+// with its own .mktools.yaml applied. Archives use the configuration of
+// the served directory. Each request gets its own plugin, as generating a
+// context changes the plugin's state.
+func (h *handler) contexts(path string) (*ctxplugin.ContextPlugin, *config.Config, error) {
+	dir := path
+	if info, err := os.Stat(path); err == nil && !info.IsDir() {
+		dir = h.root
+	}
+	cfg, err := config.LoadDir(dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	return ctxplugin.New(cfg), cfg, nil
+}
+
+func (h *handler) health(w http.ResponseWriter, r *http.Request) error {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "version": version.Version, "root": h.root})
+	return nil
+}
+
+func (h *handler) project(w http.ResponseWriter, r *http.Request) error {
+	path, err := h.resolve(r.URL.Query().Get("path"), false)
+	if err != nil {
+		return err
+	}
+
+	info, err := ctxplugin.DetectProject(path)
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Path string `json:"path"`
+		*ctxplugin.ProjectInfo
+	}{path, info})
+	return nil
+}
+
+func (h *handler) files(w http.ResponseWriter, r *http.Request) error {
+	query := r.URL.Query()
+	path, err := h.resolve(query.Get("path"), true)
+	if err != nil {
+		return err
+	}
+
+	opts := &ctxplugin.ContextOptions{
+		AdditionalIgnores: query["ignore"],
+		Source:            query.Get("source"),
+		Rev:               query.Get("rev"),
+	}
+	if err := opts.Validate(); err != nil {
+		return errorStatus(http.StatusBadRequest, "%v", err)
+	}
+
+	contexts, _, err := h.contexts(path)
+	if err != nil {
+		return err
+	}
+	result, err := contexts.Collect(path, opts)
+	if err != nil {
+		return err
+	}
+
+	files := make([]fileInfo, 0, len(result.Entries))
+	for _, e := range result.Entries {
+		files = append(files, fileInfo{Path: e.Name, Size: e.Size, ModTime: e.ModTime})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"path":      path,
+		"files":     files,
+		"truncated": result.Truncated,
+	})
+	return nil
+}
+
+func (h *handler) status(w http.ResponseWriter, r *http.Request) error {
+	path, err := h.resolve(r.URL.Query().Get("path"), false)
+	if err != nil {
+		return err
+	}
+
+	contexts, _, err := h.contexts(path)
+	if err != nil {
+		return err
+	}
+	states, err := contexts.States(path)
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"path":     path,
+		"contexts": states,
+	})
+	return nil
+}
+
+// context generates a context and streams it back as it is rendered, one
+// file section at a time, so neither side holds the whole context.
+func (h *handler) context(w http.ResponseWriter, r *http.Request) error {
+	var req contextRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil && err != io.EOF {
+		return errorStatus(http.StatusBadRequest, "invalid request body: %v", err)
+	}
+	if err := req.ContextOptions.Validate(); err != nil {
+		return errorStatus(http.StatusBadRequest, "%v", err)
+	}
+	path, err := h.resolve(req.Path, true)
+	if err != nil {
+		return err
+	}
+
+	contexts, cfg, err := h.contexts(path)
+	if err != nil {
+		return err
+	}
+	format := req.Format
+	if format == "" {
+		format = cfg.Context.OutputFormat
+	}
+	contentType := "text/markdown; charset=utf-8"
+	if format == "txt" {
+		contentType = "text/plain; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+
+	out := &flushWriter{w: w}
+	if err := contexts.GenerateTo(out, path, &req.ContextOptions); err != nil {
+		if out.written {
+			// The client went away; nothing is left to report to
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// flushWriter sends every write on to the client as soon as it is made.
+type flushWriter struct {
+	w       http.ResponseWriter
+	written bool
+}
+
+func (f *flushWriter) Write(b []byte) (int, error) {
+	f.written = true
+	n, err := f.w.Write(b)
+	if flusher, ok := f.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return n, err
+}
@@ -0,0 +1,192 @@
+package serve
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/amenophis1er/mktools/internal/metadata"
+)
+
+func TestResolve(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	outside := filepath.Join(base, "outside")
+	for _, dir := range []string{filepath.Join(root, "api"), outside} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "project.zip"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	if err := os.Symlink("api", filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &handler{root: root, realRoot: realRoot}
+
+	tests := []struct {
+		path      string
+		allowFile bool
+		want      string
+		status    int
+	}{
+		{path: "", want: root},
+		{path: ".", want: root},
+		{path: "api", want: filepath.Join(root, "api")},
+		{path: "api/../api/", want: filepath.Join(root, "api")},
+		{path: "link", want: filepath.Join(root, "link")},
+		{path: "project.zip", allowFile: true, want: filepath.Join(root, "project.zip")},
+		{path: "project.zip", status: http.StatusBadRequest},
+		{path: "missing", status: http.StatusNotFound},
+		{path: "..", status: http.StatusForbidden},
+		{path: "../outside", status: http.StatusForbidden},
+		{path: "api/../../outside", status: http.StatusForbidden},
+		{path: "escape", status: http.StatusForbidden},
+		// Absolute paths are taken as relative to the root too
+		{path: outside, status: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		got, err := h.resolve(tt.path, tt.allowFile)
+		if tt.status == 0 {
+			if err != nil || got != tt.want {
+				t.Errorf("resolve(%q) = %q, %v, want %q", tt.path, got, err, tt.want)
+			}
+			continue
+		}
+
+		var he *httpError
+		if !errors.As(err, &he) || he.status != tt.status {
+			t.Errorf("resolve(%q) = %q, %v, want status %d", tt.path, got, err, tt.status)
+		}
+	}
+}
+
+func TestAllowedHost(t *testing.T) {
+	tests := []struct {
+		host string
+		addr string
+		want bool
+	}{
+		{host: "localhost:8420", addr: DefaultAddr, want: true},
+		{host: "LOCALHOST", addr: DefaultAddr, want: true},
+		{host: "127.0.0.1:8420", addr: DefaultAddr, want: true},
+		{host: "[::1]:8420", addr: DefaultAddr, want: true},
+		{host: "[::1]", addr: DefaultAddr, want: true},
+		{host: "attacker.example:8420", addr: DefaultAddr, want: false},
+		{host: "", addr: DefaultAddr, want: false},
+		{host: "192.168.1.20:8420", addr: "192.168.1.20:8420", want: true},
+		{host: "devbox:8420", addr: "devbox:8420", want: true},
+		{host: "attacker.example:8420", addr: "0.0.0.0:8420", want: false},
+		{host: "attacker.example:8420", addr: ":8420", want: false},
+	}
+	for _, tt := range tests {
+		if got := allowedHost(tt.host, tt.addr); got != tt.want {
+			t.Errorf("allowedHost(%q, %q) = %v, want %v", tt.host, tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestHandlerRefusesOtherHosts(t *testing.T) {
+	h, err := newHandler(t.TempDir(), DefaultAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/health", nil)
+	req.Host = "attacker.example:8420"
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	req.Host = "localhost:8420"
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+// flushRecorder counts the writes that reached the client.
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushes int
+}
+
+func (r *flushRecorder) Flush() {
+	r.flushes++
+	r.ResponseRecorder.Flush()
+}
+
+func TestContextStreams(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	root := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(name+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h, err := newHandler(root, DefaultAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/v1/context", strings.NewReader(`{}`))
+	req.Host = "localhost:8420"
+	rec := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	// The metadata block, the structure and each section are sent on
+	// their own
+	if rec.flushes < 5 {
+		t.Errorf("flushes = %d, want one per section and more", rec.flushes)
+	}
+
+	content := rec.Body.String()
+	meta, err := metadata.ParseFromContent(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := metadata.Body(content)
+	if !meta.VerifyBody(body) {
+		t.Error("body checksum doesn't match the streamed body")
+	}
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if !strings.Contains(body, "## "+name) {
+			t.Errorf("context has no section for %s", name)
+		}
+	}
+}
+
+func TestContextErrorBeforeStreaming(t *testing.T) {
+	h, err := newHandler(t.TempDir(), DefaultAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/v1/context", strings.NewReader(`{"path": "missing"}`))
+	req.Host = "localhost:8420"
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound || rec.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("response = %d %s, want a JSON 404", rec.Code, rec.Header().Get("Content-Type"))
+	}
+}
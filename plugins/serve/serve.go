@@ -0,0 +1,132 @@
+// Package serve exposes context generation over a local HTTP API, so
+// dashboards and editor extensions can call mktools without starting a
+// process per request.
+package serve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/amenophis1er/mktools/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// DefaultAddr is the address the server listens on without --addr.
+const DefaultAddr = "127.0.0.1:8420"
+
+// shutdownTimeout bounds how long in-flight requests may take to finish
+// once the server is asked to stop.
+const shutdownTimeout = 30 * time.Second
+
+type ServePlugin struct {
+	config *config.Config
+}
+
+type ServeOptions struct {
+	Addr string
+}
+
+func New(cfg *config.Config) *ServePlugin {
+	return &ServePlugin{
+		config: cfg,
+	}
+}
+
+func (p *ServePlugin) Name() string {
+	return "serve"
+}
+
+func (p *ServePlugin) Description() string {
+	return "Serve context generation over a local HTTP API"
+}
+
+func (p *ServePlugin) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().String("addr", DefaultAddr, "address to listen on")
+}
+
+// Execute serves the API until the process is interrupted, then lets
+// in-flight requests finish before returning.
+func (p *ServePlugin) Execute(ctx context.Context, cmd *cobra.Command, args []string) error {
+	opts, err := p.parseFlags(cmd)
+	if err != nil {
+		return err
+	}
+
+	path := "."
+	if len(args) > 0 {
+		path = args[0]
+	}
+	root, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve path: %w", err)
+	}
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return fmt.Errorf("not a directory: %s", path)
+	}
+
+	handler, err := newHandler(root, opts.Addr)
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", opts.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", opts.Addr, err)
+	}
+	if host, _, err := net.SplitHostPort(opts.Addr); err == nil {
+		if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+			fmt.Fprintf(os.Stderr, "Warning: %s is reachable from other machines; the API has no authentication\n", opts.Addr)
+		}
+	}
+
+	srv := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.Serve(listener)
+	}()
+	fmt.Fprintf(os.Stderr, "Serving %s on http://%s (press Ctrl+C to stop)\n", root, listener.Addr())
+
+	select {
+	case err := <-errc:
+		return fmt.Errorf("server failed: %w", err)
+	case <-ctx.Done():
+	}
+
+	fmt.Fprintln(os.Stderr, "Shutting down, waiting for requests in progress...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to shut down: %w", err)
+	}
+	if err := <-errc; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("server failed: %w", err)
+	}
+	return nil
+}
+
+func (p *ServePlugin) parseFlags(cmd *cobra.Command) (*ServeOptions, error) {
+	opts := &ServeOptions{}
+	var err error
+
+	opts.Addr, err = cmd.Flags().GetString("addr")
+	if err != nil {
+		return nil, fmt.Errorf("error getting addr flag: %w", err)
+	}
+
+	return opts, nil
+}